@@ -7,12 +7,20 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"ecommerce-api-v2/internal/auth"
 	"ecommerce-api-v2/internal/database"
 	"ecommerce-api-v2/internal/handlers"
 	"ecommerce-api-v2/internal/middleware"
+	"ecommerce-api-v2/internal/notifier"
+	"ecommerce-api-v2/internal/oidc"
+	"ecommerce-api-v2/internal/pagination"
+	"ecommerce-api-v2/internal/password"
+	"ecommerce-api-v2/internal/storage"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/joho/godotenv"
@@ -31,17 +39,236 @@ func main() {
 	defer dbPool.Close()
 	log.Println("Database connection established")
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET environment variable is not set")
+	keyDir := os.Getenv("JWT_KEY_DIR")
+	if keyDir == "" {
+		keyDir = "keys"
+	}
+
+	signingAlg := os.Getenv("JWT_SIGNING_ALG")
+	if signingAlg == "" {
+		signingAlg = "EdDSA"
+	}
+
+	rotationInterval := 30 * 24 * time.Hour
+	if v := os.Getenv("JWT_KEY_ROTATION_INTERVAL"); v != "" {
+		rotationInterval, err = time.ParseDuration(v)
+		if err != nil || rotationInterval <= 0 {
+			log.Fatalf("Invalid JWT_KEY_ROTATION_INTERVAL: %q", v)
+		}
+	}
+
+	signingKeys, err := auth.LoadKeySet(keyDir, signingAlg)
+	if err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
+
+	rotationCtx, stopRotation := context.WithCancel(context.Background())
+	defer stopRotation()
+	signingKeys.StartRotation(rotationCtx, rotationInterval, 2*rotationInterval)
+
+	// Message bodies are only logged in development, where there is no
+	// other way to read the tokens they carry.
+	var userNotifier notifier.Notifier = &notifier.LogNotifier{ShowBody: os.Getenv("APP_ENV") == "development"}
+	if smtpAddr := os.Getenv("SMTP_ADDR"); smtpAddr != "" {
+		userNotifier = &notifier.SMTPNotifier{
+			Addr:     smtpAddr,
+			From:     os.Getenv("SMTP_FROM"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}
+	} else {
+		log.Println("SMTP_ADDR not set, notifications will be written to the log")
+	}
+
+	loginPolicy := handlers.DefaultLoginPolicy()
+	if v := os.Getenv("LOGIN_MAX_FAILURES"); v != "" {
+		loginPolicy.MaxAccountFailures, err = strconv.Atoi(v)
+		if err != nil || loginPolicy.MaxAccountFailures <= 0 {
+			log.Fatalf("Invalid LOGIN_MAX_FAILURES: %q", v)
+		}
+	}
+	if v := os.Getenv("LOGIN_MAX_IP_FAILURES"); v != "" {
+		loginPolicy.MaxIPFailures, err = strconv.Atoi(v)
+		if err != nil || loginPolicy.MaxIPFailures <= 0 {
+			log.Fatalf("Invalid LOGIN_MAX_IP_FAILURES: %q", v)
+		}
+	}
+	if v := os.Getenv("LOGIN_LOCKOUT_DURATION"); v != "" {
+		loginPolicy.LockoutDuration, err = time.ParseDuration(v)
+		if err != nil || loginPolicy.LockoutDuration <= 0 {
+			log.Fatalf("Invalid LOGIN_LOCKOUT_DURATION: %q", v)
+		}
+	}
+
+	passwordPolicy := password.DefaultPolicy()
+	if v := os.Getenv("PASSWORD_MIN_LENGTH"); v != "" {
+		passwordPolicy.MinLength, err = strconv.Atoi(v)
+		if err != nil || passwordPolicy.MinLength <= 0 || passwordPolicy.MinLength > passwordPolicy.MaxLength {
+			log.Fatalf("Invalid PASSWORD_MIN_LENGTH: %q", v)
+		}
+	}
+	passwordPolicy.RequireUpper = os.Getenv("PASSWORD_REQUIRE_UPPER") == "true"
+	passwordPolicy.RequireLower = os.Getenv("PASSWORD_REQUIRE_LOWER") == "true"
+	passwordPolicy.RequireDigit = os.Getenv("PASSWORD_REQUIRE_DIGIT") == "true"
+	passwordPolicy.RequireSymbol = os.Getenv("PASSWORD_REQUIRE_SYMBOL") == "true"
+	if path := os.Getenv("BREACHED_PASSWORDS_FILE"); path != "" {
+		breached, err := password.LoadBreachedList(path)
+		if err != nil {
+			log.Fatalf("Failed to load breached password list: %v", err)
+		}
+		passwordPolicy.Breached = breached
+		log.Printf("Loaded %d breached password hashes", breached.Len())
+	}
+
+	passwordHasher := password.DefaultHasher()
+	if v := os.Getenv("PASSWORD_HASH_ALGORITHM"); v != "" {
+		passwordHasher.Algorithm = password.Algorithm(v)
+		if passwordHasher.Algorithm != password.Bcrypt && passwordHasher.Algorithm != password.Argon2id {
+			log.Fatalf("Invalid PASSWORD_HASH_ALGORITHM: %q", v)
+		}
+	}
+	if v := os.Getenv("PASSWORD_BCRYPT_COST"); v != "" {
+		passwordHasher.BcryptCost, err = strconv.Atoi(v)
+		if err != nil || passwordHasher.BcryptCost < 10 || passwordHasher.BcryptCost > 31 {
+			log.Fatalf("Invalid PASSWORD_BCRYPT_COST: %q", v)
+		}
+	}
+	if v := os.Getenv("PASSWORD_ARGON2_MEMORY"); v != "" {
+		memory, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || memory < 8*1024 {
+			log.Fatalf("Invalid PASSWORD_ARGON2_MEMORY: %q", v)
+		}
+		passwordHasher.Argon2.Memory = uint32(memory)
+	}
+	if v := os.Getenv("PASSWORD_ARGON2_TIME"); v != "" {
+		iterations, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || iterations == 0 {
+			log.Fatalf("Invalid PASSWORD_ARGON2_TIME: %q", v)
+		}
+		passwordHasher.Argon2.Time = uint32(iterations)
+	}
+	if v := os.Getenv("PASSWORD_ARGON2_THREADS"); v != "" {
+		threads, err := strconv.ParseUint(v, 10, 8)
+		if err != nil || threads == 0 {
+			log.Fatalf("Invalid PASSWORD_ARGON2_THREADS: %q", v)
+		}
+		passwordHasher.Argon2.Threads = uint8(threads)
+	}
+
+	oidcProviders := make(map[string]*oidc.Provider)
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		cfg := oidc.Config{
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+		}
+		if cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+			log.Fatalf("OIDC provider %q needs %sISSUER, %sCLIENT_ID and %sREDIRECT_URL", name, prefix, prefix, prefix)
+		}
+
+		discoveryCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		provider, err := oidc.Discover(discoveryCtx, name, cfg, nil)
+		cancel()
+		if err != nil {
+			log.Fatalf("Failed to set up OIDC provider %q: %v", name, err)
+		}
+		oidcProviders[name] = provider
+	}
+
+	// Without a secret, cursors are signed with a random key and stop
+	// working when the server restarts or on another instance.
+	var cursorSigner *pagination.Signer
+	if v := os.Getenv("CURSOR_SECRET"); v != "" {
+		if len(v) < 32 {
+			log.Fatalf("CURSOR_SECRET must be at least 32 characters")
+		}
+		cursorSigner = pagination.NewSigner([]byte(v))
+	} else {
+		log.Println("CURSOR_SECRET is not set; pagination cursors will not survive a restart")
 	}
 
 	userHandler := &handlers.UserHandler{
-		DB:        dbPool,
-		JWTSecret: []byte(jwtSecret),
+		DB:             dbPool,
+		Keys:           signingKeys,
+		Notifier:       userNotifier,
+		LoginPolicy:    loginPolicy,
+		OIDCProviders:  oidcProviders,
+		MagicLinkURL:   os.Getenv("MAGIC_LINK_URL"),
+		PasswordPolicy: &passwordPolicy,
+		PasswordHasher: &passwordHasher,
+		Cursors:        cursorSigner,
+	}
+
+	erasureInterval := time.Hour
+	if v := os.Getenv("ERASURE_JOB_INTERVAL"); v != "" {
+		erasureInterval, err = time.ParseDuration(v)
+		if err != nil || erasureInterval <= 0 {
+			log.Fatalf("Invalid ERASURE_JOB_INTERVAL: %q", v)
+		}
+	}
+	userHandler.StartErasureJob(rotationCtx, erasureInterval)
+
+	var imageStorage storage.Storage
+	var localMediaDir string
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", "local":
+		localMediaDir = os.Getenv("STORAGE_LOCAL_DIR")
+		if localMediaDir == "" {
+			localMediaDir = "uploads"
+		}
+		imageStorage = &storage.LocalStorage{Dir: localMediaDir, BaseURL: "/media"}
+	case "s3":
+		s3Storage := &storage.S3Storage{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PublicURL:       os.Getenv("S3_PUBLIC_URL"),
+		}
+		if s3Storage.Region == "" {
+			s3Storage.Region = "us-east-1"
+		}
+		if s3Storage.Endpoint == "" || s3Storage.Bucket == "" || s3Storage.AccessKeyID == "" || s3Storage.SecretAccessKey == "" {
+			log.Fatalf("S3 storage requires S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY")
+		}
+		imageStorage = s3Storage
+	default:
+		log.Fatalf("Invalid STORAGE_BACKEND: %q", backend)
+	}
+
+	var maxImageBytes int64
+	if v := os.Getenv("PRODUCT_IMAGE_MAX_BYTES"); v != "" {
+		maxImageBytes, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || maxImageBytes <= 0 {
+			log.Fatalf("Invalid PRODUCT_IMAGE_MAX_BYTES: %q", v)
+		}
 	}
 
 	productHandler := &handlers.ProductHandler{
+		DB:            dbPool,
+		Cursors:       cursorSigner,
+		Storage:       imageStorage,
+		MaxImageBytes: maxImageBytes,
+	}
+
+	importInterval := time.Minute
+	if v := os.Getenv("PRODUCT_IMPORT_INTERVAL"); v != "" {
+		importInterval, err = time.ParseDuration(v)
+		if err != nil || importInterval <= 0 {
+			log.Fatalf("Invalid PRODUCT_IMPORT_INTERVAL: %q", v)
+		}
+	}
+	productHandler.StartProductImportJob(rotationCtx, importInterval)
+
+	categoryHandler := &handlers.CategoryHandler{
 		DB: dbPool,
 	}
 
@@ -50,35 +277,163 @@ func main() {
 	}
 
 	orderHandler := &handlers.OrderHandler{
+		DB:                   dbPool,
+		RequireVerifiedEmail: os.Getenv("CHECKOUT_REQUIRES_VERIFIED_EMAIL") != "false",
+		Cursors:              cursorSigner,
+	}
+
+	roleHandler := &handlers.RoleHandler{
+		DB: dbPool,
+	}
+
+	apiKeyHandler := &handlers.APIKeyHandler{
 		DB: dbPool,
 	}
 
+	requireAdmin2FA := os.Getenv("REQUIRE_ADMIN_2FA") == "true"
+
 	r := chi.NewRouter()
 
+	r.Get("/.well-known/jwks.json", signingKeys.JWKSHandler)
+
+	// Locally stored images are served directly. Directory listings are
+	// refused so the layout of the store can't be browsed.
+	if localMediaDir != "" {
+		files := http.StripPrefix("/media/", http.FileServer(http.Dir(localMediaDir)))
+		r.Get("/media/*", func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, "/") {
+				http.NotFound(w, r)
+				return
+			}
+			files.ServeHTTP(w, r)
+		})
+	}
+
 	r.Route("/api/v1", func(r chi.Router) {
 		r.Post("/users/register", userHandler.RegisterUserHandler)
 		r.Post("/users/login", userHandler.LoginUserHandler)
+		r.Post("/users/login/2fa", userHandler.TwoFactorLoginHandler)
+		r.Post("/users/login/magic-link/request", userHandler.RequestMagicLinkHandler)
+		r.Post("/users/login/magic-link", userHandler.MagicLinkLoginHandler)
+		r.Post("/users/refresh", userHandler.RefreshTokenHandler)
+		r.Post("/users/password-reset/request", userHandler.RequestPasswordResetHandler)
+		r.Post("/users/password-reset/confirm", userHandler.ConfirmPasswordResetHandler)
+		r.Post("/users/verify", userHandler.VerifyEmailHandler)
+		r.Get("/users/oidc/{provider}/start", userHandler.StartOIDCLoginHandler)
+		r.Get("/users/oidc/{provider}/callback", userHandler.OIDCCallbackHandler)
 		r.Get("/products", productHandler.GetProductsHandler)
+		r.Get("/products/suggest", productHandler.SuggestProductsHandler)
 		r.Get("/products/{id}", productHandler.GetProductHandler)
+		r.Get("/categories", categoryHandler.GetCategoryTreeHandler)
+		r.Get("/categories/{id}", categoryHandler.GetCategoryHandler)
 
 		r.Group(func(r chi.Router) {
-			r.Use(middleware.AuthMiddleware([]byte(jwtSecret)))
+			r.Use(middleware.AuthMiddleware(signingKeys, dbPool))
+
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.RequireSession)
+
+				r.Get("/users/me", userHandler.GetProfileHandler)
+
+				r.Post("/cart", cartHandler.AddToCartHandler)
+				r.Get("/cart", cartHandler.GetCartHandler)
+				r.Delete("/cart/{product_id}", cartHandler.RemoveFromCartHandler)
+
+				r.Get("/orders", orderHandler.GetOrderHistoryHandler)
 
-			r.Post("/cart", cartHandler.AddToCartHandler)
-			r.Get("/cart", cartHandler.GetCartHandler)
-			r.Delete("/cart/{product_id}", cartHandler.RemoveFromCartHandler)
+				r.Group(func(r chi.Router) {
+					r.Use(middleware.DenyImpersonation)
 
-			r.Post("/checkout", orderHandler.CheckoutHandler)
-			r.Get("/orders", orderHandler.GetOrderHistoryHandler)
+					r.Post("/users/logout", userHandler.LogoutHandler)
+					r.Patch("/users/me", userHandler.UpdateProfileHandler)
+					r.Delete("/users/me", userHandler.DeleteAccountHandler)
+					r.Put("/users/me/password", userHandler.ChangePasswordHandler)
+					r.Put("/users/me/email", userHandler.ChangeEmailHandler)
+					r.Get("/users/me/export", userHandler.ExportDataHandler)
+					r.Post("/users/verify/resend", userHandler.ResendVerificationHandler)
+					r.Post("/users/2fa/enroll", userHandler.EnrollTwoFactorHandler)
+					r.Post("/users/2fa/confirm", userHandler.ConfirmTwoFactorHandler)
+					r.Post("/users/2fa/disable", userHandler.DisableTwoFactorHandler)
+
+					r.Post("/checkout", orderHandler.CheckoutHandler)
+				})
+			})
 
 			r.Group(func(r chi.Router) {
-				r.Use(middleware.AdminOnlyMiddleware)
+				if requireAdmin2FA {
+					r.Use(middleware.RequireTwoFactor)
+				}
+
+				r.Group(func(r chi.Router) {
+					r.Use(middleware.RequirePermission("products:write"))
+
+					r.Post("/products", productHandler.CreateProductHandler)
+					r.Put("/products/{id}", productHandler.UpdateProductHandler)
+					r.Delete("/products/{id}", productHandler.DeleteProductHandler)
+					r.Post("/products/{id}/restore", productHandler.RestoreProductHandler)
+					r.Post("/products/{id}/stock-adjustments", productHandler.AdjustStockHandler)
+					r.Get("/products/{id}/stock-movements", productHandler.GetStockMovementsHandler)
+					r.Get("/admin/products", productHandler.AdminListProductsHandler)
+					r.Get("/admin/products/{id}", productHandler.AdminGetProductHandler)
+					r.Get("/admin/products/export", productHandler.ExportProductsHandler)
+					r.Post("/admin/products/imports", productHandler.ImportProductsHandler)
+					r.Get("/admin/products/imports/{id}", productHandler.GetProductImportHandler)
+
+					r.Post("/products/{id}/variants", productHandler.CreateProductVariantHandler)
+					r.Put("/products/{id}/variants/{variant_id}", productHandler.UpdateProductVariantHandler)
+					r.Delete("/products/{id}/variants/{variant_id}", productHandler.DeleteProductVariantHandler)
+
+					r.Post("/products/{id}/images", productHandler.UploadProductImageHandler)
+					r.Put("/products/{id}/images/order", productHandler.ReorderProductImagesHandler)
+					r.Delete("/products/{id}/images/{image_id}", productHandler.DeleteProductImageHandler)
+				})
+
+				r.Group(func(r chi.Router) {
+					r.Use(middleware.RequirePermission("categories:write"))
+
+					r.Post("/categories", categoryHandler.CreateCategoryHandler)
+					r.Put("/categories/{id}", categoryHandler.UpdateCategoryHandler)
+					r.Delete("/categories/{id}", categoryHandler.DeleteCategoryHandler)
+				})
+
+				r.With(middleware.RequirePermission("orders:status")).Put("/orders/{id}/status", orderHandler.UpdateOrderStatusHandler)
+
+				r.With(middleware.RequirePermission("roles:read")).Get("/admin/roles", roleHandler.GetRolesHandler)
+				r.With(middleware.RequirePermission("roles:assign")).Put("/admin/users/{id}/role", roleHandler.AssignRoleHandler)
+				r.With(middleware.RequirePermission("users:unlock")).Post("/admin/users/{id}/unlock", userHandler.UnlockUserHandler)
+
+				r.Group(func(r chi.Router) {
+					r.Use(middleware.RequireSession)
+					r.Use(middleware.RequirePermission("api_keys:manage"))
+
+					r.Post("/admin/api-keys", apiKeyHandler.CreateAPIKeyHandler)
+					r.Get("/admin/api-keys", apiKeyHandler.ListAPIKeysHandler)
+					r.Delete("/admin/api-keys/{id}", apiKeyHandler.RevokeAPIKeyHandler)
+				})
+
+				r.Group(func(r chi.Router) {
+					r.Use(middleware.RequirePermission("users:read"))
+
+					r.Get("/admin/users", userHandler.ListUsersHandler)
+					r.Get("/admin/users/{id}", userHandler.GetUserHandler)
+				})
+
+				r.Group(func(r chi.Router) {
+					r.Use(middleware.RequirePermission("users:manage"))
+
+					r.Post("/admin/users/{id}/suspend", userHandler.SuspendUserHandler)
+					r.Post("/admin/users/{id}/reactivate", userHandler.ReactivateUserHandler)
+					r.Post("/admin/users/{id}/force-password-reset", userHandler.ForcePasswordResetHandler)
+				})
+
+				r.With(middleware.RequirePermission("users:erase")).Post("/admin/users/{id}/erasure", userHandler.RequestErasureHandler)
 
-				r.Post("/products", productHandler.CreateProductHandler)
-				r.Put("/products/{id}", productHandler.UpdateProductHandler)
-				r.Delete("/products/{id}", productHandler.DeleteProductHandler)
+				r.Group(func(r chi.Router) {
+					r.Use(middleware.RequireSession)
+					r.Use(middleware.RequirePermission("users:impersonate"))
 
-				r.Put("/orders/{id}/status", orderHandler.UpdateOrderStatusHandler)
+					r.Post("/admin/users/{id}/impersonate", userHandler.ImpersonateUserHandler)
+				})
 			})
 		})
 	})
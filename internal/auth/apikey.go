@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// APIKeyHeader is the request header integrations send their key in.
+const APIKeyHeader = "X-API-Key"
+
+const (
+	apiKeyPrefix       = "ak_"
+	apiKeyPrefixLength = len(apiKeyPrefix) + 8
+)
+
+// GenerateAPIKey returns a new random API key along with the short prefix
+// that is stored in the clear so admins can tell keys apart.
+func GenerateAPIKey() (key, prefix string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	key = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return key, key[:apiKeyPrefixLength], nil
+}
+
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeIPAllowlist parses entries as either single addresses or CIDR
+// ranges and returns them in canonical prefix form.
+func NormalizeIPAllowlist(entries []string) ([]string, error) {
+	normalized := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			normalized = append(normalized, prefix.Masked().String())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP address or range %q", entry)
+		}
+		addr = addr.Unmap()
+		normalized = append(normalized, netip.PrefixFrom(addr, addr.BitLen()).String())
+	}
+	return normalized, nil
+}
+
+// IPAllowed reports whether ip falls within the allowlist. An empty
+// allowlist allows every address.
+func IPAllowed(allowlist []string, ip string) bool {
+	if len(allowlist) == 0 {
+		return true
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, entry := range allowlist {
+		prefix, err := netip.ParsePrefix(entry)
+		if err == nil && prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
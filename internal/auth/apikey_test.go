@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, prefix, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	if !strings.HasPrefix(key, prefix) {
+		t.Errorf("Expected key %q to start with prefix %q", key, prefix)
+	}
+
+	other, _, _ := GenerateAPIKey()
+	if key == other {
+		t.Errorf("Expected two generated keys to differ")
+	}
+}
+
+func TestNormalizeIPAllowlist(t *testing.T) {
+	got, err := NormalizeIPAllowlist([]string{"10.0.0.5", " 192.168.1.77/24 ", "2001:db8::1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := []string{"10.0.0.5/32", "192.168.1.0/24", "2001:db8::1/128"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Entry %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	if _, err := NormalizeIPAllowlist([]string{"not-an-ip"}); err == nil {
+		t.Errorf("Expected an error for an invalid entry")
+	}
+}
+
+func TestIPAllowed(t *testing.T) {
+	allowlist := []string{"10.0.0.0/8", "203.0.113.7/32"}
+
+	tests := map[string]bool{
+		"10.1.2.3":         true,
+		"203.0.113.7":      true,
+		"::ffff:10.9.9.9":  true,
+		"203.0.113.8":      false,
+		"192.168.0.1":      false,
+		"not-an-ip-at-all": false,
+	}
+
+	for ip, want := range tests {
+		if got := IPAllowed(allowlist, ip); got != want {
+			t.Errorf("IPAllowed(%q) = %v, want %v", ip, got, want)
+		}
+	}
+
+	if !IPAllowed(nil, "192.168.0.1") {
+		t.Errorf("Expected an empty allowlist to allow every address")
+	}
+}
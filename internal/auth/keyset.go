@@ -0,0 +1,499 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	privateKeyExt = ".key"
+	publicKeyExt  = ".pub"
+)
+
+const (
+	// jwksMaxAge is how long clients may cache the JWKS.
+	jwksMaxAge = 5 * time.Minute
+	// reloadInterval is how often StartRotation picks up keys written by
+	// other instances.
+	reloadInterval = time.Minute
+	// publishDelay is how long a new key is only published before it signs
+	// tokens, so that every instance and every cached JWKS knows it first.
+	publishDelay = jwksMaxAge + reloadInterval
+	// missReloadInterval limits how often a token with an unknown kid makes
+	// Keyfunc reload the directory.
+	missReloadInterval = 10 * time.Second
+)
+
+var ValidMethods = []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}
+
+type Key struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+	CreatedAt  time.Time
+}
+
+// KeySet holds the keys used to sign and verify access tokens. Keys live in
+// a directory as PEM files named after their key ID: "<kid>.key" holds a
+// PKCS#8 private key and "<kid>.pub" a PKIX public key for tokens that are
+// only verified here. The newest private key signs new tokens once it has
+// been published for publishDelay; until then it is only used to verify.
+type KeySet struct {
+	dir          string
+	alg          string
+	publishDelay time.Duration
+
+	mu      sync.RWMutex
+	keys    map[string]*Key
+	current *Key
+	// next is a key newer than current that is published but doesn't sign
+	// yet.
+	next *Key
+	// lastMissReload is when Keyfunc last reloaded for an unknown kid.
+	lastMissReload time.Time
+}
+
+// LoadKeySet reads every key in dir, generating a first signing key with alg
+// ("RS256" or "EdDSA") when the directory holds none.
+func LoadKeySet(dir, alg string) (*KeySet, error) {
+	if alg != jwt.SigningMethodRS256.Alg() && alg != jwt.SigningMethodEdDSA.Alg() {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	ks := &KeySet{dir: dir, alg: alg, publishDelay: publishDelay}
+	if err := ks.Reload(); err != nil {
+		return nil, err
+	}
+
+	if ks.current == nil {
+		if err := ks.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return ks, nil
+}
+
+func (ks *KeySet) Reload() error {
+	entries, err := os.ReadDir(ks.dir)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*Key)
+	var current, next *Key
+	publishedBy := time.Now().Add(-ks.publishDelay)
+
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != privateKeyExt && ext != publicKeyExt) {
+			continue
+		}
+
+		key, err := readKey(filepath.Join(ks.dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("loading key %s: %w", entry.Name(), err)
+		}
+
+		if existing, ok := keys[key.ID]; ok && existing.PrivateKey != nil {
+			continue
+		}
+		keys[key.ID] = key
+
+		if key.PrivateKey == nil {
+			continue
+		}
+		if key.CreatedAt.After(publishedBy) {
+			if newerKey(key, next) {
+				next = key
+			}
+		} else if newerKey(key, current) {
+			current = key
+		}
+	}
+
+	// With no published key yet, as on first start, the newest key signs
+	// straight away; there are no tokens or caches for it to disagree with.
+	if current == nil {
+		current, next = next, nil
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.current = current
+	ks.next = next
+	ks.mu.Unlock()
+
+	return nil
+}
+
+// Rotate generates a new signing key. It is published straight away but
+// only signs once it has been published for publishDelay, unless there is no
+// other key to sign with. Older keys stay available for verification until
+// they are pruned.
+func (ks *KeySet) Rotate() error {
+	var signer crypto.Signer
+	var err error
+
+	switch ks.alg {
+	case jwt.SigningMethodRS256.Alg():
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	kid := now.Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix)
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := writeFileAtomic(filepath.Join(ks.dir, kid+privateKeyExt), data); err != nil {
+		return err
+	}
+
+	key := &Key{
+		ID:         kid,
+		Method:     methodFor(signer.Public()),
+		PrivateKey: signer,
+		PublicKey:  signer.Public(),
+		CreatedAt:  now,
+	}
+
+	ks.mu.Lock()
+	if ks.keys == nil {
+		ks.keys = make(map[string]*Key)
+	}
+	ks.keys[kid] = key
+	if ks.current == nil {
+		ks.current = key
+	} else {
+		ks.next = key
+	}
+	ks.mu.Unlock()
+
+	return nil
+}
+
+// Prune deletes keys older than maxAge, never removing the current or next
+// one.
+func (ks *KeySet) Prune(maxAge time.Duration) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	cutoff := time.Now().Add(-maxAge)
+	for kid, key := range ks.keys {
+		if key == ks.current || key == ks.next || key.CreatedAt.After(cutoff) {
+			continue
+		}
+
+		for _, ext := range []string{privateKeyExt, publicKeyExt} {
+			err := os.Remove(filepath.Join(ks.dir, kid+ext))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		delete(ks.keys, kid)
+	}
+
+	return nil
+}
+
+// StartRotation rotates the signing key once the newest key is older than
+// interval and prunes keys older than maxAge, checking every reloadInterval
+// until ctx is done.
+// Keys written by other instances sharing the directory are picked up on
+// each check.
+func (ks *KeySet) StartRotation(ctx context.Context, interval, maxAge time.Duration) {
+	ticker := time.NewTicker(reloadInterval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := ks.Reload(); err != nil {
+					log.Printf("Failed to reload signing keys: %v", err)
+					continue
+				}
+
+				ks.mu.RLock()
+				newest := ks.current
+				if ks.next != nil {
+					newest = ks.next
+				}
+				ks.mu.RUnlock()
+
+				if newest == nil || time.Since(newest.CreatedAt) >= interval {
+					if err := ks.Rotate(); err != nil {
+						log.Printf("Failed to rotate signing key: %v", err)
+						continue
+					}
+					log.Println("Rotated JWT signing key")
+				}
+
+				if err := ks.Prune(maxAge); err != nil {
+					log.Printf("Failed to prune signing keys: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// signingKey returns the key that signs new tokens, switching to the next
+// key once it has been published for long enough.
+func (ks *KeySet) signingKey() *Key {
+	ks.mu.RLock()
+	current, next := ks.current, ks.next
+	ks.mu.RUnlock()
+
+	if next == nil || time.Since(next.CreatedAt) < ks.publishDelay {
+		return current
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.next == next {
+		ks.current, ks.next = next, nil
+	}
+	return ks.current
+}
+
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	key := ks.signingKey()
+
+	if key == nil {
+		return "", errors.New("no signing key available")
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.PrivateKey)
+}
+
+// Keyfunc resolves the verification key for a token from its kid header, for
+// use with jwt.Parse. An unknown kid may belong to a key another instance
+// has just written, so it triggers a reload, at most once every
+// missReloadInterval.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no kid header")
+	}
+
+	ks.mu.RLock()
+	key, ok := ks.keys[kid]
+	ks.mu.RUnlock()
+
+	if !ok && ks.reloadForMiss() {
+		ks.mu.RLock()
+		key, ok = ks.keys[kid]
+		ks.mu.RUnlock()
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.PublicKey, nil
+}
+
+// reloadForMiss reloads the key directory unless that was already done
+// within missReloadInterval, and reports whether it reloaded.
+func (ks *KeySet) reloadForMiss() bool {
+	ks.mu.Lock()
+	if time.Since(ks.lastMissReload) < missReloadInterval {
+		ks.mu.Unlock()
+		return false
+	}
+	ks.lastMissReload = time.Now()
+	ks.mu.Unlock()
+
+	if err := ks.Reload(); err != nil {
+		log.Printf("Failed to reload signing keys: %v", err)
+		return false
+	}
+	return true
+}
+
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (ks *KeySet) JWKS() JWKSet {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	set := JWKSet{Keys: make([]JWK, 0, len(ks.keys))}
+	for _, key := range ks.keys {
+		jwk := JWK{KeyID: key.ID, Use: "sig", Algorithm: key.Method.Alg()}
+
+		switch pub := key.PublicKey.(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		default:
+			continue
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
+
+func (ks *KeySet) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(jwksMaxAge.Seconds())))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ks.JWKS())
+}
+
+// newerKey reports whether key is newer than other, breaking ties by key ID
+// so every instance agrees.
+func newerKey(key, other *Key) bool {
+	return other == nil || key.CreatedAt.After(other.CreatedAt) ||
+		(key.CreatedAt.Equal(other.CreatedAt) && key.ID > other.ID)
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it into place, so Reload never reads a partly written key. The temporary
+// name doesn't end in a key extension, so Reload skips it.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+func readKey(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{
+		ID:        strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		CreatedAt: info.ModTime(),
+	}
+
+	if filepath.Ext(path) == privateKeyExt {
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("private key cannot sign")
+		}
+		key.PrivateKey = signer
+		key.PublicKey = signer.Public()
+	} else {
+		key.PublicKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	key.Method = methodFor(key.PublicKey)
+	if key.Method == nil {
+		return nil, errors.New("unsupported key type")
+	}
+
+	return key, nil
+}
+
+func methodFor(pub crypto.PublicKey) jwt.SigningMethod {
+	switch pub.(type) {
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func signAndVerify(t *testing.T, signer, verifier *KeySet) error {
+	t.Helper()
+
+	tokenString, err := signer.Sign(&jwt.RegisteredClaims{
+		Subject:   "user-123",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	})
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+
+	_, err = jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, verifier.Keyfunc, jwt.WithValidMethods(ValidMethods))
+	return err
+}
+
+func TestKeySet_SignAndVerify(t *testing.T) {
+	for _, alg := range []string{"EdDSA", "RS256"} {
+		t.Run(alg, func(t *testing.T) {
+			ks, err := LoadKeySet(t.TempDir(), alg)
+			if err != nil {
+				t.Fatalf("Failed to load key set: %v", err)
+			}
+
+			if err := signAndVerify(t, ks, ks); err != nil {
+				t.Errorf("Expected token to verify, got %v", err)
+			}
+		})
+	}
+}
+
+func TestKeySet_RotationKeepsOldKeysVerifiable(t *testing.T) {
+	dir := t.TempDir()
+
+	ks, err := LoadKeySet(dir, "EdDSA")
+	if err != nil {
+		t.Fatalf("Failed to load key set: %v", err)
+	}
+
+	oldToken, err := ks.Sign(&jwt.RegisteredClaims{Subject: "user-123"})
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+
+	if err := ks.Rotate(); err != nil {
+		t.Fatalf("Failed to rotate: %v", err)
+	}
+
+	if _, err := jwt.Parse(oldToken, ks.Keyfunc, jwt.WithValidMethods(ValidMethods)); err != nil {
+		t.Errorf("Expected token signed before rotation to verify, got %v", err)
+	}
+
+	if got := len(ks.JWKS().Keys); got != 2 {
+		t.Errorf("Expected 2 keys in JWKS after rotation, got %d", got)
+	}
+
+	reloaded, err := LoadKeySet(dir, "EdDSA")
+	if err != nil {
+		t.Fatalf("Failed to reload key set: %v", err)
+	}
+	if err := signAndVerify(t, reloaded, ks); err != nil {
+		t.Errorf("Expected a second instance sharing the key directory to sign verifiable tokens, got %v", err)
+	}
+}
+
+func TestKeySet_RejectsHMACTokens(t *testing.T) {
+	ks, err := LoadKeySet(t.TempDir(), "EdDSA")
+	if err != nil {
+		t.Fatalf("Failed to load key set: %v", err)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.RegisteredClaims{Subject: "user-123"})
+	token.Header["kid"] = ks.current.ID
+	tokenString, err := token.SignedString([]byte("guessed-secret"))
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+
+	if _, err := jwt.Parse(tokenString, ks.Keyfunc, jwt.WithValidMethods(ValidMethods)); err == nil {
+		t.Errorf("Expected HS256 token to be rejected")
+	}
+}
+
+func TestKeySet_NewKeySignsOnlyOncePublished(t *testing.T) {
+	ks, err := LoadKeySet(t.TempDir(), "EdDSA")
+	if err != nil {
+		t.Fatalf("Failed to load key set: %v", err)
+	}
+	first := ks.current.ID
+
+	if err := ks.Rotate(); err != nil {
+		t.Fatalf("Failed to rotate: %v", err)
+	}
+	if got := ks.signingKey().ID; got != first {
+		t.Errorf("Expected the old key to keep signing while the new one is published, got %s", got)
+	}
+	if got := len(ks.JWKS().Keys); got != 2 {
+		t.Errorf("Expected the new key to be published straight away, got %d keys", got)
+	}
+
+	ks.publishDelay = 0
+	if got := ks.signingKey().ID; got == first {
+		t.Errorf("Expected the new key to sign once published for long enough")
+	}
+}
+
+func TestKeySet_ReloadsForUnknownKeyID(t *testing.T) {
+	dir := t.TempDir()
+
+	verifier, err := LoadKeySet(dir, "EdDSA")
+	if err != nil {
+		t.Fatalf("Failed to load key set: %v", err)
+	}
+	signer, err := LoadKeySet(dir, "EdDSA")
+	if err != nil {
+		t.Fatalf("Failed to load second key set: %v", err)
+	}
+
+	signer.publishDelay = 0
+	if err := signer.Rotate(); err != nil {
+		t.Fatalf("Failed to rotate: %v", err)
+	}
+
+	if err := signAndVerify(t, signer, verifier); err != nil {
+		t.Errorf("Expected a key written by another instance to be picked up, got %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+CREATE TABLE roles (
+    name VARCHAR(50) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE permissions (
+    name VARCHAR(100) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE role_permissions (
+    role VARCHAR(50) NOT NULL REFERENCES roles(name) ON UPDATE CASCADE ON DELETE CASCADE,
+    permission VARCHAR(100) NOT NULL REFERENCES permissions(name) ON UPDATE CASCADE ON DELETE CASCADE,
+    PRIMARY KEY (role, permission)
+);
+
+INSERT INTO roles (name, description) VALUES
+    ('customer', 'Storefront customer'),
+    ('admin', 'Full administrative access'),
+    ('catalog_manager', 'Manages the product catalog'),
+    ('fulfillment', 'Processes and ships orders'),
+    ('support', 'Assists customers with their accounts');
+
+INSERT INTO permissions (name, description) VALUES
+    ('products:write', 'Create, update and delete products'),
+    ('orders:status', 'Change the status of orders'),
+    ('roles:read', 'List roles and their permissions'),
+    ('roles:assign', 'Assign roles to users');
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'products:write'),
+    ('admin', 'orders:status'),
+    ('admin', 'roles:read'),
+    ('admin', 'roles:assign'),
+    ('catalog_manager', 'products:write'),
+    ('fulfillment', 'orders:status'),
+    ('support', 'roles:read');
+
+-- Any free-form role that isn't one of the above falls back to customer.
+UPDATE users SET role = 'customer' WHERE role IS NULL OR role NOT IN (SELECT name FROM roles);
+
+ALTER TABLE users
+    ALTER COLUMN role SET NOT NULL,
+    ADD CONSTRAINT fk_users_role FOREIGN KEY (role) REFERENCES roles(name) ON UPDATE CASCADE;
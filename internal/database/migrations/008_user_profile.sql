@@ -0,0 +1,8 @@
+ALTER TABLE users
+    ADD COLUMN full_name VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN phone VARCHAR(50) NOT NULL DEFAULT '',
+    ADD COLUMN deleted_at TIMESTAMPTZ;
+
+-- A token with an email verifies a change to that address; without one it
+-- verifies the user's current address.
+ALTER TABLE email_verification_tokens ADD COLUMN email VARCHAR(255);
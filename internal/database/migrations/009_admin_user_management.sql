@@ -0,0 +1,10 @@
+ALTER TABLE users ADD COLUMN suspended_at TIMESTAMPTZ;
+
+INSERT INTO permissions (name, description) VALUES
+    ('users:read', 'List and view customer accounts'),
+    ('users:manage', 'Suspend, reactivate and force password resets on accounts');
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'users:read'),
+    ('admin', 'users:manage'),
+    ('support', 'users:read');
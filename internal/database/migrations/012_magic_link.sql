@@ -0,0 +1,15 @@
+-- Passwordless login is only for customers; staff accounts must sign in
+-- with a password.
+ALTER TABLE roles ADD COLUMN magic_link_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE roles SET magic_link_enabled = TRUE WHERE name = 'customer';
+
+CREATE TABLE magic_link_tokens (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_magic_link_tokens_user_id ON magic_link_tokens(user_id);
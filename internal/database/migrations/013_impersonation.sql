@@ -0,0 +1,8 @@
+CREATE INDEX idx_audit_logs_actor_id ON audit_logs(actor_id);
+
+INSERT INTO permissions (name, description) VALUES
+    ('users:impersonate', 'Act as a customer to see what they see');
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'users:impersonate'),
+    ('support', 'users:impersonate');
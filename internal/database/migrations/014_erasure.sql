@@ -0,0 +1,19 @@
+CREATE TABLE erasure_requests (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    -- Set to NULL once an account without orders is deleted outright.
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    requested_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    requested_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMPTZ,
+    last_error TEXT
+);
+
+-- At most one pending request per account.
+CREATE UNIQUE INDEX idx_erasure_requests_pending ON erasure_requests(user_id) WHERE completed_at IS NULL;
+
+INSERT INTO permissions (name, description) VALUES
+    ('users:erase', 'Erase customer accounts on request');
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'users:erase');
@@ -0,0 +1,29 @@
+CREATE TABLE product_variants (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    sku VARCHAR(64) NOT NULL UNIQUE,
+    -- Option values such as {"size": "M", "color": "red"}.
+    options JSONB NOT NULL DEFAULT '{}',
+    price INT NOT NULL CHECK (price > 0),
+    stock_quantity INT NOT NULL DEFAULT 0 CHECK (stock_quantity >= 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (product_id, options)
+);
+CREATE TRIGGER set_timestamp_product_variants BEFORE UPDATE ON product_variants FOR EACH ROW EXECUTE PROCEDURE trigger_set_timestamp();
+
+CREATE INDEX idx_product_variants_product_id ON product_variants(product_id);
+
+-- A product with variants is bought by variant; one without is bought as
+-- before with variant_id left NULL.
+ALTER TABLE cart_items
+    ADD COLUMN variant_id UUID REFERENCES product_variants(id) ON DELETE CASCADE,
+    DROP CONSTRAINT cart_items_user_id_product_id_key;
+
+CREATE UNIQUE INDEX idx_cart_items_user_product ON cart_items(user_id, product_id) WHERE variant_id IS NULL;
+CREATE UNIQUE INDEX idx_cart_items_user_variant ON cart_items(user_id, variant_id) WHERE variant_id IS NOT NULL;
+
+-- sku is copied at purchase so order history survives SKU changes.
+ALTER TABLE order_items
+    ADD COLUMN variant_id UUID REFERENCES product_variants(id) ON DELETE RESTRICT,
+    ADD COLUMN sku VARCHAR(64);
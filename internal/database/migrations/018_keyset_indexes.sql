@@ -0,0 +1,4 @@
+-- Keyset pagination walks these lists newest first by (created_at, id).
+CREATE INDEX idx_products_created_at_id ON products(created_at DESC, id DESC);
+CREATE INDEX idx_orders_user_created_at_id ON orders(user_id, created_at DESC, id DESC);
+CREATE INDEX idx_users_created_at_id ON users(created_at DESC, id DESC);
@@ -0,0 +1,18 @@
+CREATE TABLE product_images (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    -- An image can show one particular variant, e.g. the red T-shirt.
+    variant_id UUID REFERENCES product_variants(id) ON DELETE SET NULL,
+    original_key TEXT NOT NULL,
+    -- Storage keys of the resized copies by size name, e.g. {"small": "..."}.
+    thumbnail_keys JSONB NOT NULL DEFAULT '{}',
+    content_type VARCHAR(50) NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    size_bytes INT NOT NULL,
+    alt_text VARCHAR(255) NOT NULL DEFAULT '',
+    position INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_product_images_product_id ON product_images(product_id, position);
@@ -0,0 +1,10 @@
+-- Products are archived rather than deleted, since order_items keeps
+-- referencing them. Drafts and archived products are hidden from the
+-- storefront; deleted_at records when a product was archived.
+ALTER TABLE products
+    ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('draft', 'active', 'archived')),
+    ADD COLUMN deleted_at TIMESTAMPTZ,
+    ADD CONSTRAINT products_archived_deleted_at CHECK ((status = 'archived') = (deleted_at IS NOT NULL));
+
+-- The storefront only ever lists active products.
+CREATE INDEX idx_products_active_created_at_id ON products(created_at DESC, id DESC) WHERE status = 'active';
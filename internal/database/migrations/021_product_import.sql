@@ -0,0 +1,35 @@
+-- Bulk imports match existing products by SKU. Products created through
+-- the API may leave it out.
+ALTER TABLE products ADD COLUMN sku VARCHAR(64) UNIQUE;
+
+CREATE TABLE product_import_jobs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    format VARCHAR(10) NOT NULL CHECK (format IN ('csv', 'ndjson')),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+    -- The uploaded file, dropped once the job finishes.
+    payload BYTEA,
+    total_rows INT NOT NULL DEFAULT 0,
+    -- Rows are committed in batches together with these counters, so an
+    -- interrupted job resumes after the last committed row.
+    processed_rows INT NOT NULL DEFAULT 0,
+    created_rows INT NOT NULL DEFAULT 0,
+    updated_rows INT NOT NULL DEFAULT 0,
+    failed_rows INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ
+);
+CREATE TRIGGER set_timestamp_product_import_jobs BEFORE UPDATE ON product_import_jobs FOR EACH ROW EXECUTE PROCEDURE trigger_set_timestamp();
+
+CREATE INDEX idx_product_import_jobs_unfinished ON product_import_jobs(created_at) WHERE status IN ('pending', 'running');
+
+CREATE TABLE product_import_errors (
+    job_id UUID NOT NULL REFERENCES product_import_jobs(id) ON DELETE CASCADE,
+    row_number INT NOT NULL,
+    sku TEXT NOT NULL DEFAULT '',
+    message TEXT NOT NULL,
+    PRIMARY KEY (job_id, row_number)
+);
@@ -0,0 +1,34 @@
+-- Every change to the stock of a product or variant is recorded here with
+-- the balance it left, so the stock can be traced back to its causes.
+-- Movements of a product's own stock have no variant_id.
+CREATE TABLE inventory_movements (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    -- sku is copied so the movements of a deleted variant stay readable.
+    variant_id UUID REFERENCES product_variants(id) ON DELETE SET NULL,
+    sku VARCHAR(64),
+    type VARCHAR(20) NOT NULL CHECK (type IN ('checkout', 'cancellation', 'adjustment', 'import', 'return')),
+    delta INT NOT NULL CHECK (delta <> 0),
+    balance INT NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    order_id UUID REFERENCES orders(id) ON DELETE SET NULL,
+    import_job_id UUID REFERENCES product_import_jobs(id) ON DELETE SET NULL,
+    -- clock_timestamp() rather than NOW() keeps the movements of a single
+    -- transaction, such as a checkout, in the order they were made.
+    created_at TIMESTAMPTZ NOT NULL DEFAULT clock_timestamp()
+);
+
+CREATE INDEX idx_inventory_movements_product ON inventory_movements(product_id, created_at DESC, id DESC);
+
+-- Stock that existed before the ledger is recorded as an opening balance,
+-- so every later movement's starting balance has a cause.
+INSERT INTO inventory_movements (product_id, type, delta, balance, reason)
+SELECT id, 'adjustment', stock_quantity, stock_quantity, 'Opening balance'
+FROM products
+WHERE stock_quantity <> 0;
+
+INSERT INTO inventory_movements (product_id, variant_id, sku, type, delta, balance, reason)
+SELECT product_id, id, sku, 'adjustment', stock_quantity, stock_quantity, 'Opening balance'
+FROM product_variants
+WHERE stock_quantity <> 0;
@@ -0,0 +1,4 @@
+-- Whether the session was opened with a second factor. Sessions opened
+-- before this existed are treated as password-only.
+ALTER TABLE sessions
+    ADD COLUMN two_factor_verified BOOLEAN NOT NULL DEFAULT FALSE;
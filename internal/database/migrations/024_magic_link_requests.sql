@@ -0,0 +1,13 @@
+-- Sign-in link requests are rate-limited on their own, so requesting links
+-- for someone else's email can't lock them out of password login. Rows are
+-- pruned once they are too old to count.
+CREATE TABLE magic_link_requests (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    email VARCHAR(255) NOT NULL,
+    ip_address VARCHAR(45) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_magic_link_requests_email ON magic_link_requests(email, created_at);
+CREATE INDEX idx_magic_link_requests_ip_address ON magic_link_requests(ip_address, created_at);
+CREATE INDEX idx_magic_link_requests_created_at ON magic_link_requests(created_at);
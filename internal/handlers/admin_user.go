@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"ecommerce-api-v2/internal/middleware"
+	"ecommerce-api-v2/internal/models"
+	"ecommerce-api-v2/internal/pagination"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const adminUserColumns = `
+	id, email, full_name, phone, role, email_verified_at, totp_enabled_at IS NOT NULL,
+	locked_until, suspended_at, created_at
+`
+
+func scanAdminUser(row pgx.Row, u *models.AdminUserResponse) error {
+	return row.Scan(
+		&u.ID, &u.Email, &u.FullName, &u.Phone, &u.Role, &u.EmailVerifiedAt, &u.TwoFactorEnabled,
+		&u.LockedUntil, &u.SuspendedAt, &u.CreatedAt,
+	)
+}
+
+func (h *UserHandler) ListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	page := 1
+
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsedLimit, err := strconv.Atoi(l); err == nil && parsedLimit > 0 && parsedLimit <= 100 {
+			limit = parsedLimit
+		}
+	}
+
+	if p := r.URL.Query().Get("page"); p != "" {
+		if parsedPage, err := strconv.Atoi(p); err == nil && parsedPage > 1 {
+			page = parsedPage
+		}
+	}
+
+	// Deleted accounts are only kept around for order history.
+	conditions := []string{"deleted_at IS NULL"}
+	var args []any
+
+	if q := strings.TrimSpace(r.URL.Query().Get("q")); q != "" {
+		args = append(args, "%"+q+"%")
+		conditions = append(conditions, fmt.Sprintf("(email ILIKE $%d OR full_name ILIKE $%d)", len(args), len(args)))
+	}
+
+	if role := r.URL.Query().Get("role"); role != "" {
+		args = append(args, role)
+		conditions = append(conditions, fmt.Sprintf("role = $%d", len(args)))
+	}
+
+	switch r.URL.Query().Get("status") {
+	case "":
+	case "active":
+		conditions = append(conditions, "suspended_at IS NULL AND (locked_until IS NULL OR locked_until <= NOW())")
+	case "suspended":
+		conditions = append(conditions, "suspended_at IS NOT NULL")
+	case "locked":
+		conditions = append(conditions, "locked_until > NOW()")
+	default:
+		http.Error(w, "Invalid status. Allowed values: active, suspended, locked", http.StatusBadRequest)
+		return
+	}
+
+	cursor, ok := parseCursor(w, r, h.Cursors, cursorScopeUsers)
+	if !ok {
+		return
+	}
+	useCursor := r.URL.Query().Get("page") == ""
+
+	where := strings.Join(conditions, " AND ")
+
+	var total int
+	if err := h.DB.QueryRow(r.Context(), `SELECT COUNT(*) FROM users WHERE `+where, args...).Scan(&total); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	var limitClause string
+	if useCursor {
+		if cursor != nil {
+			where += " AND " + cursor.Where("created_at", "id", len(args)+1)
+			args = append(args, cursor.Args()...)
+		}
+		args = append(args, limit+1)
+		limitClause = fmt.Sprintf("LIMIT $%d", len(args))
+	} else {
+		args = append(args, limit, (page-1)*limit)
+		limitClause = fmt.Sprintf("LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM users
+		WHERE %s
+		ORDER BY %s
+		%s
+	`, adminUserColumns, where, pagination.OrderBy(cursor, "created_at", "id"), limitClause)
+
+	rows, err := h.DB.Query(r.Context(), query, args...)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	users := make([]models.AdminUserResponse, 0)
+
+	for rows.Next() {
+		var u models.AdminUserResponse
+		if err := scanAdminUser(rows, &u); err != nil {
+			http.Error(w, "Error reading users", http.StatusInternalServerError)
+			return
+		}
+		users = append(users, u)
+	}
+
+	if rows.Err() != nil {
+		http.Error(w, "Error iterating over users", http.StatusInternalServerError)
+		return
+	}
+
+	resp := models.AdminUserListResponse{Limit: limit, Total: total}
+	if useCursor {
+		resp.Users, resp.NextCursor, resp.PrevCursor = pagination.Paginate(
+			cursorSigner(h.Cursors), cursorScopeUsers, cursor, users, limit,
+			func(u models.AdminUserResponse) (time.Time, uuid.UUID) {
+				return u.CreatedAt, uuid.MustParse(u.ID)
+			},
+		)
+		setPageLinks(w, r, resp.NextCursor, resp.PrevCursor)
+	} else {
+		resp.Users = users
+		resp.Page = page
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *UserHandler) GetUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID format", http.StatusBadRequest)
+		return
+	}
+
+	var u models.AdminUserDetailResponse
+	query := `SELECT ` + adminUserColumns + ` FROM users WHERE id = $1 AND deleted_at IS NULL`
+	if err := scanAdminUser(h.DB.QueryRow(r.Context(), query, userID), &u.AdminUserResponse); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// Cancelled orders were never paid for, so they don't count as spend.
+	statsQuery := `
+		SELECT COUNT(*), COALESCE(SUM(total_amount) FILTER (WHERE status <> 'cancelled'), 0)
+		FROM orders
+		WHERE user_id = $1
+	`
+	if err := h.DB.QueryRow(r.Context(), statsQuery, userID).Scan(&u.OrderCount, &u.LifetimeSpend); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(u)
+}
+
+// setSuspended suspends or reactivates the user named in the URL. Suspending
+// also revokes every session so the user is signed out everywhere at once.
+func (h *UserHandler) setSuspended(w http.ResponseWriter, r *http.Request, suspend bool) {
+	ctxValue := r.Context().Value(middleware.UserContextKey)
+	claims, ok := ctxValue.(middleware.UserClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	actorID, _ := uuid.Parse(claims.UserID)
+
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID format", http.StatusBadRequest)
+		return
+	}
+
+	if suspend && userID == actorID {
+		http.Error(w, "You cannot suspend your own account", http.StatusBadRequest)
+		return
+	}
+
+	action, errMsg, message := auditAccountReactivated, "Could not reactivate user", "User reactivated successfully"
+	query := `UPDATE users SET suspended_at = NULL WHERE id = $1 AND deleted_at IS NULL`
+	if suspend {
+		action, errMsg, message = auditAccountSuspended, "Could not suspend user", "User suspended successfully"
+		query = `UPDATE users SET suspended_at = COALESCE(suspended_at, NOW()) WHERE id = $1 AND deleted_at IS NULL`
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, errMsg, http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	cmdTag, err := tx.Exec(r.Context(), query, userID)
+	if err != nil {
+		http.Error(w, errMsg, http.StatusInternalServerError)
+		return
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if suspend {
+		revokeQuery := `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+		if _, err := tx.Exec(r.Context(), revokeQuery, userID); err != nil {
+			http.Error(w, errMsg, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := recordAudit(r, tx, &actorID, action, userID, nil); err != nil {
+		http.Error(w, errMsg, http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, errMsg, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": message,
+	})
+}
+
+func (h *UserHandler) SuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	h.setSuspended(w, r, true)
+}
+
+func (h *UserHandler) ReactivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	h.setSuspended(w, r, false)
+}
+
+func (h *UserHandler) ForcePasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	ctxValue := r.Context().Value(middleware.UserContextKey)
+	claims, ok := ctxValue.(middleware.UserClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	actorID, _ := uuid.Parse(claims.UserID)
+
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID format", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, "Could not reset password", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	// '!' never matches a password hash, so the old password stops working
+	// until the user picks a new one through the emailed reset token.
+	var email string
+	query := `
+		UPDATE users SET password_hash = '!'
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING email
+	`
+	if err := tx.QueryRow(r.Context(), query, userID).Scan(&email); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Could not reset password", http.StatusInternalServerError)
+		return
+	}
+
+	revokeQuery := `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	if _, err := tx.Exec(r.Context(), revokeQuery, userID); err != nil {
+		http.Error(w, "Could not reset password", http.StatusInternalServerError)
+		return
+	}
+
+	if err := recordAudit(r, tx, &actorID, auditPasswordResetForced, userID, nil); err != nil {
+		http.Error(w, "Could not reset password", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, "Could not reset password", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.sendPasswordReset(r.Context(), userID, email); err != nil {
+		http.Error(w, "Could not create reset token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Password reset forced, the user has been emailed a reset token",
+	})
+}
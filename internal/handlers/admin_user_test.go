@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"ecommerce-api-v2/internal/middleware"
+	"ecommerce-api-v2/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func asAdmin(req *http.Request, adminID uuid.UUID, targetID string) *http.Request {
+	rctx := chi.NewRouteContext()
+	if targetID != "" {
+		rctx.URLParams.Add("id", targetID)
+	}
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+	ctx = context.WithValue(ctx, middleware.UserContextKey, middleware.UserClaims{UserID: adminID.String(), Role: "admin"})
+	return req.WithContext(ctx)
+}
+
+func TestListUsersHandler_SearchAndPaginate(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	handler := &UserHandler{DB: db}
+
+	adminID := uuid.New()
+	db.Exec(context.Background(), `
+		INSERT INTO users (id, email, password_hash, role, full_name)
+		VALUES ($1, 'admin@example.com', 'hash', 'admin', 'Ada Admin'),
+			(gen_random_uuid(), 'jane@example.com', 'hash', 'customer', 'Jane Doe'),
+			(gen_random_uuid(), 'john@example.com', 'hash', 'customer', 'John Doe'),
+			(gen_random_uuid(), 'other@example.com', 'hash', 'customer', 'Someone Else')
+	`, adminID)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/users?q=doe&limit=1", nil)
+	w := httptest.NewRecorder()
+	handler.ListUsersHandler(w, asAdmin(req, adminID, ""))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d", w.Code)
+	}
+
+	var resp models.AdminUserListResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+
+	if resp.Total != 2 {
+		t.Errorf("Expected 2 matching users, got %d", resp.Total)
+	}
+	if len(resp.Users) != 1 || resp.NextCursor == "" {
+		t.Fatalf("Expected the page to hold 1 user and a next cursor, got %+v", resp)
+	}
+	if link := w.Header().Get("Link"); !strings.Contains(link, `rel="next"`) {
+		t.Errorf("Expected a Link header to the next page, got %q", link)
+	}
+	first := resp.Users[0].ID
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/admin/users?q=doe&limit=1&cursor="+resp.NextCursor, nil)
+	w = httptest.NewRecorder()
+	handler.ListUsersHandler(w, asAdmin(req, adminID, ""))
+
+	resp = models.AdminUserListResponse{}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if len(resp.Users) != 1 || resp.Users[0].ID == first {
+		t.Errorf("Expected the second page to hold the other user, got %+v", resp.Users)
+	}
+	if resp.NextCursor != "" || resp.PrevCursor == "" {
+		t.Errorf("Expected the last page to link back only, got next %q, prev %q", resp.NextCursor, resp.PrevCursor)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/admin/users?q=doe&page=2&limit=1", nil)
+	w = httptest.NewRecorder()
+	handler.ListUsersHandler(w, asAdmin(req, adminID, ""))
+
+	resp = models.AdminUserListResponse{}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Page != 2 || len(resp.Users) != 1 || resp.NextCursor != "" {
+		t.Errorf("Expected page numbers to keep working, got %+v", resp)
+	}
+}
+
+func TestSuspendUserHandler_BlocksLoginAndRefresh(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	handler := &UserHandler{DB: db, Keys: testKeySet(t)}
+
+	tokens := loginTestUser(t, handler, "suspend@example.com", "securepassword123")
+
+	var userID uuid.UUID
+	db.QueryRow(context.Background(), "SELECT id FROM users WHERE email = 'suspend@example.com'").Scan(&userID)
+
+	adminID := uuid.New()
+	db.Exec(context.Background(), `
+		INSERT INTO users (id, email, password_hash, role)
+		VALUES ($1, 'admin@example.com', 'hash', 'admin')
+	`, adminID)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/users/"+userID.String()+"/suspend", nil)
+	w := httptest.NewRecorder()
+	handler.SuspendUserHandler(w, asAdmin(req, adminID, userID.String()))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK for suspend, got %d", w.Code)
+	}
+
+	if w := refresh(handler, tokens["refresh_token"]); w.Code == http.StatusOK {
+		t.Errorf("Expected refresh to fail for a suspended user")
+	}
+
+	var auditEntries int
+	db.QueryRow(context.Background(), "SELECT COUNT(*) FROM audit_logs WHERE action = 'account_suspended' AND target_user_id = $1", userID).Scan(&auditEntries)
+	if auditEntries != 1 {
+		t.Errorf("Expected 1 suspension audit entry, found %d", auditEntries)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/admin/users/"+userID.String()+"/reactivate", nil)
+	w = httptest.NewRecorder()
+	handler.ReactivateUserHandler(w, asAdmin(req, adminID, userID.String()))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK for reactivate, got %d", w.Code)
+	}
+
+	var suspended bool
+	db.QueryRow(context.Background(), "SELECT suspended_at IS NOT NULL FROM users WHERE id = $1", userID).Scan(&suspended)
+	if suspended {
+		t.Errorf("Expected user to be reactivated")
+	}
+}
@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"ecommerce-api-v2/internal/auth"
+	"ecommerce-api-v2/internal/middleware"
+	"ecommerce-api-v2/internal/models"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const maxAPIKeyNameLength = 255
+
+type APIKeyHandler struct {
+	DB *pgxpool.Pool
+}
+
+const apiKeyColumns = `
+	id, name, key_prefix, scopes, allowed_ips, created_by, expires_at,
+	last_used_at, last_used_ip, revoked_at, created_at
+`
+
+func scanAPIKey(row pgx.Row, k *models.APIKeyResponse) error {
+	return row.Scan(
+		&k.ID, &k.Name, &k.Prefix, &k.Scopes, &k.AllowedIPs, &k.CreatedBy, &k.ExpiresAt,
+		&k.LastUsedAt, &k.LastUsedIP, &k.RevokedAt, &k.CreatedAt,
+	)
+}
+
+func (h *APIKeyHandler) CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	ctxValue := r.Context().Value(middleware.UserContextKey)
+	claims, ok := ctxValue.(middleware.UserClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	actorID, _ := uuid.Parse(claims.UserID)
+
+	var req models.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > maxAPIKeyNameLength {
+		http.Error(w, "Name is required and must be at most 255 characters", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Scopes) == 0 {
+		http.Error(w, "At least one scope is required", http.StatusBadRequest)
+		return
+	}
+
+	// A key can never do more than the admin issuing it.
+	for _, scope := range req.Scopes {
+		if !claims.HasPermission(scope) {
+			http.Error(w, "Scope not granted to your role: "+scope, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		http.Error(w, "Expiry must be in the future", http.StatusBadRequest)
+		return
+	}
+
+	allowedIPs, err := auth.NormalizeIPAllowlist(req.AllowedIPs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	key, prefix, err := auth.GenerateAPIKey()
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, "Could not create API key", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	resp := models.CreateAPIKeyResponse{Key: key}
+	query := `
+		INSERT INTO api_keys (name, key_prefix, key_hash, scopes, allowed_ips, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING ` + apiKeyColumns
+	err = scanAPIKey(
+		tx.QueryRow(r.Context(), query, req.Name, prefix, auth.HashAPIKey(key), req.Scopes, allowedIPs, actorID, req.ExpiresAt),
+		&resp.APIKeyResponse,
+	)
+	if err != nil {
+		http.Error(w, "Could not create API key", http.StatusInternalServerError)
+		return
+	}
+
+	details := map[string]any{"api_key_id": resp.ID, "name": resp.Name, "scopes": resp.Scopes}
+	if err := recordAudit(r, tx, &actorID, auditAPIKeyCreated, actorID, details); err != nil {
+		http.Error(w, "Could not create API key", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, "Could not create API key", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *APIKeyHandler) ListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY created_at DESC`
+
+	rows, err := h.DB.Query(r.Context(), query)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	keys := make([]models.APIKeyResponse, 0)
+
+	for rows.Next() {
+		var k models.APIKeyResponse
+		if err := scanAPIKey(rows, &k); err != nil {
+			http.Error(w, "Error reading API keys", http.StatusInternalServerError)
+			return
+		}
+		keys = append(keys, k)
+	}
+
+	if rows.Err() != nil {
+		http.Error(w, "Error iterating over API keys", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(keys)
+}
+
+func (h *APIKeyHandler) RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	ctxValue := r.Context().Value(middleware.UserContextKey)
+	claims, ok := ctxValue.(middleware.UserClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	actorID, _ := uuid.Parse(claims.UserID)
+
+	keyID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid API key ID format", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, "Could not revoke API key", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	var createdBy uuid.UUID
+	var name string
+	query := `
+		UPDATE api_keys SET revoked_at = COALESCE(revoked_at, NOW())
+		WHERE id = $1
+		RETURNING created_by, name
+	`
+	if err := tx.QueryRow(r.Context(), query, keyID).Scan(&createdBy, &name); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "API key not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Could not revoke API key", http.StatusInternalServerError)
+		return
+	}
+
+	details := map[string]any{"api_key_id": keyID, "name": name}
+	if err := recordAudit(r, tx, &actorID, auditAPIKeyRevoked, createdBy, details); err != nil {
+		http.Error(w, "Could not revoke API key", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, "Could not revoke API key", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "API key revoked successfully",
+	})
+}
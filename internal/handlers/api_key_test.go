@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"ecommerce-api-v2/internal/auth"
+	"ecommerce-api-v2/internal/middleware"
+	"ecommerce-api-v2/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func TestAPIKey_AuthenticatesWithScopes(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	handler := &APIKeyHandler{DB: db}
+
+	adminID := uuid.New()
+	db.Exec(context.Background(), `
+		INSERT INTO users (id, email, password_hash, role)
+		VALUES ($1, 'admin@example.com', 'hash', 'admin')
+	`, adminID)
+
+	create := func(req models.CreateAPIKeyRequest) *httptest.ResponseRecorder {
+		bodyBytes, _ := json.Marshal(req)
+		httpReq := httptest.NewRequest(http.MethodPost, "/api/v1/admin/api-keys", bytes.NewReader(bodyBytes))
+		httpReq = httpReq.WithContext(context.WithValue(httpReq.Context(), middleware.UserContextKey, middleware.UserClaims{
+			UserID:      adminID.String(),
+			Role:        "admin",
+			Permissions: []string{"products:write", "orders:status"},
+		}))
+		w := httptest.NewRecorder()
+		handler.CreateAPIKeyHandler(w, httpReq)
+		return w
+	}
+
+	if w := create(models.CreateAPIKeyRequest{Name: "ERP", Scopes: []string{"roles:assign"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 Bad Request for a scope the admin doesn't hold, got %d", w.Code)
+	}
+
+	w := create(models.CreateAPIKeyRequest{Name: "ERP", Scopes: []string{"products:write"}, AllowedIPs: []string{"192.0.2.0/24"}})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 Created, got %d", w.Code)
+	}
+
+	var created models.CreateAPIKeyResponse
+	json.NewDecoder(w.Body).Decode(&created)
+	if created.Key == "" {
+		t.Fatalf("Expected the key to be returned on creation")
+	}
+
+	var gotClaims middleware.UserClaims
+	protected := middleware.AuthMiddleware(testKeySet(t), db)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotClaims, _ = r.Context().Value(middleware.UserContextKey).(middleware.UserClaims)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	call := func(remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/products", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set(auth.APIKeyHeader, created.Key)
+		w := httptest.NewRecorder()
+		protected.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := call("192.0.2.10:4000"); code != http.StatusOK {
+		t.Fatalf("Expected 200 OK from an allowed address, got %d", code)
+	}
+	if gotClaims.UserID != adminID.String() || !gotClaims.HasPermission("products:write") || gotClaims.HasPermission("orders:status") {
+		t.Errorf("Expected claims scoped to products:write for the issuing admin, got %+v", gotClaims)
+	}
+
+	if code := call("198.51.100.1:4000"); code != http.StatusForbidden {
+		t.Errorf("Expected 403 Forbidden from an address outside the allowlist, got %d", code)
+	}
+
+	var lastUsedIP string
+	db.QueryRow(context.Background(), "SELECT last_used_ip FROM api_keys WHERE id = $1", created.ID).Scan(&lastUsedIP)
+	if lastUsedIP != "192.0.2.10" {
+		t.Errorf("Expected last_used_ip to be recorded, got %q", lastUsedIP)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/admin/api-keys/"+created.ID, nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", created.ID)
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+	ctx = context.WithValue(ctx, middleware.UserContextKey, middleware.UserClaims{UserID: adminID.String(), Role: "admin"})
+	wRevoke := httptest.NewRecorder()
+	handler.RevokeAPIKeyHandler(wRevoke, req.WithContext(ctx))
+
+	if wRevoke.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK for revoke, got %d", wRevoke.Code)
+	}
+
+	if code := call("192.0.2.10:4000"); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 Unauthorized for a revoked key, got %d", code)
+	}
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+const (
+	auditAccountLocked       = "account_locked"
+	auditAccountUnlocked     = "account_unlocked"
+	auditAccountSuspended    = "account_suspended"
+	auditAccountReactivated  = "account_reactivated"
+	auditPasswordResetForced = "password_reset_forced"
+	auditRoleChanged         = "role_changed"
+	auditAPIKeyCreated       = "api_key_created"
+	auditAPIKeyRevoked       = "api_key_revoked"
+	auditIdentityLinked      = "identity_linked"
+	auditErasureRequested    = "erasure_requested"
+	auditAccountErased       = "account_erased"
+	// Each request made while impersonating is logged by the auth
+	// middleware as "impersonated_request".
+	auditImpersonationStarted = "impersonation_started"
+)
+
+// recordAudit writes an entry to audit_logs. actorID is nil for actions the
+// system takes on its own, such as locking an account.
+func recordAudit(r *http.Request, q execer, actorID *uuid.UUID, action string, targetUserID uuid.UUID, details map[string]any) error {
+	if details == nil {
+		details = map[string]any{}
+	}
+
+	query := `
+		INSERT INTO audit_logs (actor_id, action, target_user_id, details, ip_address)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err := q.Exec(r.Context(), query, actorID, action, targetUserID, details, clientIP(r))
+	return err
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
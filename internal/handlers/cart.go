@@ -4,10 +4,13 @@ import (
 	"ecommerce-api-v2/internal/middleware"
 	"ecommerce-api-v2/internal/models"
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -45,14 +48,73 @@ func (h *CartHandler) AddToCartHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Only active products can be bought. A product with variants is
+	// bought by variant, so the variant must be named and must belong to
+	// the product.
+	var status string
+	var hasVariants bool
 	query := `
-		INSERT INTO cart_items (user_id, product_id, quantity)
-		VALUES ($1, $2, $3)
-		ON CONFLICT (user_id, product_id) 
-		DO UPDATE SET quantity = cart_items.quantity + EXCLUDED.quantity;
+		SELECT status, EXISTS (SELECT 1 FROM product_variants WHERE product_id = products.id)
+		FROM products
+		WHERE id = $1
 	`
+	err = h.DB.QueryRow(r.Context(), query, productID).Scan(&status, &hasVariants)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Could not add item to cart", http.StatusInternalServerError)
+		return
+	}
+
+	switch status {
+	case productStatusDraft:
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	case productStatusArchived:
+		http.Error(w, "This product has been archived and is no longer for sale", http.StatusConflict)
+		return
+	}
+
+	if req.VariantID == "" {
+		if hasVariants {
+			http.Error(w, "This product has variants; variant_id is required", http.StatusBadRequest)
+			return
+		}
+
+		query = `
+			INSERT INTO cart_items (user_id, product_id, quantity)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (user_id, product_id) WHERE variant_id IS NULL
+			DO UPDATE SET quantity = cart_items.quantity + EXCLUDED.quantity;
+		`
+		_, err = h.DB.Exec(r.Context(), query, userID, productID, req.Quantity)
+	} else {
+		variantID, parseErr := uuid.Parse(req.VariantID)
+		if parseErr != nil {
+			http.Error(w, "Invalid variant ID format", http.StatusBadRequest)
+			return
+		}
+
+		// Selecting from product_variants makes the insert a no-op when the
+		// variant belongs to a different product.
+		query = `
+			INSERT INTO cart_items (user_id, product_id, variant_id, quantity)
+			SELECT $1, v.product_id, v.id, $4
+			FROM product_variants v
+			WHERE v.id = $3 AND v.product_id = $2
+			ON CONFLICT (user_id, variant_id) WHERE variant_id IS NOT NULL
+			DO UPDATE SET quantity = cart_items.quantity + EXCLUDED.quantity;
+		`
+		var cmdTag pgconn.CommandTag
+		cmdTag, err = h.DB.Exec(r.Context(), query, userID, productID, variantID, req.Quantity)
+		if err == nil && cmdTag.RowsAffected() == 0 {
+			http.Error(w, "Variant not found", http.StatusNotFound)
+			return
+		}
+	}
 
-	_, err = h.DB.Exec(r.Context(), query, userID, productID, req.Quantity)
 	if err != nil {
 		http.Error(w, "Could not add item to cart", http.StatusInternalServerError)
 		return
@@ -79,9 +141,14 @@ func (h *CartHandler) GetCartHandler(w http.ResponseWriter, r *http.Request) {
 			ci.quantity, 
 			p.id, 
 			p.name, 
-			p.price
+			COALESCE(v.price, p.price),
+			v.id::text,
+			v.sku,
+			v.options,
+			p.status = 'active'
 		FROM cart_items ci
 		JOIN products p ON ci.product_id = p.id
+		LEFT JOIN product_variants v ON ci.variant_id = v.id
 		WHERE ci.user_id = $1
 		ORDER BY ci.created_at DESC
 	`
@@ -101,14 +168,19 @@ func (h *CartHandler) GetCartHandler(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var item models.CartItemResponse
 
-		if err := rows.Scan(&item.CartItemID, &item.Quantity, &item.ProductID, &item.Name, &item.Price); err != nil {
+		if err := rows.Scan(
+			&item.CartItemID, &item.Quantity, &item.ProductID, &item.Name, &item.Price,
+			&item.VariantID, &item.SKU, &item.Options, &item.Available,
+		); err != nil {
 			http.Error(w, "Error reading cart items", http.StatusInternalServerError)
 			return
 		}
 
 		item.Subtotal = item.Price * item.Quantity
 
-		cart.TotalPrice += item.Subtotal
+		if item.Available {
+			cart.TotalPrice += item.Subtotal
+		}
 
 		cart.Items = append(cart.Items, item)
 	}
@@ -138,9 +210,21 @@ func (h *CartHandler) RemoveFromCartHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// Without ?variant_id= every line for the product is removed.
 	query := `DELETE FROM cart_items WHERE user_id = $1 AND product_id = $2`
+	args := []any{claims.UserID, productID}
+
+	if v := r.URL.Query().Get("variant_id"); v != "" {
+		variantID, err := uuid.Parse(v)
+		if err != nil {
+			http.Error(w, "Invalid variant ID format", http.StatusBadRequest)
+			return
+		}
+		query += ` AND variant_id = $3`
+		args = append(args, variantID)
+	}
 
-	cmdTag, err := h.DB.Exec(r.Context(), query, claims.UserID, productID)
+	cmdTag, err := h.DB.Exec(r.Context(), query, args...)
 	if err != nil {
 		http.Error(w, "Database error while removing item", http.StatusInternalServerError)
 		return
@@ -0,0 +1,367 @@
+package handlers
+
+import (
+	"context"
+	"ecommerce-api-v2/internal/models"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const maxCategoryNameLength = 255
+
+var (
+	validSlug     = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	slugSeparator = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+const categoryColumns = `id, parent_id, name, slug, description, created_at, updated_at`
+
+type CategoryHandler struct {
+	DB *pgxpool.Pool
+}
+
+func scanCategory(row pgx.Row, c *models.CategoryResponse) error {
+	return row.Scan(&c.ID, &c.ParentID, &c.Name, &c.Slug, &c.Description, &c.CreatedAt, &c.UpdatedAt)
+}
+
+// slugify turns a category name into a URL-friendly slug, e.g.
+// "Home & Garden" becomes "home-garden".
+func slugify(name string) string {
+	return strings.Trim(slugSeparator.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// buildCategoryTree nests a flat list of categories under their parents,
+// keeping the order of the input among siblings. Categories whose parent is
+// missing from the list become roots.
+func buildCategoryTree(categories []models.CategoryResponse) []*models.CategoryTreeNode {
+	nodes := make(map[string]*models.CategoryTreeNode, len(categories))
+	for _, c := range categories {
+		nodes[c.ID] = &models.CategoryTreeNode{CategoryResponse: c, Children: make([]*models.CategoryTreeNode, 0)}
+	}
+
+	roots := make([]*models.CategoryTreeNode, 0)
+	for _, c := range categories {
+		node := nodes[c.ID]
+		if c.ParentID != nil {
+			if parent, ok := nodes[*c.ParentID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+	return roots
+}
+
+// resolveCategory looks up a category by ID or slug and returns its ID.
+func resolveCategory(ctx context.Context, db *pgxpool.Pool, idOrSlug string) (uuid.UUID, error) {
+	var id uuid.UUID
+	if parsed, err := uuid.Parse(idOrSlug); err == nil {
+		err := db.QueryRow(ctx, `SELECT id FROM categories WHERE id = $1`, parsed).Scan(&id)
+		return id, err
+	}
+	err := db.QueryRow(ctx, `SELECT id FROM categories WHERE slug = $1`, idOrSlug).Scan(&id)
+	return id, err
+}
+
+// validateCategoryRequest normalizes req and returns the parent ID, or
+// writes a 400 and returns false.
+func validateCategoryRequest(w http.ResponseWriter, req *models.CreateCategoryRequest) (*uuid.UUID, bool) {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Slug = strings.TrimSpace(req.Slug)
+	if req.Name == "" || len(req.Name) > maxCategoryNameLength {
+		http.Error(w, "Category name is required and must be at most 255 characters", http.StatusBadRequest)
+		return nil, false
+	}
+
+	if req.Slug == "" {
+		req.Slug = slugify(req.Name)
+	}
+	if !validSlug.MatchString(req.Slug) || len(req.Slug) > maxCategoryNameLength {
+		http.Error(w, "Slug may only contain lowercase letters, digits and single hyphens", http.StatusBadRequest)
+		return nil, false
+	}
+
+	if req.ParentID == nil {
+		return nil, true
+	}
+	parentID, err := uuid.Parse(*req.ParentID)
+	if err != nil {
+		http.Error(w, "Invalid parent ID format", http.StatusBadRequest)
+		return nil, false
+	}
+	return &parentID, true
+}
+
+// categoryWriteError maps a failed insert or update to a response.
+func categoryWriteError(w http.ResponseWriter, err error, fallback string) {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23505":
+			http.Error(w, "Slug already in use", http.StatusConflict)
+			return
+		case "23503":
+			http.Error(w, "Parent category not found", http.StatusBadRequest)
+			return
+		}
+	}
+	http.Error(w, fallback, http.StatusInternalServerError)
+}
+
+func (h *CategoryHandler) GetCategoryTreeHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.DB.Query(r.Context(), `SELECT `+categoryColumns+` FROM categories ORDER BY name, id`)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	categories := make([]models.CategoryResponse, 0)
+
+	for rows.Next() {
+		var c models.CategoryResponse
+		if err := scanCategory(rows, &c); err != nil {
+			http.Error(w, "Error reading categories", http.StatusInternalServerError)
+			return
+		}
+		categories = append(categories, c)
+	}
+
+	if rows.Err() != nil {
+		http.Error(w, "Error iterating over categories", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(buildCategoryTree(categories))
+}
+
+// GetCategoryHandler returns a category, found by ID or slug, with its
+// ancestors for breadcrumbs and its direct children.
+func (h *CategoryHandler) GetCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	categoryID, err := resolveCategory(r.Context(), h.DB, chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Category not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := models.CategoryDetailResponse{
+		Ancestors: make([]models.CategoryResponse, 0),
+		Children:  make([]models.CategoryResponse, 0),
+	}
+
+	// Walks up from the category; depth orders the ancestors root first.
+	// path stops the walk should the tree ever contain a cycle.
+	query := `
+		WITH RECURSIVE lineage AS (
+			SELECT ` + categoryColumns + `, 0 AS depth, ARRAY[id] AS path FROM categories WHERE id = $1
+			UNION ALL
+			SELECT c.id, c.parent_id, c.name, c.slug, c.description, c.created_at, c.updated_at, l.depth + 1, l.path || c.id
+			FROM categories c
+			JOIN lineage l ON c.id = l.parent_id
+			WHERE NOT c.id = ANY(l.path)
+		)
+		SELECT ` + categoryColumns + ` FROM lineage ORDER BY depth DESC
+	`
+	rows, err := h.DB.Query(r.Context(), query, categoryID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	for rows.Next() {
+		var c models.CategoryResponse
+		if err := scanCategory(rows, &c); err != nil {
+			rows.Close()
+			http.Error(w, "Error reading categories", http.StatusInternalServerError)
+			return
+		}
+		resp.Ancestors = append(resp.Ancestors, c)
+	}
+	rows.Close()
+	if rows.Err() != nil || len(resp.Ancestors) == 0 {
+		http.Error(w, "Error iterating over categories", http.StatusInternalServerError)
+		return
+	}
+
+	last := len(resp.Ancestors) - 1
+	resp.CategoryResponse = resp.Ancestors[last]
+	resp.Ancestors = resp.Ancestors[:last]
+
+	rows, err = h.DB.Query(r.Context(), `SELECT `+categoryColumns+` FROM categories WHERE parent_id = $1 ORDER BY name, id`, categoryID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c models.CategoryResponse
+		if err := scanCategory(rows, &c); err != nil {
+			http.Error(w, "Error reading categories", http.StatusInternalServerError)
+			return
+		}
+		resp.Children = append(resp.Children, c)
+	}
+
+	if rows.Err() != nil {
+		http.Error(w, "Error iterating over categories", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *CategoryHandler) CreateCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateCategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	parentID, ok := validateCategoryRequest(w, &req)
+	if !ok {
+		return
+	}
+
+	var c models.CategoryResponse
+	query := `
+		INSERT INTO categories (parent_id, name, slug, description)
+		VALUES ($1, $2, $3, $4)
+		RETURNING ` + categoryColumns
+	if err := scanCategory(h.DB.QueryRow(r.Context(), query, parentID, req.Name, req.Slug, req.Description), &c); err != nil {
+		categoryWriteError(w, err, "Could not create category")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(c)
+}
+
+func (h *CategoryHandler) UpdateCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	categoryID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid category ID format", http.StatusBadRequest)
+		return
+	}
+
+	var req models.CreateCategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	parentID, ok := validateCategoryRequest(w, &req)
+	if !ok {
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, "Could not update category", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	// Moving a category under itself or one of its descendants would
+	// detach that whole branch from the tree. Moves are serialized so two
+	// concurrent ones, such as A under B and B under A, can't both pass the
+	// check.
+	if parentID != nil {
+		if _, err := tx.Exec(r.Context(), `SELECT pg_advisory_xact_lock(hashtext('categories_tree'))`); err != nil {
+			http.Error(w, "Could not update category", http.StatusInternalServerError)
+			return
+		}
+
+		var cycle bool
+		cycleQuery := `
+			WITH RECURSIVE subtree AS (
+				SELECT id FROM categories WHERE id = $1
+				UNION
+				SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id
+			)
+			SELECT EXISTS (SELECT 1 FROM subtree WHERE id = $2)
+		`
+		if err := tx.QueryRow(r.Context(), cycleQuery, categoryID, *parentID).Scan(&cycle); err != nil {
+			http.Error(w, "Could not update category", http.StatusInternalServerError)
+			return
+		}
+		if cycle {
+			http.Error(w, "A category cannot be moved under itself or its descendants", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var c models.CategoryResponse
+	query := `
+		UPDATE categories
+		SET parent_id = $1, name = $2, slug = $3, description = $4
+		WHERE id = $5
+		RETURNING ` + categoryColumns
+	if err := scanCategory(tx.QueryRow(r.Context(), query, parentID, req.Name, req.Slug, req.Description, categoryID), &c); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Category not found", http.StatusNotFound)
+			return
+		}
+		categoryWriteError(w, err, "Could not update category")
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, "Could not update category", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(c)
+}
+
+// DeleteCategoryHandler removes a category that has no subcategories. Its
+// products stay in the catalog and simply lose the assignment.
+func (h *CategoryHandler) DeleteCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	categoryID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid category ID format", http.StatusBadRequest)
+		return
+	}
+
+	cmdTag, err := h.DB.Exec(r.Context(), `DELETE FROM categories WHERE id = $1`, categoryID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			http.Error(w, "Category still has subcategories; move or delete them first", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Could not delete category", http.StatusInternalServerError)
+		return
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Category deleted successfully",
+	})
+}
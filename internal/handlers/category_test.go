@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"ecommerce-api-v2/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func withURLParam(req *http.Request, key, value string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add(key, value)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestBuildCategoryTree(t *testing.T) {
+	root, child, orphanParent := "root", "child", "missing"
+	categories := []models.CategoryResponse{
+		{ID: "grandchild", ParentID: &child},
+		{ID: root},
+		{ID: child, ParentID: &root},
+		{ID: "orphan", ParentID: &orphanParent},
+	}
+
+	tree := buildCategoryTree(categories)
+
+	if len(tree) != 2 || tree[0].ID != "root" || tree[1].ID != "orphan" {
+		t.Fatalf("Expected roots [root orphan], got %+v", tree)
+	}
+	if len(tree[0].Children) != 1 || tree[0].Children[0].ID != "child" {
+		t.Fatalf("Expected root to hold child, got %+v", tree[0].Children)
+	}
+	if len(tree[0].Children[0].Children) != 1 || tree[0].Children[0].Children[0].ID != "grandchild" {
+		t.Errorf("Expected child to hold grandchild, got %+v", tree[0].Children[0].Children)
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"Home & Garden":    "home-garden",
+		"  Men's Shoes  ":  "men-s-shoes",
+		"4K TVs":           "4k-tvs",
+		"--Already-Slug--": "already-slug",
+	}
+
+	for name, want := range tests {
+		if got := slugify(name); got != want {
+			t.Errorf("slugify(%q) = %q, expected %q", name, got, want)
+		}
+	}
+}
+
+func TestCategories_FilterIncludesDescendants(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	categoryHandler := &CategoryHandler{DB: db}
+	productHandler := &ProductHandler{DB: db}
+
+	createCategory := func(req models.CreateCategoryRequest) models.CategoryResponse {
+		t.Helper()
+		body, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		categoryHandler.CreateCategoryHandler(w, httptest.NewRequest(http.MethodPost, "/api/v1/categories", bytes.NewReader(body)))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected category to be created, got %d: %s", w.Code, w.Body.String())
+		}
+		var c models.CategoryResponse
+		json.NewDecoder(w.Body).Decode(&c)
+		return c
+	}
+
+	createProduct := func(name string, categoryIDs ...string) {
+		t.Helper()
+		body, _ := json.Marshal(models.CreateProductRequest{Name: name, Price: 100, StockQuantity: 1, CategoryIDs: categoryIDs})
+		w := httptest.NewRecorder()
+		productHandler.CreateProductHandler(w, httptest.NewRequest(http.MethodPost, "/api/v1/products", bytes.NewReader(body)))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected product to be created, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	electronics := createCategory(models.CreateCategoryRequest{Name: "Electronics"})
+	if electronics.Slug != "electronics" {
+		t.Errorf("Expected derived slug 'electronics', got %q", electronics.Slug)
+	}
+	phones := createCategory(models.CreateCategoryRequest{Name: "Phones", ParentID: &electronics.ID})
+	garden := createCategory(models.CreateCategoryRequest{Name: "Garden"})
+
+	createProduct("Laptop", electronics.ID)
+	createProduct("Smartphone", phones.ID)
+	createProduct("Rake", garden.ID)
+
+	w := httptest.NewRecorder()
+	productHandler.GetProductsHandler(w, httptest.NewRequest(http.MethodGet, "/api/v1/products?category=electronics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d", w.Code)
+	}
+
+	var list models.ProductListResponse
+	json.NewDecoder(w.Body).Decode(&list)
+	if len(list.Products) != 2 {
+		t.Errorf("Expected the laptop and the smartphone, got %+v", list.Products)
+	}
+
+	body, _ := json.Marshal(models.CreateCategoryRequest{Name: "Electronics", ParentID: &phones.ID})
+	req := withURLParam(httptest.NewRequest(http.MethodPut, "/api/v1/categories/"+electronics.ID, bytes.NewReader(body)), "id", electronics.ID)
+	w = httptest.NewRecorder()
+	categoryHandler.UpdateCategoryHandler(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 when moving a category under its descendant, got %d", w.Code)
+	}
+
+	req = withURLParam(httptest.NewRequest(http.MethodDelete, "/api/v1/categories/"+electronics.ID, nil), "id", electronics.ID)
+	w = httptest.NewRecorder()
+	categoryHandler.DeleteCategoryHandler(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 when deleting a category with subcategories, got %d", w.Code)
+	}
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"ecommerce-api-v2/internal/middleware"
+	"ecommerce-api-v2/internal/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// collectUserData gathers everything stored about a user that they are
+// entitled to receive: their profile, linked social logins, cart and
+// orders with their items.
+func (h *UserHandler) collectUserData(ctx context.Context, userID uuid.UUID) (models.UserDataExport, error) {
+	export := models.UserDataExport{
+		ExportedAt:       time.Now().UTC(),
+		LinkedIdentities: make([]models.LinkedIdentityExport, 0),
+		Cart:             make([]models.CartItemResponse, 0),
+		Orders:           make([]models.OrderHistoryResponse, 0),
+	}
+
+	profileQuery := `
+		SELECT id, email, full_name, phone, role, email_verified_at, totp_enabled_at IS NOT NULL, created_at
+		FROM users
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+	p := &export.Profile
+	err := h.DB.QueryRow(ctx, profileQuery, userID).Scan(
+		&p.ID, &p.Email, &p.FullName, &p.Phone, &p.Role, &p.EmailVerifiedAt, &p.TwoFactorEnabled, &p.CreatedAt,
+	)
+	if err != nil {
+		return export, err
+	}
+
+	rows, err := h.DB.Query(ctx, `SELECT provider, email, created_at FROM user_identities WHERE user_id = $1 ORDER BY created_at`, userID)
+	if err != nil {
+		return export, err
+	}
+	for rows.Next() {
+		var identity models.LinkedIdentityExport
+		if err := rows.Scan(&identity.Provider, &identity.Email, &identity.LinkedAt); err != nil {
+			rows.Close()
+			return export, err
+		}
+		export.LinkedIdentities = append(export.LinkedIdentities, identity)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return export, err
+	}
+
+	cartQuery := `
+		SELECT ci.id, ci.quantity, p.id, p.name, COALESCE(v.price, p.price), v.id::text, v.sku, v.options, p.status = 'active'
+		FROM cart_items ci
+		JOIN products p ON ci.product_id = p.id
+		LEFT JOIN product_variants v ON ci.variant_id = v.id
+		WHERE ci.user_id = $1
+		ORDER BY ci.created_at DESC
+	`
+	rows, err = h.DB.Query(ctx, cartQuery, userID)
+	if err != nil {
+		return export, err
+	}
+	for rows.Next() {
+		var item models.CartItemResponse
+		if err := rows.Scan(
+			&item.CartItemID, &item.Quantity, &item.ProductID, &item.Name, &item.Price,
+			&item.VariantID, &item.SKU, &item.Options, &item.Available,
+		); err != nil {
+			rows.Close()
+			return export, err
+		}
+		item.Subtotal = item.Price * item.Quantity
+		export.Cart = append(export.Cart, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return export, err
+	}
+
+	ordersQuery := `
+		SELECT
+			o.id, o.total_amount, o.status, o.created_at,
+			oi.product_id, p.name, oi.variant_id::text, oi.sku, oi.quantity, oi.price_at_purchase
+		FROM orders o
+		JOIN order_items oi ON o.id = oi.order_id
+		JOIN products p ON oi.product_id = p.id
+		WHERE o.user_id = $1
+		ORDER BY o.created_at DESC, o.id
+	`
+	rows, err = h.DB.Query(ctx, ordersQuery, userID)
+	if err != nil {
+		return export, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var order models.OrderHistoryResponse
+		var item models.OrderHistoryItemResponse
+		if err := rows.Scan(
+			&order.OrderID, &order.TotalAmount, &order.Status, &order.CreatedAt,
+			&item.ProductID, &item.ProductName, &item.VariantID, &item.SKU, &item.Quantity, &item.PriceAtPurchase,
+		); err != nil {
+			return export, err
+		}
+
+		if len(export.Orders) == 0 || export.Orders[len(export.Orders)-1].OrderID != order.OrderID {
+			order.Items = make([]models.OrderHistoryItemResponse, 0)
+			export.Orders = append(export.Orders, order)
+		}
+		last := len(export.Orders) - 1
+		export.Orders[last].Items = append(export.Orders[last].Items, item)
+	}
+
+	return export, rows.Err()
+}
+
+// ExportDataHandler hands the user a copy of their data. The response is a
+// single JSON document, or with ?format=zip a zip archive holding one JSON
+// file per section.
+func (h *UserHandler) ExportDataHandler(w http.ResponseWriter, r *http.Request) {
+	ctxValue := r.Context().Value(middleware.UserContextKey)
+	claims, ok := ctxValue.(middleware.UserClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := uuid.Parse(claims.UserID)
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "zip" {
+		http.Error(w, "Invalid format. Allowed values: json, zip", http.StatusBadRequest)
+		return
+	}
+
+	export, err := h.collectUserData(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Could not export data", http.StatusInternalServerError)
+		return
+	}
+
+	filename := "account-export-" + export.ExportedAt.Format("2006-01-02")
+
+	if format != "zip" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".json"))
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(export)
+		return
+	}
+
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", export.Profile},
+		{"linked_identities.json", export.LinkedIdentities},
+		{"cart.json", export.Cart},
+		{"orders.json", export.Orders},
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".zip"))
+	w.WriteHeader(http.StatusOK)
+
+	// Headers are already sent, so a failure from here on can only cut the
+	// archive short, which the client sees as a corrupt zip.
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: export.ExportedAt})
+		if err != nil {
+			return
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.data); err != nil {
+			return
+		}
+	}
+	zw.Close()
+}
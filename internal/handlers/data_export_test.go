@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"ecommerce-api-v2/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestExportDataHandler(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	handler := &UserHandler{DB: db}
+
+	userID := registerTestUser(t, handler, "exporter@example.com")
+
+	productID := uuid.New()
+	orderID := uuid.New()
+	_, err := db.Exec(context.Background(), `
+		WITH p AS (
+			INSERT INTO products (id, name, price, stock_quantity) VALUES ($2, 'Mug', 1200, 10) RETURNING id
+		), o AS (
+			INSERT INTO orders (id, user_id, total_amount, status) VALUES ($3, $1, 2400, 'delivered') RETURNING id
+		), oi AS (
+			INSERT INTO order_items (order_id, product_id, quantity, price_at_purchase) SELECT o.id, p.id, 2, 1200 FROM o, p
+		)
+		INSERT INTO cart_items (user_id, product_id, quantity) SELECT $1, p.id, 1 FROM p
+	`, userID, productID, orderID)
+	if err != nil {
+		t.Fatalf("Failed to insert test data: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/users/me/export", nil)
+	w := httptest.NewRecorder()
+	handler.ExportDataHandler(w, withUser(req, userID))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d", w.Code)
+	}
+
+	var export models.UserDataExport
+	if err := json.NewDecoder(w.Body).Decode(&export); err != nil {
+		t.Fatalf("Failed to decode export: %v", err)
+	}
+	if export.Profile.Email != "exporter@example.com" {
+		t.Errorf("Expected profile email in export, got %q", export.Profile.Email)
+	}
+	if len(export.Cart) != 1 {
+		t.Errorf("Expected 1 cart item in export, got %d", len(export.Cart))
+	}
+	if len(export.Orders) != 1 || len(export.Orders[0].Items) != 1 || export.Orders[0].Items[0].Quantity != 2 {
+		t.Errorf("Expected 1 order with its item in export, got %+v", export.Orders)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/users/me/export?format=zip", nil)
+	w = httptest.NewRecorder()
+	handler.ExportDataHandler(w, withUser(req, userID))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK for zip export, got %d", w.Code)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read zip export: %v", err)
+	}
+
+	names := make(map[string]bool)
+	for _, f := range archive.File {
+		names[f.Name] = true
+	}
+	for _, name := range []string{"profile.json", "linked_identities.json", "cart.json", "orders.json"} {
+		if !names[name] {
+			t.Errorf("Expected %s in zip export", name)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"ecommerce-api-v2/internal/middleware"
+	"ecommerce-api-v2/internal/models"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const maxErasureReason = 500
+
+// RequestErasureHandler queues a customer's account for erasure, for
+// right-to-erasure requests that reach support rather than the customer
+// deleting their own account. The erasure job carries it out.
+func (h *UserHandler) RequestErasureHandler(w http.ResponseWriter, r *http.Request) {
+	ctxValue := r.Context().Value(middleware.UserContextKey)
+	claims, ok := ctxValue.(middleware.UserClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	actorID, _ := uuid.Parse(claims.UserID)
+
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID format", http.StatusBadRequest)
+		return
+	}
+
+	if userID == actorID {
+		http.Error(w, "Use DELETE /users/me to delete your own account", http.StatusBadRequest)
+		return
+	}
+
+	var req models.ErasureRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	req.Reason = strings.TrimSpace(req.Reason)
+	if len(req.Reason) > maxErasureReason {
+		http.Error(w, "Reason is too long", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, "Could not request erasure", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	var exists bool
+	if err := tx.QueryRow(r.Context(), `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND deleted_at IS NULL)`, userID).Scan(&exists); err != nil {
+		http.Error(w, "Could not request erasure", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	var resp models.ErasureRequestResponse
+	query := `
+		INSERT INTO erasure_requests (user_id, requested_by, reason)
+		VALUES ($1, $2, $3)
+		RETURNING id, user_id, requested_by, reason, requested_at, completed_at, last_error
+	`
+	err = tx.QueryRow(r.Context(), query, userID, actorID, req.Reason).Scan(
+		&resp.ID, &resp.UserID, &resp.RequestedBy, &resp.Reason, &resp.RequestedAt, &resp.CompletedAt, &resp.LastError,
+	)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			http.Error(w, "Erasure has already been requested for this user", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Could not request erasure", http.StatusInternalServerError)
+		return
+	}
+
+	if err := recordAudit(r, tx, &actorID, auditErasureRequested, userID, map[string]any{"reason": req.Reason}); err != nil {
+		http.Error(w, "Could not request erasure", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, "Could not request erasure", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ProcessErasureRequests carries out every pending erasure request and
+// returns how many were completed. Each request runs in its own
+// transaction; one that fails has its error recorded and is retried on the
+// next run.
+func (h *UserHandler) ProcessErasureRequests(ctx context.Context) (int, error) {
+	var completed int
+	var failed []uuid.UUID
+
+	for {
+		requestID, err := h.processNextErasure(ctx, failed)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return completed, nil
+		}
+		if err != nil {
+			if requestID == uuid.Nil {
+				return completed, err
+			}
+
+			log.Printf("Failed to process erasure request %s: %v", requestID, err)
+			failed = append(failed, requestID)
+			errorQuery := `UPDATE erasure_requests SET last_error = $2 WHERE id = $1`
+			if _, dbErr := h.DB.Exec(ctx, errorQuery, requestID, err.Error()); dbErr != nil {
+				return completed, dbErr
+			}
+			continue
+		}
+
+		completed++
+	}
+}
+
+// processNextErasure erases the account behind the oldest pending request
+// not in skip. It returns pgx.ErrNoRows when there is nothing left to do.
+func (h *UserHandler) processNextErasure(ctx context.Context, skip []uuid.UUID) (uuid.UUID, error) {
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var requestID uuid.UUID
+	var userID, requestedBy *uuid.UUID
+	query := `
+		SELECT id, user_id, requested_by
+		FROM erasure_requests
+		WHERE completed_at IS NULL AND NOT (id = ANY($1))
+		ORDER BY requested_at
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	`
+	if skip == nil {
+		skip = []uuid.UUID{}
+	}
+	if err := tx.QueryRow(ctx, query, skip).Scan(&requestID, &userID, &requestedBy); err != nil {
+		return uuid.Nil, err
+	}
+
+	// A NULL user_id means the account was already deleted, for instance
+	// by the user themselves, so there is nothing left to erase.
+	if userID != nil {
+		// The audit entry goes in first: if the user row is deleted
+		// below, its target_user_id is nulled rather than rejected.
+		auditQuery := `
+			INSERT INTO audit_logs (actor_id, action, target_user_id, details)
+			VALUES ($1, $2, $3, $4)
+		`
+		details := map[string]any{"erasure_request_id": requestID}
+		if _, err := tx.Exec(ctx, auditQuery, requestedBy, auditAccountErased, *userID, details); err != nil {
+			return requestID, err
+		}
+
+		if err := eraseUser(ctx, tx, *userID); err != nil {
+			return requestID, err
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE erasure_requests SET completed_at = NOW(), last_error = NULL WHERE id = $1`, requestID); err != nil {
+		return requestID, err
+	}
+
+	return requestID, tx.Commit(ctx)
+}
+
+// StartErasureJob processes pending erasure requests every interval until
+// ctx is done.
+func (h *UserHandler) StartErasureJob(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				n, err := h.ProcessErasureRequests(ctx)
+				if err != nil {
+					log.Printf("Failed to process erasure requests: %v", err)
+				}
+				if n > 0 {
+					log.Printf("Erased %d accounts", n)
+				}
+			}
+		}
+	}()
+}
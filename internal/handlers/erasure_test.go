@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"ecommerce-api-v2/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestErasure_QueuedAndProcessed(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	handler := &UserHandler{DB: db}
+
+	adminID := uuid.New()
+	db.Exec(context.Background(), `
+		INSERT INTO users (id, email, password_hash, role) VALUES ($1, 'admin@example.com', 'hash', 'admin')
+	`, adminID)
+
+	withOrders := registerTestUser(t, handler, "ordered@example.com")
+	withoutOrders := registerTestUser(t, handler, "browsed@example.com")
+
+	if _, err := db.Exec(context.Background(), `INSERT INTO orders (user_id, total_amount, status) VALUES ($1, 1000, 'delivered')`, withOrders); err != nil {
+		t.Fatalf("Failed to insert test order: %v", err)
+	}
+
+	requestErasure := func(userID uuid.UUID) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(models.ErasureRequest{Reason: "Customer emailed support"})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/users/"+userID.String()+"/erasure", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.RequestErasureHandler(w, asAdmin(req, adminID, userID.String()))
+		return w
+	}
+
+	for _, userID := range []uuid.UUID{withOrders, withoutOrders} {
+		if w := requestErasure(userID); w.Code != http.StatusAccepted {
+			t.Fatalf("Expected 202 Accepted, got %d", w.Code)
+		}
+	}
+
+	if w := requestErasure(withOrders); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 Conflict for a second pending request, got %d", w.Code)
+	}
+
+	n, err := handler.ProcessErasureRequests(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to process erasure requests: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("Expected 2 erasures, got %d", n)
+	}
+
+	var email string
+	if err := db.QueryRow(context.Background(), "SELECT email FROM users WHERE id = $1", withOrders).Scan(&email); err != nil {
+		t.Fatalf("Expected the user with orders to be kept: %v", err)
+	}
+	if !strings.HasSuffix(email, "@deleted.invalid") {
+		t.Errorf("Expected email to be anonymized, got %q", email)
+	}
+
+	var remaining int
+	db.QueryRow(context.Background(), "SELECT COUNT(*) FROM users WHERE id = $1", withoutOrders).Scan(&remaining)
+	if remaining != 0 {
+		t.Errorf("Expected the user without orders to be deleted")
+	}
+
+	var pending int
+	db.QueryRow(context.Background(), "SELECT COUNT(*) FROM erasure_requests WHERE completed_at IS NULL").Scan(&pending)
+	if pending != 0 {
+		t.Errorf("Expected no pending erasure requests, found %d", pending)
+	}
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"ecommerce-api-v2/internal/middleware"
+	"ecommerce-api-v2/internal/models"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	impersonationTokenTTL  = 10 * time.Minute
+	maxImpersonationReason = 500
+)
+
+// ImpersonateUserHandler issues a short-lived access token that lets a staff
+// member act as a customer. The token is tied to the staff member's own
+// session, carries no refresh token and is refused on routes guarded by
+// middleware.DenyImpersonation. Only accounts whose role grants no
+// permissions can be impersonated.
+func (h *UserHandler) ImpersonateUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctxValue := r.Context().Value(middleware.UserContextKey)
+	claims, ok := ctxValue.(middleware.UserClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	actorID, _ := uuid.Parse(claims.UserID)
+
+	sessionID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		http.Error(w, "Forbidden: impersonation requires a signed-in session", http.StatusForbidden)
+		return
+	}
+
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID format", http.StatusBadRequest)
+		return
+	}
+
+	if userID == actorID {
+		http.Error(w, "You cannot impersonate yourself", http.StatusBadRequest)
+		return
+	}
+
+	var req models.ImpersonateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		http.Error(w, "A reason is required to impersonate a user", http.StatusBadRequest)
+		return
+	}
+	if len(req.Reason) > maxImpersonationReason {
+		http.Error(w, "Reason is too long", http.StatusBadRequest)
+		return
+	}
+
+	var role string
+	var suspended, staff bool
+	query := `
+		SELECT u.role, u.suspended_at IS NOT NULL,
+			EXISTS (SELECT 1 FROM role_permissions rp WHERE rp.role = u.role)
+		FROM users u
+		WHERE u.id = $1 AND u.deleted_at IS NULL
+	`
+	if err := h.DB.QueryRow(r.Context(), query, userID).Scan(&role, &suspended, &staff); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if staff {
+		http.Error(w, "Staff accounts cannot be impersonated", http.StatusForbidden)
+		return
+	}
+	if suspended {
+		http.Error(w, "Suspended accounts cannot be impersonated", http.StatusConflict)
+		return
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(impersonationTokenTTL)
+	token, err := h.Keys.Sign(&models.Claims{
+		UserID:         userID,
+		Role:           role,
+		SessionID:      sessionID,
+		ImpersonatorID: &actorID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	})
+	if err != nil {
+		http.Error(w, "Could not generate token", http.StatusInternalServerError)
+		return
+	}
+
+	details := map[string]any{"reason": req.Reason, "expires_at": expiresAt}
+	if err := recordAudit(r, h.DB, &actorID, auditImpersonationStarted, userID, details); err != nil {
+		http.Error(w, "Could not start impersonation", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.ImpersonationResponse{
+		Token:          token,
+		UserID:         userID.String(),
+		ImpersonatorID: actorID.String(),
+		ExpiresAt:      expiresAt,
+	})
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"ecommerce-api-v2/internal/auth"
+	"ecommerce-api-v2/internal/middleware"
+	"ecommerce-api-v2/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func impersonate(handler *UserHandler, adminID, sessionID uuid.UUID, targetID string) *httptest.ResponseRecorder {
+	bodyBytes, _ := json.Marshal(models.ImpersonateUserRequest{Reason: "Ticket #123: cart shows wrong total"})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/users/"+targetID+"/impersonate", bytes.NewReader(bodyBytes))
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", targetID)
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+	ctx = context.WithValue(ctx, middleware.UserContextKey, middleware.UserClaims{
+		UserID:    adminID.String(),
+		Role:      "support",
+		SessionID: sessionID.String(),
+	})
+
+	w := httptest.NewRecorder()
+	handler.ImpersonateUserHandler(w, req.WithContext(ctx))
+	return w
+}
+
+func TestImpersonateUserHandler(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	handler := &UserHandler{DB: db, Keys: testKeySet(t)}
+
+	adminID, customerID, staffID := uuid.New(), uuid.New(), uuid.New()
+	db.Exec(context.Background(), `
+		INSERT INTO users (id, email, password_hash, role)
+		VALUES ($1, 'support@example.com', 'hash', 'support'),
+			($2, 'customer@example.com', 'hash', 'customer'),
+			($3, 'catalog@example.com', 'hash', 'catalog_manager')
+	`, adminID, customerID, staffID)
+
+	sessionID := uuid.New()
+	w := impersonate(handler, adminID, sessionID, customerID.String())
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp models.ImpersonationResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+
+	claims := &models.Claims{}
+	if _, err := jwt.ParseWithClaims(resp.Token, claims, handler.Keys.Keyfunc, jwt.WithValidMethods(auth.ValidMethods)); err != nil {
+		t.Fatalf("Failed to parse impersonation token: %v", err)
+	}
+	if claims.UserID != customerID || claims.ImpersonatorID == nil || *claims.ImpersonatorID != adminID || claims.SessionID != sessionID {
+		t.Errorf("Unexpected impersonation claims: %+v", claims)
+	}
+
+	var auditEntries int
+	db.QueryRow(context.Background(), "SELECT COUNT(*) FROM audit_logs WHERE action = 'impersonation_started' AND actor_id = $1 AND target_user_id = $2", adminID, customerID).Scan(&auditEntries)
+	if auditEntries != 1 {
+		t.Errorf("Expected 1 impersonation audit entry, found %d", auditEntries)
+	}
+
+	if w := impersonate(handler, adminID, sessionID, staffID.String()); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 Forbidden when impersonating staff, got %d", w.Code)
+	}
+}
@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"context"
+	"ecommerce-api-v2/internal/middleware"
+	"ecommerce-api-v2/internal/models"
+	"ecommerce-api-v2/internal/pagination"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const maxStockReason = 500
+
+// Stock movement types. Checkouts, cancellations and imports are recorded
+// as they happen; adjustments and returns are also entered by staff.
+const (
+	movementCheckout     = "checkout"
+	movementCancellation = "cancellation"
+	movementAdjustment   = "adjustment"
+	movementImport       = "import"
+	movementReturn       = "return"
+)
+
+var errInsufficientStock = errors.New("insufficient stock")
+
+const inventoryMovementColumns = `
+	id, product_id, variant_id, sku, type, delta, balance, reason, actor_id, order_id, import_job_id, created_at
+`
+
+func scanInventoryMovement(row pgx.Row, m *models.InventoryMovementResponse) error {
+	return row.Scan(
+		&m.ID, &m.ProductID, &m.VariantID, &m.SKU, &m.Type, &m.Delta, &m.Balance, &m.Reason,
+		&m.ActorID, &m.OrderID, &m.ImportJobID, &m.CreatedAt,
+	)
+}
+
+// stockMovement is a change to the stock of a product, or of one of its
+// variants when VariantID is set.
+type stockMovement struct {
+	ProductID   uuid.UUID
+	VariantID   *uuid.UUID
+	Type        string
+	Delta       int
+	Reason      string
+	ActorID     *uuid.UUID
+	OrderID     *uuid.UUID
+	ImportJobID *uuid.UUID
+}
+
+// requestActor returns the ID of the user making r, or nil if there is
+// none.
+func requestActor(r *http.Request) *uuid.UUID {
+	claims, ok := r.Context().Value(middleware.UserContextKey).(middleware.UserClaims)
+	if !ok {
+		return nil
+	}
+	actorID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return nil
+	}
+	return &actorID
+}
+
+// recordStockMovement records a change to stock that the caller has
+// already made, along with the balance it left.
+func recordStockMovement(ctx context.Context, tx pgx.Tx, m stockMovement, balance int) (models.InventoryMovementResponse, error) {
+	var mv models.InventoryMovementResponse
+	query := `
+		INSERT INTO inventory_movements (product_id, variant_id, sku, type, delta, balance, reason, actor_id, order_id, import_job_id)
+		VALUES ($1, $2, (SELECT sku FROM product_variants WHERE id = $2), $3, $4, $5, $6, $7, $8, $9)
+		RETURNING ` + inventoryMovementColumns
+	err := scanInventoryMovement(tx.QueryRow(ctx, query,
+		m.ProductID, m.VariantID, m.Type, m.Delta, balance, m.Reason, m.ActorID, m.OrderID, m.ImportJobID,
+	), &mv)
+	return mv, err
+}
+
+// adjustStock changes stock by m.Delta and records the movement. It
+// returns pgx.ErrNoRows if the product or variant doesn't exist, and
+// errInsufficientStock if the stock would go below zero.
+func adjustStock(ctx context.Context, tx pgx.Tx, m stockMovement) (models.InventoryMovementResponse, error) {
+	var stock int
+	var err error
+	if m.VariantID != nil {
+		query := `SELECT stock_quantity FROM product_variants WHERE id = $1 AND product_id = $2 FOR UPDATE`
+		err = tx.QueryRow(ctx, query, *m.VariantID, m.ProductID).Scan(&stock)
+	} else {
+		err = tx.QueryRow(ctx, `SELECT stock_quantity FROM products WHERE id = $1 FOR UPDATE`, m.ProductID).Scan(&stock)
+	}
+	if err != nil {
+		return models.InventoryMovementResponse{}, err
+	}
+
+	balance := stock + m.Delta
+	if balance < 0 {
+		return models.InventoryMovementResponse{}, errInsufficientStock
+	}
+
+	if m.VariantID != nil {
+		_, err = tx.Exec(ctx, `UPDATE product_variants SET stock_quantity = $1 WHERE id = $2`, balance, *m.VariantID)
+	} else {
+		_, err = tx.Exec(ctx, `UPDATE products SET stock_quantity = $1 WHERE id = $2`, balance, m.ProductID)
+	}
+	if err != nil {
+		return models.InventoryMovementResponse{}, err
+	}
+
+	return recordStockMovement(ctx, tx, m, balance)
+}
+
+// AdjustStockHandler changes the stock of a product, or of one of its
+// variants, by a delta, recording who made the change and why.
+func (h *ProductHandler) AdjustStockHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID format", http.StatusBadRequest)
+		return
+	}
+
+	var req models.StockAdjustmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if req.Type == "" {
+		req.Type = movementAdjustment
+	}
+	if req.Type != movementAdjustment && req.Type != movementReturn {
+		http.Error(w, "Invalid type. Allowed values: adjustment, return", http.StatusBadRequest)
+		return
+	}
+
+	if req.Delta == 0 {
+		http.Error(w, "Delta must not be zero", http.StatusBadRequest)
+		return
+	}
+
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" || len(req.Reason) > maxStockReason {
+		http.Error(w, "A reason of at most 500 characters is required", http.StatusBadRequest)
+		return
+	}
+
+	m := stockMovement{
+		ProductID: productID,
+		Type:      req.Type,
+		Delta:     req.Delta,
+		Reason:    req.Reason,
+		ActorID:   requestActor(r),
+	}
+	if req.VariantID != "" {
+		variantID, err := uuid.Parse(req.VariantID)
+		if err != nil {
+			http.Error(w, "Invalid variant ID format", http.StatusBadRequest)
+			return
+		}
+		m.VariantID = &variantID
+	}
+	if req.OrderID != "" {
+		orderID, err := uuid.Parse(req.OrderID)
+		if err != nil {
+			http.Error(w, "Invalid order ID format", http.StatusBadRequest)
+			return
+		}
+		m.OrderID = &orderID
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, "Could not adjust stock", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	// A product with variants is sold from its variants' stock, so that is
+	// the stock to adjust.
+	if m.VariantID == nil {
+		var hasVariants bool
+		if err := tx.QueryRow(r.Context(), `SELECT EXISTS (SELECT 1 FROM product_variants WHERE product_id = $1)`, productID).Scan(&hasVariants); err != nil {
+			http.Error(w, "Could not adjust stock", http.StatusInternalServerError)
+			return
+		}
+		if hasVariants {
+			http.Error(w, "This product has variants; variant_id is required", http.StatusBadRequest)
+			return
+		}
+	}
+
+	mv, err := adjustStock(r.Context(), tx, m)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		switch {
+		case errors.Is(err, pgx.ErrNoRows) && m.VariantID != nil:
+			http.Error(w, "Variant not found", http.StatusNotFound)
+		case errors.Is(err, pgx.ErrNoRows):
+			http.Error(w, "Product not found", http.StatusNotFound)
+		case errors.Is(err, errInsufficientStock):
+			http.Error(w, "Stock can't go below zero", http.StatusConflict)
+		case errors.As(err, &pgErr) && pgErr.Code == "23503":
+			http.Error(w, "Order not found", http.StatusBadRequest)
+		default:
+			http.Error(w, "Could not adjust stock", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, "Could not adjust stock", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(mv)
+}
+
+// GetStockMovementsHandler lists the stock movements of a product, newest
+// first, a page at a time. variant_id and type narrow the list.
+func (h *ProductHandler) GetStockMovementsHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID format", http.StatusBadRequest)
+		return
+	}
+
+	limit := 50
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsedLimit, err := strconv.Atoi(l); err == nil && parsedLimit > 0 && parsedLimit <= 200 {
+			limit = parsedLimit
+		}
+	}
+
+	conditions := []string{"product_id = $1"}
+	args := []any{productID}
+
+	if v := r.URL.Query().Get("variant_id"); v != "" {
+		variantID, err := uuid.Parse(v)
+		if err != nil {
+			http.Error(w, "Invalid variant ID format", http.StatusBadRequest)
+			return
+		}
+		args = append(args, variantID)
+		conditions = append(conditions, fmt.Sprintf("variant_id = $%d", len(args)))
+	}
+
+	if t := r.URL.Query().Get("type"); t != "" {
+		switch t {
+		case movementCheckout, movementCancellation, movementAdjustment, movementImport, movementReturn:
+		default:
+			http.Error(w, "Invalid type. Allowed values: checkout, cancellation, adjustment, import, return", http.StatusBadRequest)
+			return
+		}
+		args = append(args, t)
+		conditions = append(conditions, fmt.Sprintf("type = $%d", len(args)))
+	}
+
+	cursor, ok := parseCursor(w, r, h.Cursors, cursorScopeStockMovements)
+	if !ok {
+		return
+	}
+
+	var exists bool
+	if err := h.DB.QueryRow(r.Context(), `SELECT EXISTS (SELECT 1 FROM products WHERE id = $1)`, productID).Scan(&exists); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	if cursor != nil {
+		conditions = append(conditions, cursor.Where("created_at", "id", len(args)+1))
+		args = append(args, cursor.Args()...)
+	}
+	args = append(args, limit+1)
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM inventory_movements
+		WHERE %s
+		ORDER BY %s
+		LIMIT $%d
+	`, inventoryMovementColumns, strings.Join(conditions, " AND "), pagination.OrderBy(cursor, "created_at", "id"), len(args))
+
+	rows, err := h.DB.Query(r.Context(), query, args...)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	movements := make([]models.InventoryMovementResponse, 0)
+	for rows.Next() {
+		var mv models.InventoryMovementResponse
+		if err := scanInventoryMovement(rows, &mv); err != nil {
+			http.Error(w, "Error fetching rows", http.StatusInternalServerError)
+			return
+		}
+		movements = append(movements, mv)
+	}
+
+	if rows.Err() != nil {
+		http.Error(w, "Error iterating over stock movements", http.StatusInternalServerError)
+		return
+	}
+
+	resp := models.InventoryMovementListResponse{Limit: limit}
+	resp.Movements, resp.NextCursor, resp.PrevCursor = pagination.Paginate(
+		cursorSigner(h.Cursors), cursorScopeStockMovements, cursor, movements, limit,
+		func(mv models.InventoryMovementResponse) (time.Time, uuid.UUID) {
+			return mv.CreatedAt, uuid.MustParse(mv.ID)
+		},
+	)
+	setPageLinks(w, r, resp.NextCursor, resp.PrevCursor)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
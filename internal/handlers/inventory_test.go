@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"ecommerce-api-v2/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestInventoryLedger_RecordsEveryMovement(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	productHandler := &ProductHandler{DB: db}
+	orderHandler := &OrderHandler{DB: db}
+
+	adminID := uuid.New()
+	userID := uuid.New()
+	productID := uuid.New()
+	db.Exec(context.Background(), `
+		INSERT INTO users (id, email, password_hash, role) VALUES
+			($1, 'stock-admin@example.com', 'hash', 'admin'),
+			($2, 'stock-buyer@example.com', 'hash', 'customer')
+	`, adminID, userID)
+	db.Exec(context.Background(), `
+		INSERT INTO products (id, name, price, stock_quantity)
+		VALUES ($1, 'Tea Tin', 1200, 5)
+	`, productID)
+
+	adjust := func(req models.StockAdjustmentRequest) (int, models.InventoryMovementResponse) {
+		t.Helper()
+		body, _ := json.Marshal(req)
+		r := withUser(httptest.NewRequest(http.MethodPost, "/api/v1/products/"+productID.String()+"/stock-adjustments", bytes.NewReader(body)), adminID)
+		w := httptest.NewRecorder()
+		productHandler.AdjustStockHandler(w, withURLParam(r, "id", productID.String()))
+		var mv models.InventoryMovementResponse
+		json.NewDecoder(w.Body).Decode(&mv)
+		return w.Code, mv
+	}
+
+	code, mv := adjust(models.StockAdjustmentRequest{Delta: 3, Reason: "Found in back room"})
+	if code != http.StatusCreated || mv.Balance != 8 || mv.Type != "adjustment" || mv.ActorID == nil || *mv.ActorID != adminID.String() {
+		t.Fatalf("Expected an adjustment to a balance of 8, got %d %+v", code, mv)
+	}
+	if code, _ := adjust(models.StockAdjustmentRequest{Delta: -20, Reason: "Shrinkage"}); code != http.StatusConflict {
+		t.Errorf("Expected 409 when stock would go negative, got %d", code)
+	}
+	if code, _ := adjust(models.StockAdjustmentRequest{Delta: -1}); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a reason, got %d", code)
+	}
+
+	update := func(stock int) int {
+		t.Helper()
+		body, _ := json.Marshal(models.CreateProductRequest{Name: "Tea Tin", Price: 1300, StockQuantity: stock})
+		r := withUser(httptest.NewRequest(http.MethodPut, "/api/v1/products/"+productID.String(), bytes.NewReader(body)), adminID)
+		w := httptest.NewRecorder()
+		productHandler.UpdateProductHandler(w, withURLParam(r, "id", productID.String()))
+		return w.Code
+	}
+	for _, stock := range []int{0, 5} {
+		if code := update(stock); code != http.StatusOK {
+			t.Errorf("Expected an update with stock_quantity %d to succeed, got %d", stock, code)
+		}
+	}
+	var stock int
+	db.QueryRow(context.Background(), `SELECT stock_quantity FROM products WHERE id = $1`, productID).Scan(&stock)
+	if stock != 8 {
+		t.Errorf("Expected product updates to leave the stock at 8, got %d", stock)
+	}
+
+	db.Exec(context.Background(), `
+		INSERT INTO cart_items (user_id, product_id, quantity) VALUES ($1, $2, 2)
+	`, userID, productID)
+	w := httptest.NewRecorder()
+	orderHandler.CheckoutHandler(w, withUser(httptest.NewRequest(http.MethodPost, "/api/v1/checkout", nil), userID))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected checkout to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	var order models.CheckoutResponse
+	json.NewDecoder(w.Body).Decode(&order)
+
+	setStatus := func(status string) int {
+		t.Helper()
+		body, _ := json.Marshal(models.UpdateOrderStatusRequest{Status: status})
+		r := withUser(httptest.NewRequest(http.MethodPut, "/api/v1/orders/"+order.OrderID+"/status", bytes.NewReader(body)), adminID)
+		w := httptest.NewRecorder()
+		orderHandler.UpdateOrderStatusHandler(w, withURLParam(r, "id", order.OrderID))
+		return w.Code
+	}
+	if code := setStatus("cancelled"); code != http.StatusOK {
+		t.Fatalf("Expected the order to be cancelled, got %d", code)
+	}
+	if code := setStatus("shipped"); code != http.StatusConflict {
+		t.Errorf("Expected a cancelled order to stay cancelled, got %d", code)
+	}
+
+	db.QueryRow(context.Background(), `SELECT stock_quantity FROM products WHERE id = $1`, productID).Scan(&stock)
+	if stock != 8 {
+		t.Errorf("Expected cancelling to put the stock back to 8, got %d", stock)
+	}
+
+	list := func(query string) models.InventoryMovementListResponse {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/products/"+productID.String()+"/stock-movements?"+query, nil)
+		w := httptest.NewRecorder()
+		productHandler.GetStockMovementsHandler(w, withURLParam(r, "id", productID.String()))
+		var resp models.InventoryMovementListResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		return resp
+	}
+
+	page := list("limit=2")
+	if len(page.Movements) != 2 || page.NextCursor == "" {
+		t.Fatalf("Expected a first page of 2 movements, got %+v", page)
+	}
+	cancellation, checkout := page.Movements[0], page.Movements[1]
+	if cancellation.Type != "cancellation" || cancellation.Delta != 2 || cancellation.Balance != 8 {
+		t.Errorf("Unexpected cancellation movement %+v", cancellation)
+	}
+	if checkout.Type != "checkout" || checkout.Delta != -2 || checkout.Balance != 6 || checkout.OrderID == nil || *checkout.OrderID != order.OrderID {
+		t.Errorf("Unexpected checkout movement %+v", checkout)
+	}
+
+	page = list("limit=2&cursor=" + page.NextCursor)
+	if len(page.Movements) != 1 || page.Movements[0].Reason != "Found in back room" {
+		t.Errorf("Expected the adjustment on the second page, got %+v", page.Movements)
+	}
+
+	if page = list("type=checkout"); len(page.Movements) != 1 {
+		t.Errorf("Expected one checkout movement, got %+v", page.Movements)
+	}
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"ecommerce-api-v2/internal/middleware"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type LoginPolicy struct {
+	// MaxAccountFailures consecutive failures lock the account for
+	// LockoutDuration.
+	MaxAccountFailures int
+	LockoutDuration    time.Duration
+
+	// MaxIPFailures failures from one IP address within Window block further
+	// attempts from it until older failures fall out of the window.
+	MaxIPFailures int
+	Window        time.Duration
+
+	// After DelayAfter failures for an email within Window, each further
+	// attempt must wait BaseDelay, doubling per failure up to MaxDelay.
+	DelayAfter int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+func DefaultLoginPolicy() LoginPolicy {
+	return LoginPolicy{
+		MaxAccountFailures: 10,
+		LockoutDuration:    15 * time.Minute,
+		MaxIPFailures:      50,
+		Window:             15 * time.Minute,
+		DelayAfter:         3,
+		BaseDelay:          time.Second,
+		MaxDelay:           time.Minute,
+	}
+}
+
+func (h *UserHandler) loginPolicy() LoginPolicy {
+	if h.LoginPolicy == (LoginPolicy{}) {
+		return DefaultLoginPolicy()
+	}
+	return h.LoginPolicy
+}
+
+func (p LoginPolicy) delay(failures int) time.Duration {
+	if failures < p.DelayAfter {
+		return 0
+	}
+	d := time.Duration(float64(p.BaseDelay) * math.Pow(2, float64(failures-p.DelayAfter)))
+	if d > p.MaxDelay || d <= 0 {
+		return p.MaxDelay
+	}
+	return d
+}
+
+func tooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "Too many login attempts, try again later", http.StatusTooManyRequests)
+}
+
+// checkLoginThrottle reports how long the caller must wait before another
+// login attempt for email from ip is allowed. Throttling is keyed on the
+// email string rather than the account so that it behaves the same whether
+// or not the account exists.
+func (h *UserHandler) checkLoginThrottle(r *http.Request, email, ip string) (time.Duration, error) {
+	policy := h.loginPolicy()
+	since := time.Now().Add(-policy.Window)
+
+	var ipFailures int
+	var oldestIPFailure *time.Time
+	ipQuery := `
+		SELECT COUNT(*), MIN(created_at)
+		FROM login_attempts
+		WHERE ip_address = $1 AND NOT succeeded AND created_at > $2
+	`
+	if err := h.DB.QueryRow(r.Context(), ipQuery, ip, since).Scan(&ipFailures, &oldestIPFailure); err != nil {
+		return 0, err
+	}
+
+	if ipFailures >= policy.MaxIPFailures && oldestIPFailure != nil {
+		return time.Until(oldestIPFailure.Add(policy.Window)), nil
+	}
+
+	var emailFailures int
+	var lastFailure *time.Time
+	emailQuery := `
+		SELECT COUNT(*), MAX(created_at)
+		FROM login_attempts
+		WHERE email = $1 AND NOT succeeded AND created_at > $2
+		AND created_at > COALESCE(
+			(SELECT MAX(created_at) FROM login_attempts WHERE email = $1 AND succeeded),
+			'-infinity'
+		)
+	`
+	if err := h.DB.QueryRow(r.Context(), emailQuery, email, since).Scan(&emailFailures, &lastFailure); err != nil {
+		return 0, err
+	}
+
+	if lastFailure != nil {
+		if wait := time.Until(lastFailure.Add(policy.delay(emailFailures))); wait > 0 {
+			return wait, nil
+		}
+	}
+
+	return 0, nil
+}
+
+func (h *UserHandler) recordLoginAttempt(r *http.Request, email, ip string, succeeded bool) error {
+	query := `INSERT INTO login_attempts (email, ip_address, succeeded) VALUES ($1, $2, $3)`
+	_, err := h.DB.Exec(r.Context(), query, email, ip, succeeded)
+	return err
+}
+
+// recordAccountFailure counts a failed password against an existing account
+// and locks it once the policy threshold is reached.
+func (h *UserHandler) recordAccountFailure(r *http.Request, userID uuid.UUID) error {
+	policy := h.loginPolicy()
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(r.Context())
+
+	var failures int
+	query := `
+		UPDATE users SET failed_login_attempts = failed_login_attempts + 1
+		WHERE id = $1
+		RETURNING failed_login_attempts
+	`
+	if err := tx.QueryRow(r.Context(), query, userID).Scan(&failures); err != nil {
+		return err
+	}
+
+	if failures >= policy.MaxAccountFailures {
+		lockedUntil := time.Now().Add(policy.LockoutDuration)
+		lockQuery := `UPDATE users SET failed_login_attempts = 0, locked_until = $1 WHERE id = $2`
+		if _, err := tx.Exec(r.Context(), lockQuery, lockedUntil, userID); err != nil {
+			return err
+		}
+
+		details := map[string]any{
+			"failed_attempts": failures,
+			"locked_until":    lockedUntil,
+		}
+		if err := recordAudit(r, tx, nil, auditAccountLocked, userID, details); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(r.Context())
+}
+
+func (h *UserHandler) UnlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctxValue := r.Context().Value(middleware.UserContextKey)
+	claims, ok := ctxValue.(middleware.UserClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	actorID, _ := uuid.Parse(claims.UserID)
+
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID format", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, "Could not unlock user", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	var email string
+	query := `
+		UPDATE users SET failed_login_attempts = 0, locked_until = NULL
+		WHERE id = $1
+		RETURNING email
+	`
+	if err := tx.QueryRow(r.Context(), query, userID).Scan(&email); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Could not unlock user", http.StatusInternalServerError)
+		return
+	}
+
+	// Clear failed attempts too, otherwise the progressive delay would still
+	// apply to the account after it has been unlocked.
+	clearQuery := `DELETE FROM login_attempts WHERE email = $1 AND NOT succeeded`
+	if _, err := tx.Exec(r.Context(), clearQuery, email); err != nil {
+		http.Error(w, "Could not unlock user", http.StatusInternalServerError)
+		return
+	}
+
+	if err := recordAudit(r, tx, &actorID, auditAccountUnlocked, userID, nil); err != nil {
+		http.Error(w, "Could not unlock user", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, "Could not unlock user", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "User unlocked successfully",
+	})
+}
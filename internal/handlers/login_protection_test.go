@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"ecommerce-api-v2/internal/middleware"
+	"ecommerce-api-v2/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func TestLoginPolicy_Delay(t *testing.T) {
+	policy := LoginPolicy{DelayAfter: 3, BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+
+	cases := map[int]time.Duration{
+		2: 0,
+		3: time.Second,
+		4: 2 * time.Second,
+		5: 4 * time.Second,
+		6: 5 * time.Second,
+	}
+	for failures, want := range cases {
+		if got := policy.delay(failures); got != want {
+			t.Errorf("delay(%d) = %v, want %v", failures, got, want)
+		}
+	}
+}
+
+func TestLoginUserHandler_Lockout(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	handler := &UserHandler{
+		DB:   db,
+		Keys: testKeySet(t),
+		LoginPolicy: LoginPolicy{
+			MaxAccountFailures: 3,
+			LockoutDuration:    time.Hour,
+			MaxIPFailures:      100,
+			Window:             time.Hour,
+			DelayAfter:         100,
+			BaseDelay:          time.Second,
+			MaxDelay:           time.Second,
+		},
+	}
+
+	userID := registerTestUser(t, handler, "target@example.com")
+
+	login := func(password string) *httptest.ResponseRecorder {
+		bodyBytes, _ := json.Marshal(models.LoginUserRequest{Email: "target@example.com", Password: password})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/users/login", bytes.NewReader(bodyBytes))
+		w := httptest.NewRecorder()
+		handler.LoginUserHandler(w, req)
+		return w
+	}
+
+	for i := 0; i < 3; i++ {
+		if w := login("wrongpassword"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected 401 for failed attempt %d, got %d", i+1, w.Code)
+		}
+	}
+
+	w := login("securepassword123")
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected locked account to reject the correct password, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "Invalid email or password") {
+		t.Errorf("Expected locked account to answer like a wrong password, got %q", w.Body.String())
+	}
+
+	var lockEntries int
+	db.QueryRow(context.Background(), "SELECT COUNT(*) FROM audit_logs WHERE action = $1 AND target_user_id = $2", auditAccountLocked, userID).Scan(&lockEntries)
+	if lockEntries != 1 {
+		t.Errorf("Expected 1 lockout audit entry, found %d", lockEntries)
+	}
+
+	adminID := uuid.New()
+	db.Exec(context.Background(), `
+		INSERT INTO users (id, email, password_hash, role) 
+		VALUES ($1, 'support@example.com', 'hash', 'support')
+	`, adminID)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/users/"+userID.String()+"/unlock", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", userID.String())
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+	ctx = context.WithValue(ctx, middleware.UserContextKey, middleware.UserClaims{UserID: adminID.String(), Role: "support"})
+	wUnlock := httptest.NewRecorder()
+	handler.UnlockUserHandler(wUnlock, req.WithContext(ctx))
+
+	if wUnlock.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK for unlock, got %d", wUnlock.Code)
+	}
+
+	if w := login("securepassword123"); w.Code != http.StatusOK {
+		t.Errorf("Expected login to succeed after unlock, got %d", w.Code)
+	}
+}
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"context"
+	"ecommerce-api-v2/internal/auth"
+	"ecommerce-api-v2/internal/models"
+	"ecommerce-api-v2/internal/notifier"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	magicLinkTTL     = 15 * time.Minute
+	magicLinkPurpose = "magic_link"
+
+	// At most magicLinkMaxPerEmail links may be requested for one email, and
+	// magicLinkMaxPerIP from one IP address, within magicLinkRequestWindow.
+	magicLinkRequestWindow = 15 * time.Minute
+	magicLinkMaxPerEmail   = 5
+	magicLinkMaxPerIP      = 20
+)
+
+// checkMagicLinkThrottle reports how long the caller must wait before
+// requesting another sign-in link for email from ip. Requests are counted
+// apart from login attempts, so they never delay or lock password logins.
+func (h *UserHandler) checkMagicLinkThrottle(r *http.Request, email, ip string) (time.Duration, error) {
+	since := time.Now().Add(-magicLinkRequestWindow)
+
+	limits := []struct {
+		column string
+		value  string
+		max    int
+	}{
+		{"ip_address", ip, magicLinkMaxPerIP},
+		{"email", email, magicLinkMaxPerEmail},
+	}
+	for _, limit := range limits {
+		var count int
+		var oldest *time.Time
+		query := `SELECT COUNT(*), MIN(created_at) FROM magic_link_requests WHERE ` + limit.column + ` = $1 AND created_at > $2`
+		if err := h.DB.QueryRow(r.Context(), query, limit.value, since).Scan(&count, &oldest); err != nil {
+			return 0, err
+		}
+		if count >= limit.max && oldest != nil {
+			return time.Until(oldest.Add(magicLinkRequestWindow)), nil
+		}
+	}
+
+	return 0, nil
+}
+
+// sendMagicLink signs a single-use login token for the user, records its ID
+// so it can only be redeemed once, and emails it.
+func (h *UserHandler) sendMagicLink(ctx context.Context, userID uuid.UUID, email string) error {
+	tokenID := uuid.New()
+	now := time.Now()
+	expiresAt := now.Add(magicLinkTTL)
+
+	claims := models.ChallengeClaims{
+		UserID:  userID,
+		Purpose: magicLinkPurpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID.String(),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	token, err := h.Keys.Sign(&claims)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO magic_link_tokens (id, user_id, expires_at) VALUES ($1, $2, $3)`
+	if _, err := h.DB.Exec(ctx, query, tokenID, userID, expiresAt); err != nil {
+		return err
+	}
+
+	body := "Use the following token to sign in. It expires in 15 minutes and can only be used once.\n\n" + token
+	if h.MagicLinkURL != "" {
+		body = "Follow this link to sign in. It expires in 15 minutes and can only be used once.\n\n" +
+			h.MagicLinkURL + url.QueryEscape(token)
+	}
+
+	h.notify(ctx, notifier.Message{
+		To:      email,
+		Subject: "Your sign-in link",
+		Body:    body,
+	})
+
+	return nil
+}
+
+func (h *UserHandler) RequestMagicLinkHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.MagicLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+	if req.Email == "" {
+		http.Error(w, "Email can't be empty", http.StatusBadRequest)
+		return
+	}
+
+	ip := clientIP(r)
+
+	wait, err := h.checkMagicLinkThrottle(r, req.Email, ip)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "Too many sign-in link requests, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	// Every request is counted, whether or not a link is sent, so the
+	// endpoint can't be used to flood an inbox.
+	recordQuery := `INSERT INTO magic_link_requests (email, ip_address) VALUES ($1, $2)`
+	if _, err := h.DB.Exec(r.Context(), recordQuery, req.Email, ip); err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	// The response is the same whether or not a link is sent, and the
+	// lookup and email happen after it, so that neither the body nor the
+	// response time reveals which emails are accounts or their roles.
+	email := req.Email
+	h.runInBackground(r.Context(), func(ctx context.Context) {
+		h.pruneMagicLinkRequests(ctx)
+
+		var userID uuid.UUID
+		var enabled bool
+		query := `
+			SELECT u.id, r.magic_link_enabled AND u.suspended_at IS NULL
+			FROM users u
+			JOIN roles r ON r.name = u.role
+			WHERE u.email = $1
+		`
+		err := h.DB.QueryRow(ctx, query, email).Scan(&userID, &enabled)
+		if errors.Is(err, pgx.ErrNoRows) || (err == nil && !enabled) {
+			return
+		}
+		if err == nil {
+			err = h.sendMagicLink(ctx, userID, email)
+		}
+		if err != nil {
+			log.Printf("Failed to send sign-in link: %v", err)
+		}
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "If an account with that email can sign in by link, a sign-in link has been sent",
+	})
+}
+
+// pruneMagicLinkRequests deletes requests too old to count towards the
+// rate limit, so the emails and addresses in them aren't kept.
+func (h *UserHandler) pruneMagicLinkRequests(ctx context.Context) {
+	query := `DELETE FROM magic_link_requests WHERE created_at < $1`
+	if _, err := h.DB.Exec(ctx, query, time.Now().Add(-magicLinkRequestWindow)); err != nil {
+		log.Printf("Failed to prune sign-in link requests: %v", err)
+	}
+}
+
+func (h *UserHandler) MagicLinkLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.MagicLinkLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	claims := &models.ChallengeClaims{}
+	token, err := jwt.ParseWithClaims(strings.TrimSpace(req.Token), claims, h.Keys.Keyfunc, jwt.WithValidMethods(auth.ValidMethods))
+	if err != nil || !token.Valid || claims.Purpose != magicLinkPurpose {
+		http.Error(w, "Invalid or expired sign-in link", http.StatusUnauthorized)
+		return
+	}
+
+	tokenID, err := uuid.Parse(claims.ID)
+	if err != nil {
+		http.Error(w, "Invalid or expired sign-in link", http.StatusUnauthorized)
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	useQuery := `
+		UPDATE magic_link_tokens SET used_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND used_at IS NULL AND expires_at > NOW()
+	`
+	cmdTag, err := tx.Exec(r.Context(), useQuery, tokenID, claims.UserID)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if cmdTag.RowsAffected() == 0 {
+		http.Error(w, "Invalid or expired sign-in link", http.StatusUnauthorized)
+		return
+	}
+
+	var user models.User
+	var enabled bool
+	var totpEnabledAt, suspendedAt *time.Time
+	userQuery := `
+		SELECT u.id, u.email, u.role, r.magic_link_enabled, u.totp_enabled_at, u.suspended_at
+		FROM users u
+		JOIN roles r ON r.name = u.role
+		WHERE u.id = $1
+	`
+	err = tx.QueryRow(r.Context(), userQuery, claims.UserID).Scan(
+		&user.ID, &user.Email, &user.Role, &enabled, &totpEnabledAt, &suspendedAt,
+	)
+	if err != nil {
+		http.Error(w, "Invalid or expired sign-in link", http.StatusUnauthorized)
+		return
+	}
+
+	// The role is checked again because it may have changed since the link
+	// was sent.
+	if !enabled {
+		http.Error(w, "Sign-in links are not available for this account", http.StatusForbidden)
+		return
+	}
+
+	if suspendedAt != nil {
+		http.Error(w, "Account suspended", http.StatusForbidden)
+		return
+	}
+
+	// Opening the link proves the user controls the address.
+	verifyQuery := `UPDATE users SET email_verified_at = NOW() WHERE id = $1 AND email_verified_at IS NULL`
+	if _, err := tx.Exec(r.Context(), verifyQuery, user.ID); err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	if totpEnabledAt != nil {
+		h.writeTwoFactorChallenge(w, user.ID)
+		return
+	}
+
+	h.completeLogin(w, r, user, clientIP(r), false)
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"ecommerce-api-v2/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func requestMagicLink(handler *UserHandler, email string) *httptest.ResponseRecorder {
+	bodyBytes, _ := json.Marshal(models.MagicLinkRequest{Email: email})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/login/magic-link/request", bytes.NewReader(bodyBytes))
+	w := httptest.NewRecorder()
+	handler.RequestMagicLinkHandler(w, req)
+	return w
+}
+
+func redeemMagicLink(handler *UserHandler, token string) *httptest.ResponseRecorder {
+	bodyBytes, _ := json.Marshal(models.MagicLinkLoginRequest{Token: token})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/login/magic-link", bytes.NewReader(bodyBytes))
+	w := httptest.NewRecorder()
+	handler.MagicLinkLoginHandler(w, req)
+	return w
+}
+
+func TestMagicLinkLoginHandler_SingleUse(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	notes := &recordingNotifier{}
+	handler := &UserHandler{DB: db, Keys: testKeySet(t), Notifier: notes}
+
+	registerTestUser(t, handler, "linkme@example.com")
+
+	if w := requestMagicLink(handler, "linkme@example.com"); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK for link request, got %d", w.Code)
+	}
+	handler.background.Wait()
+
+	msg, _ := notes.last()
+	if msg.Subject != "Your sign-in link" {
+		t.Fatalf("Expected a sign-in link email, got %q", msg.Subject)
+	}
+	token := notes.lastToken()
+
+	w := redeemMagicLink(handler, token)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK when redeeming the link, got %d", w.Code)
+	}
+
+	var tokens map[string]string
+	json.NewDecoder(w.Body).Decode(&tokens)
+	if tokens["token"] == "" || tokens["refresh_token"] == "" {
+		t.Errorf("Expected a token pair after redeeming the link")
+	}
+
+	if w := redeemMagicLink(handler, token); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 Unauthorized when reusing the link, got %d", w.Code)
+	}
+
+	var verified bool
+	db.QueryRow(context.Background(), "SELECT email_verified_at IS NOT NULL FROM users WHERE email = 'linkme@example.com'").Scan(&verified)
+	if !verified {
+		t.Errorf("Expected redeeming a link to verify the email")
+	}
+}
+
+func TestRequestMagicLinkHandler_DisabledForStaff(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	notes := &recordingNotifier{}
+	handler := &UserHandler{DB: db, Keys: testKeySet(t), Notifier: notes}
+
+	userID := registerTestUser(t, handler, "staff@example.com")
+	db.Exec(context.Background(), "UPDATE users SET role = 'admin' WHERE id = $1", userID)
+	sent := len(notes.messages)
+
+	if w := requestMagicLink(handler, "staff@example.com"); w.Code != http.StatusOK {
+		t.Fatalf("Expected the usual 200 OK for a disabled role, got %d", w.Code)
+	}
+	handler.background.Wait()
+
+	if len(notes.messages) != sent {
+		t.Errorf("Expected no sign-in link to be sent to an admin")
+	}
+}
+
+func TestRequestMagicLinkHandler_RateLimitedApartFromLogins(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	handler := &UserHandler{DB: db, Keys: testKeySet(t), Notifier: &recordingNotifier{}}
+
+	registerTestUser(t, handler, "target@example.com")
+
+	for i := 0; i < magicLinkMaxPerEmail; i++ {
+		if w := requestMagicLink(handler, "target@example.com"); w.Code != http.StatusOK {
+			t.Fatalf("Expected request %d to be allowed, got %d", i+1, w.Code)
+		}
+	}
+	if w := requestMagicLink(handler, "target@example.com"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 once the per-email limit is reached, got %d", w.Code)
+	}
+
+	var failures int
+	db.QueryRow(context.Background(), "SELECT COUNT(*) FROM login_attempts WHERE email = 'target@example.com' AND NOT succeeded").Scan(&failures)
+	if failures != 0 {
+		t.Errorf("Expected link requests not to count as failed logins, found %d", failures)
+	}
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"context"
+	"ecommerce-api-v2/internal/models"
+	"ecommerce-api-v2/internal/oidc"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+var errNoVerifiedEmail = errors.New("provider did not return a verified email")
+
+func (h *UserHandler) StartOIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	providerName := chi.URLParam(r, "provider")
+	provider, ok := h.OIDCProviders[providerName]
+	if !ok {
+		http.Error(w, "Unknown login provider", http.StatusNotFound)
+		return
+	}
+
+	state, err := oidc.GenerateCodeVerifier()
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	nonce, err := oidc.GenerateCodeVerifier()
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	codeVerifier, err := oidc.GenerateCodeVerifier()
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Logins that were started but never finished leave their state behind.
+	if _, err := h.DB.Exec(r.Context(), `DELETE FROM oidc_login_states WHERE expires_at < NOW()`); err != nil {
+		http.Error(w, "Could not start login", http.StatusInternalServerError)
+		return
+	}
+
+	query := `
+		INSERT INTO oidc_login_states (state_hash, provider, code_verifier, nonce, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err = h.DB.Exec(r.Context(), query, hashToken(state), providerName, codeVerifier, nonce, time.Now().Add(oidcStateTTL))
+	if err != nil {
+		http.Error(w, "Could not start login", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"authorization_url": provider.AuthCodeURL(state, nonce, codeVerifier),
+	})
+}
+
+func (h *UserHandler) OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	providerName := chi.URLParam(r, "provider")
+	provider, ok := h.OIDCProviders[providerName]
+	if !ok {
+		http.Error(w, "Unknown login provider", http.StatusNotFound)
+		return
+	}
+
+	if r.URL.Query().Get("error") != "" {
+		http.Error(w, "Login was cancelled or denied by the provider", http.StatusBadRequest)
+		return
+	}
+
+	code := r.URL.Query().Get("code")
+	state := r.URL.Query().Get("state")
+	if code == "" || state == "" {
+		http.Error(w, "Code and state are required", http.StatusBadRequest)
+		return
+	}
+
+	// Each state is single-use, so it is deleted as it is read.
+	var codeVerifier, nonce string
+	var expiresAt time.Time
+	query := `
+		DELETE FROM oidc_login_states
+		WHERE state_hash = $1 AND provider = $2
+		RETURNING code_verifier, nonce, expires_at
+	`
+	err := h.DB.QueryRow(r.Context(), query, hashToken(state), providerName).Scan(&codeVerifier, &nonce, &expiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Invalid or expired login state", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if time.Now().After(expiresAt) {
+		http.Error(w, "Invalid or expired login state", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := provider.Exchange(r.Context(), code, codeVerifier)
+	if err != nil || claims.Nonce != nonce {
+		if err != nil {
+			log.Printf("OIDC exchange with %s failed: %v", providerName, err)
+		}
+		http.Error(w, "Could not verify login with provider", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := h.resolveOIDCUser(r, providerName, claims)
+	if err != nil {
+		if errors.Is(err, errNoVerifiedEmail) {
+			http.Error(w, "Your provider account has no verified email address", http.StatusForbidden)
+			return
+		}
+		http.Error(w, "Could not complete login", http.StatusInternalServerError)
+		return
+	}
+
+	var user models.User
+	var totpEnabledAt, suspendedAt *time.Time
+	userQuery := `SELECT id, email, role, totp_enabled_at, suspended_at FROM users WHERE id = $1`
+	err = h.DB.QueryRow(r.Context(), userQuery, userID).Scan(&user.ID, &user.Email, &user.Role, &totpEnabledAt, &suspendedAt)
+	if err != nil {
+		http.Error(w, "Could not complete login", http.StatusInternalServerError)
+		return
+	}
+
+	if suspendedAt != nil {
+		http.Error(w, "Account suspended", http.StatusForbidden)
+		return
+	}
+
+	if totpEnabledAt != nil {
+		h.writeTwoFactorChallenge(w, user.ID)
+		return
+	}
+
+	h.completeLogin(w, r, user, clientIP(r), false)
+}
+
+// resolveOIDCUser finds the user an external identity belongs to. Unknown
+// identities are linked to the account with the same email, or a new
+// account is created, but only when the provider has verified the email.
+func (h *UserHandler) resolveOIDCUser(r *http.Request, providerName string, claims *oidc.IDTokenClaims) (uuid.UUID, error) {
+	ctx := r.Context()
+
+	var userID uuid.UUID
+	query := `SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2`
+	err := h.DB.QueryRow(ctx, query, providerName, claims.Subject).Scan(&userID)
+	if err == nil {
+		return userID, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, err
+	}
+
+	email := strings.ToLower(strings.TrimSpace(claims.Email))
+	if !claims.EmailVerified || !validEmail(email) {
+		return uuid.Nil, errNoVerifiedEmail
+	}
+
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var emailVerifiedAt *time.Time
+	err = tx.QueryRow(ctx, `SELECT id, email_verified_at FROM users WHERE email = $1 FOR UPDATE`, email).Scan(&userID, &emailVerifiedAt)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		userID = uuid.New()
+		insertQuery := `
+			INSERT INTO users (id, email, password_hash, role, email_verified_at)
+			VALUES ($1, $2, '!', 'customer', NOW())
+		`
+		if _, err := tx.Exec(ctx, insertQuery, userID, email); err != nil {
+			return uuid.Nil, err
+		}
+	case err != nil:
+		return uuid.Nil, err
+	case emailVerifiedAt == nil:
+		if err := claimUnverifiedAccount(ctx, tx, userID); err != nil {
+			return uuid.Nil, err
+		}
+	}
+
+	linkQuery := `INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4)`
+	if _, err := tx.Exec(ctx, linkQuery, userID, providerName, claims.Subject, email); err != nil {
+		return uuid.Nil, err
+	}
+
+	if err := recordAudit(r, tx, &userID, auditIdentityLinked, userID, map[string]any{"provider": providerName}); err != nil {
+		return uuid.Nil, err
+	}
+
+	return userID, tx.Commit(ctx)
+}
+
+// claimUnverifiedAccount hands an account that never verified its email to
+// the person who just proved they own it. Whoever registered it may not
+// have, so their password and sessions are thrown away.
+func claimUnverifiedAccount(ctx context.Context, tx pgx.Tx, userID uuid.UUID) error {
+	query := `UPDATE users SET email_verified_at = NOW(), password_hash = '!' WHERE id = $1`
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return err
+	}
+
+	revokeQuery := `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	_, err := tx.Exec(ctx, revokeQuery, userID)
+	return err
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"ecommerce-api-v2/internal/oidc"
+	"ecommerce-api-v2/internal/oidc/oidctest"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func oidcLogin(t *testing.T, handler *UserHandler, fake *oidctest.Provider) *httptest.ResponseRecorder {
+	t.Helper()
+
+	withProvider := func(req *http.Request) *http.Request {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("provider", "fake")
+		return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	}
+
+	reqStart := httptest.NewRequest(http.MethodGet, "/api/v1/users/oidc/fake/start", nil)
+	wStart := httptest.NewRecorder()
+	handler.StartOIDCLoginHandler(wStart, withProvider(reqStart))
+	if wStart.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK from start, got %d", wStart.Code)
+	}
+
+	var start map[string]string
+	json.NewDecoder(wStart.Body).Decode(&start)
+
+	code, state, err := fake.Authorize(start["authorization_url"])
+	if err != nil {
+		t.Fatalf("Authorization with the fake provider failed: %v", err)
+	}
+
+	params := url.Values{"code": {code}, "state": {state}}
+	reqCallback := httptest.NewRequest(http.MethodGet, "/api/v1/users/oidc/fake/callback?"+params.Encode(), nil)
+	wCallback := httptest.NewRecorder()
+	handler.OIDCCallbackHandler(wCallback, withProvider(reqCallback))
+	return wCallback
+}
+
+func newOIDCTestHandler(t *testing.T) (*UserHandler, *oidctest.Provider) {
+	t.Helper()
+
+	fake := oidctest.NewProvider(t)
+	provider, err := oidc.Discover(context.Background(), "fake", fake.Config("http://localhost/api/v1/users/oidc/fake/callback"), nil)
+	if err != nil {
+		t.Fatalf("Discovery failed: %v", err)
+	}
+
+	db := setupTestDB()
+	t.Cleanup(db.Close)
+
+	return &UserHandler{
+		DB:            db,
+		Keys:          testKeySet(t),
+		OIDCProviders: map[string]*oidc.Provider{"fake": provider},
+	}, fake
+}
+
+func TestOIDCCallbackHandler_CreatesAndReusesAccount(t *testing.T) {
+	handler, fake := newOIDCTestHandler(t)
+	fake.SetUser(oidctest.User{Subject: "sub-1", Email: "Social@Example.com", EmailVerified: true})
+
+	w := oidcLogin(t, handler, fake)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK from callback, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var tokens map[string]string
+	json.NewDecoder(w.Body).Decode(&tokens)
+	if tokens["token"] == "" || tokens["refresh_token"] == "" {
+		t.Errorf("Expected a token pair after social login")
+	}
+
+	if w := oidcLogin(t, handler, fake); w.Code != http.StatusOK {
+		t.Fatalf("Expected a second login to succeed, got %d", w.Code)
+	}
+
+	var users, identities int
+	handler.DB.QueryRow(context.Background(), "SELECT COUNT(*) FROM users WHERE email = 'social@example.com'").Scan(&users)
+	handler.DB.QueryRow(context.Background(), "SELECT COUNT(*) FROM user_identities").Scan(&identities)
+	if users != 1 || identities != 1 {
+		t.Errorf("Expected 1 user and 1 identity, found %d and %d", users, identities)
+	}
+}
+
+func TestOIDCCallbackHandler_LinksByVerifiedEmailOnly(t *testing.T) {
+	handler, fake := newOIDCTestHandler(t)
+	registerTestUser(t, handler, "existing@example.com")
+
+	fake.SetUser(oidctest.User{Subject: "sub-2", Email: "existing@example.com", EmailVerified: false})
+	if w := oidcLogin(t, handler, fake); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 Forbidden for an unverified provider email, got %d", w.Code)
+	}
+
+	fake.SetUser(oidctest.User{Subject: "sub-2", Email: "existing@example.com", EmailVerified: true})
+	if w := oidcLogin(t, handler, fake); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK when linking by verified email, got %d", w.Code)
+	}
+
+	// The local account was never verified, so its password can't be
+	// trusted after someone else proved they own the address.
+	var passwordHash string
+	handler.DB.QueryRow(context.Background(), "SELECT password_hash FROM users WHERE email = 'existing@example.com'").Scan(&passwordHash)
+	if passwordHash != "!" {
+		t.Errorf("Expected the unverified account's password to be invalidated")
+	}
+}
@@ -3,17 +3,24 @@ package handlers
 import (
 	"ecommerce-api-v2/internal/middleware"
 	"ecommerce-api-v2/internal/models"
+	"ecommerce-api-v2/internal/pagination"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type OrderHandler struct {
-	DB *pgxpool.Pool
+	DB                   *pgxpool.Pool
+	RequireVerifiedEmail bool
+	Cursors              *pagination.Signer
 }
 
 func (h *OrderHandler) CheckoutHandler(w http.ResponseWriter, r *http.Request) {
@@ -25,6 +32,19 @@ func (h *OrderHandler) CheckoutHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	userID, _ := uuid.Parse(claims.UserID)
 
+	if h.RequireVerifiedEmail {
+		var verified bool
+		err := h.DB.QueryRow(r.Context(), `SELECT email_verified_at IS NOT NULL FROM users WHERE id = $1`, userID).Scan(&verified)
+		if err != nil {
+			http.Error(w, "Failed to start checkout process", http.StatusInternalServerError)
+			return
+		}
+		if !verified {
+			http.Error(w, "Please verify your email address before checking out", http.StatusForbidden)
+			return
+		}
+	}
+
 	tx, err := h.DB.Begin(r.Context())
 	if err != nil {
 		http.Error(w, "Failed to start checkout process", http.StatusInternalServerError)
@@ -32,11 +52,32 @@ func (h *OrderHandler) CheckoutHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer tx.Rollback(r.Context())
 
+	// Variants are locked first and then products, in a fixed order, so
+	// concurrent checkouts can't deadlock on each other's rows.
+	lockVariantsQuery := `
+		SELECT v.id
+		FROM cart_items c
+		JOIN product_variants v ON c.variant_id = v.id
+		WHERE c.user_id = $1
+		ORDER BY v.id
+		FOR UPDATE OF v
+	`
+	if _, err := tx.Exec(r.Context(), lockVariantsQuery, userID); err != nil {
+		http.Error(w, "Error reading cart", http.StatusInternalServerError)
+		return
+	}
+
 	queryCart := `
-		SELECT c.product_id, c.quantity, p.price, p.stock_quantity
+		SELECT
+			c.product_id, c.variant_id, v.sku, c.quantity,
+			COALESCE(v.price, p.price), COALESCE(v.stock_quantity, p.stock_quantity),
+			c.variant_id IS NULL AND EXISTS (SELECT 1 FROM product_variants pv WHERE pv.product_id = p.id),
+			p.status = 'active'
 		FROM cart_items c
 		JOIN products p ON c.product_id = p.id
+		LEFT JOIN product_variants v ON c.variant_id = v.id
 		WHERE c.user_id = $1
+		ORDER BY p.id
 		FOR UPDATE OF p; 
 	`
 	rows, err := tx.Query(r.Context(), queryCart, userID)
@@ -47,6 +88,8 @@ func (h *OrderHandler) CheckoutHandler(w http.ResponseWriter, r *http.Request) {
 
 	type checkoutItem struct {
 		ProductID uuid.UUID
+		VariantID *uuid.UUID
+		SKU       *string
 		Quantity  int
 		Price     int
 		Stock     int
@@ -56,12 +99,29 @@ func (h *OrderHandler) CheckoutHandler(w http.ResponseWriter, r *http.Request) {
 
 	for rows.Next() {
 		var item checkoutItem
-		if err := rows.Scan(&item.ProductID, &item.Quantity, &item.Price, &item.Stock); err != nil {
+		var needsVariant, available bool
+		if err := rows.Scan(&item.ProductID, &item.VariantID, &item.SKU, &item.Quantity, &item.Price, &item.Stock, &needsVariant, &available); err != nil {
 			rows.Close()
 			http.Error(w, "Error parsing cart items", http.StatusInternalServerError)
 			return
 		}
 
+		// Products archived or taken back to draft after they went into the
+		// cart can't be bought until they are removed from it.
+		if !available {
+			rows.Close()
+			http.Error(w, "One or more cart items are no longer available", http.StatusConflict)
+			return
+		}
+
+		// Variants added to a product after it went into the cart leave
+		// the line without a price or stock to check out against.
+		if needsVariant {
+			rows.Close()
+			http.Error(w, "One or more cart items need a variant to be chosen", http.StatusConflict)
+			return
+		}
+
 		if item.Quantity > item.Stock {
 			rows.Close()
 			http.Error(w, "Insufficient stock for one or more items", http.StatusConflict)
@@ -91,19 +151,25 @@ func (h *OrderHandler) CheckoutHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	insertOrderItemQuery := `
-		INSERT INTO order_items (order_id, product_id, quantity, price_at_purchase)
-		VALUES ($1, $2, $3, $4)
-	`
-	updateStockQuery := `
-		UPDATE products SET stock_quantity = stock_quantity - $1 WHERE id = $2
+		INSERT INTO order_items (order_id, product_id, variant_id, sku, quantity, price_at_purchase)
+		VALUES ($1, $2, $3, $4, $5, $6)
 	`
 
 	for _, item := range items {
-		if _, err := tx.Exec(r.Context(), insertOrderItemQuery, orderID, item.ProductID, item.Quantity, item.Price); err != nil {
+		if _, err := tx.Exec(r.Context(), insertOrderItemQuery, orderID, item.ProductID, item.VariantID, item.SKU, item.Quantity, item.Price); err != nil {
 			http.Error(w, "Failed to save order details", http.StatusInternalServerError)
 			return
 		}
-		if _, err := tx.Exec(r.Context(), updateStockQuery, item.Quantity, item.ProductID); err != nil {
+
+		_, err := adjustStock(r.Context(), tx, stockMovement{
+			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			Type:      movementCheckout,
+			Delta:     -item.Quantity,
+			ActorID:   &userID,
+			OrderID:   &orderID,
+		})
+		if err != nil {
 			http.Error(w, "Failed to update inventory", http.StatusInternalServerError)
 			return
 		}
@@ -138,18 +204,63 @@ func (h *OrderHandler) GetOrderHistoryHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	query := `
+	limit := 20
+	page := 1
+
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsedLimit, err := strconv.Atoi(l); err == nil && parsedLimit > 0 && parsedLimit <= 100 {
+			limit = parsedLimit
+		}
+	}
+
+	if p := r.URL.Query().Get("page"); p != "" {
+		if parsedPage, err := strconv.Atoi(p); err == nil && parsedPage > 1 {
+			page = parsedPage
+		}
+	}
+
+	cursor, ok := parseCursor(w, r, h.Cursors, cursorScopeOrders)
+	if !ok {
+		return
+	}
+	useCursor := r.URL.Query().Get("page") == ""
+
+	// The page is picked from orders first so that limit counts orders
+	// rather than order items.
+	where := "user_id = $1"
+	args := []any{claims.UserID}
+	var limitClause string
+	if useCursor {
+		if cursor != nil {
+			where += " AND " + cursor.Where("created_at", "id", len(args)+1)
+			args = append(args, cursor.Args()...)
+		}
+		args = append(args, limit+1)
+		limitClause = fmt.Sprintf("LIMIT $%d", len(args))
+	} else {
+		args = append(args, limit, (page-1)*limit)
+		limitClause = fmt.Sprintf("LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	}
+	orderBy := pagination.OrderBy(cursor, "created_at", "id")
+
+	query := fmt.Sprintf(`
+		WITH page AS (
+			SELECT id, total_amount, status, created_at
+			FROM orders
+			WHERE %s
+			ORDER BY %s
+			%s
+		)
 		SELECT 
 			o.id, o.total_amount, o.status, o.created_at,
-			oi.product_id, p.name, oi.quantity, oi.price_at_purchase
-		FROM orders o
+			oi.product_id, p.name, oi.variant_id::text, oi.sku, oi.quantity, oi.price_at_purchase
+		FROM page o
 		JOIN order_items oi ON o.id = oi.order_id
 		JOIN products p ON oi.product_id = p.id
-		WHERE o.user_id = $1
-		ORDER BY o.created_at DESC, o.id
-	`
+		ORDER BY %s
+	`, where, orderBy, limitClause, pagination.OrderBy(cursor, "o.created_at", "o.id"))
 
-	rows, err := h.DB.Query(r.Context(), query, claims.UserID)
+	rows, err := h.DB.Query(r.Context(), query, args...)
 	if err != nil {
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
@@ -161,11 +272,12 @@ func (h *OrderHandler) GetOrderHistoryHandler(w http.ResponseWriter, r *http.Req
 	for rows.Next() {
 		var orderID, status, productID, productName string
 		var totalAmount, quantity, priceAtPurchase int
+		var variantID, sku *string
 		var createdAt time.Time
 
 		if err := rows.Scan(
 			&orderID, &totalAmount, &status, &createdAt,
-			&productID, &productName, &quantity, &priceAtPurchase,
+			&productID, &productName, &variantID, &sku, &quantity, &priceAtPurchase,
 		); err != nil {
 			http.Error(w, "Error reading order history", http.StatusInternalServerError)
 			return
@@ -185,6 +297,8 @@ func (h *OrderHandler) GetOrderHistoryHandler(w http.ResponseWriter, r *http.Req
 		item := models.OrderHistoryItemResponse{
 			ProductID:       productID,
 			ProductName:     productName,
+			VariantID:       variantID,
+			SKU:             sku,
 			Quantity:        quantity,
 			PriceAtPurchase: priceAtPurchase,
 		}
@@ -198,9 +312,23 @@ func (h *OrderHandler) GetOrderHistoryHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	resp := models.OrderHistoryListResponse{Limit: limit}
+	if useCursor {
+		resp.Orders, resp.NextCursor, resp.PrevCursor = pagination.Paginate(
+			cursorSigner(h.Cursors), cursorScopeOrders, cursor, history, limit,
+			func(o models.OrderHistoryResponse) (time.Time, uuid.UUID) {
+				return o.CreatedAt, uuid.MustParse(o.OrderID)
+			},
+		)
+		setPageLinks(w, r, resp.NextCursor, resp.PrevCursor)
+	} else {
+		resp.Orders = history
+		resp.Page = page
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(history)
+	json.NewEncoder(w).Encode(resp)
 }
 
 var validStatuses = map[string]bool{
@@ -230,16 +358,53 @@ func (h *OrderHandler) UpdateOrderStatusHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	query := `UPDATE orders SET status = $1 WHERE id = $2`
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, "Database error while updating order", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
 
-	cmdTag, err := h.DB.Exec(r.Context(), query, req.Status, orderID)
+	var currentStatus string
+	err = tx.QueryRow(r.Context(), `SELECT status FROM orders WHERE id = $1 FOR UPDATE`, orderID).Scan(&currentStatus)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Order not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Database error while updating order", http.StatusInternalServerError)
+		return
+	}
+
+	// A cancelled order's stock has been put back, so it stays cancelled.
+	if currentStatus == "cancelled" && req.Status != "cancelled" {
+		http.Error(w, "Cancelled orders can't change status", http.StatusConflict)
+		return
+	}
+
+	// Once an order has shipped its stock has left the warehouse, so it
+	// can't be cancelled; anything sent back is recorded as a return
+	// adjustment instead.
+	if req.Status == "cancelled" && (currentStatus == "shipped" || currentStatus == "delivered") {
+		http.Error(w, "Shipped orders can't be cancelled; record a return stock adjustment instead", http.StatusConflict)
+		return
+	}
+
+	if req.Status == "cancelled" && currentStatus != "cancelled" {
+		if !h.restockOrder(w, r, tx, orderID) {
+			return
+		}
+	}
+
+	query := `UPDATE orders SET status = $1 WHERE id = $2`
+
+	if _, err := tx.Exec(r.Context(), query, req.Status, orderID); err != nil {
 		http.Error(w, "Database error while updating order", http.StatusInternalServerError)
 		return
 	}
 
-	if cmdTag.RowsAffected() == 0 {
-		http.Error(w, "Order not found", http.StatusNotFound)
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, "Database error while updating order", http.StatusInternalServerError)
 		return
 	}
 
@@ -249,3 +414,47 @@ func (h *OrderHandler) UpdateOrderStatusHandler(w http.ResponseWriter, r *http.R
 		"message": "Order status updated to " + req.Status,
 	})
 }
+
+// restockOrder puts the stock of a cancelled order's items back. Variants
+// are locked before products, by ID, in the same order as checkout. It
+// writes a 500 and returns false on failure.
+func (h *OrderHandler) restockOrder(w http.ResponseWriter, r *http.Request, tx pgx.Tx, orderID uuid.UUID) bool {
+	rows, err := tx.Query(r.Context(), `
+		SELECT product_id, variant_id, quantity
+		FROM order_items
+		WHERE order_id = $1
+		ORDER BY variant_id IS NULL, variant_id, product_id
+	`, orderID)
+	if err != nil {
+		http.Error(w, "Failed to restock order", http.StatusInternalServerError)
+		return false
+	}
+
+	var movements []stockMovement
+	for rows.Next() {
+		m := stockMovement{
+			Type:    movementCancellation,
+			ActorID: requestActor(r),
+			OrderID: &orderID,
+		}
+		if err := rows.Scan(&m.ProductID, &m.VariantID, &m.Delta); err != nil {
+			rows.Close()
+			http.Error(w, "Failed to restock order", http.StatusInternalServerError)
+			return false
+		}
+		movements = append(movements, m)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		http.Error(w, "Failed to restock order", http.StatusInternalServerError)
+		return false
+	}
+
+	for _, m := range movements {
+		if _, err := adjustStock(r.Context(), tx, m); err != nil {
+			http.Error(w, "Failed to restock order", http.StatusInternalServerError)
+			return false
+		}
+	}
+	return true
+}
@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
 	"ecommerce-api-v2/internal/middleware"
+	"ecommerce-api-v2/internal/models"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -66,3 +69,159 @@ func TestCheckoutHandler_StockRollback(t *testing.T) {
 		t.Errorf("CRITICAL FAILURE: Transaction didn't roll back! Cart was emptied despite the error.")
 	}
 }
+
+func TestCheckoutHandler_RequiresVerifiedEmail(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	handler := &OrderHandler{DB: db, RequireVerifiedEmail: true}
+
+	userID := uuid.New()
+	productID := uuid.New()
+
+	db.Exec(context.Background(), `
+		INSERT INTO users (id, email, password_hash, role) 
+		VALUES ($1, 'unverified@example.com', 'hash', 'customer')
+	`, userID)
+
+	db.Exec(context.Background(), `
+		INSERT INTO products (id, name, price, stock_quantity) 
+		VALUES ($1, 'Mug', 1500, 10)
+	`, productID)
+
+	db.Exec(context.Background(), `
+		INSERT INTO cart_items (user_id, product_id, quantity) 
+		VALUES ($1, $2, 1)
+	`, userID, productID)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/checkout", nil)
+	ctx := context.WithValue(req.Context(), middleware.UserContextKey, middleware.UserClaims{
+		UserID: userID.String(),
+		Role:   "customer",
+	})
+	req = req.WithContext(ctx)
+
+	w := httptest.NewRecorder()
+	handler.CheckoutHandler(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 Forbidden for unverified user, got %d", w.Code)
+	}
+
+	var orderCount int
+	db.QueryRow(context.Background(), "SELECT COUNT(*) FROM orders WHERE user_id = $1", userID).Scan(&orderCount)
+	if orderCount != 0 {
+		t.Errorf("Expected no order to be created for unverified user, found %d", orderCount)
+	}
+}
+
+func TestGetOrderHistoryHandler_CursorPagination(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	handler := &OrderHandler{DB: db}
+
+	userID := uuid.New()
+	productID := uuid.New()
+
+	db.Exec(context.Background(), `
+		INSERT INTO users (id, email, password_hash, role)
+		VALUES ($1, 'history@example.com', 'hash', 'customer')
+	`, userID)
+
+	db.Exec(context.Background(), `
+		INSERT INTO products (id, name, price, stock_quantity)
+		VALUES ($1, 'Notebook', 300, 100)
+	`, productID)
+
+	// Three orders a minute apart, each with two items.
+	db.Exec(context.Background(), `
+		WITH o AS (
+			INSERT INTO orders (user_id, total_amount, status, created_at)
+			SELECT $1, 600, 'pending', NOW() - n * INTERVAL '1 minute' FROM generate_series(1, 3) n
+			RETURNING id
+		)
+		INSERT INTO order_items (order_id, product_id, quantity, price_at_purchase)
+		SELECT o.id, $2, 1, 300 FROM o, generate_series(1, 2)
+	`, userID, productID)
+
+	history := func(query string) models.OrderHistoryListResponse {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handler.GetOrderHistoryHandler(w, withUser(httptest.NewRequest(http.MethodGet, "/api/v1/orders?"+query, nil), userID))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200 OK, got %d", w.Code)
+		}
+		var resp models.OrderHistoryListResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		return resp
+	}
+
+	first := history("limit=2")
+	if len(first.Orders) != 2 || len(first.Orders[0].Items) != 2 || first.NextCursor == "" || first.PrevCursor != "" {
+		t.Fatalf("Expected 2 whole orders and a next cursor, got %+v", first)
+	}
+
+	second := history("limit=2&cursor=" + first.NextCursor)
+	if len(second.Orders) != 1 || second.NextCursor != "" || second.PrevCursor == "" {
+		t.Fatalf("Expected the last order and a prev cursor, got %+v", second)
+	}
+
+	back := history("limit=2&cursor=" + second.PrevCursor)
+	if len(back.Orders) != 2 || back.Orders[0].OrderID != first.Orders[0].OrderID || back.PrevCursor != "" {
+		t.Errorf("Expected going back to return the first page, got %+v", back)
+	}
+
+	w := httptest.NewRecorder()
+	handler.GetOrderHistoryHandler(w, withUser(httptest.NewRequest(http.MethodGet, "/api/v1/orders?cursor=bogus", nil), userID))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a forged cursor, got %d", w.Code)
+	}
+}
+
+func TestUpdateOrderStatusHandler_ShippedOrdersCantBeCancelled(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	handler := &OrderHandler{DB: db}
+
+	userID := uuid.New()
+	productID := uuid.New()
+	db.Exec(context.Background(), `
+		INSERT INTO users (id, email, password_hash, role)
+		VALUES ($1, 'shipped@example.com', 'hash', 'customer')
+	`, userID)
+	db.Exec(context.Background(), `
+		INSERT INTO products (id, name, price, stock_quantity)
+		VALUES ($1, 'Kettle', 8000, 5)
+	`, productID)
+	db.Exec(context.Background(), `
+		INSERT INTO cart_items (user_id, product_id, quantity) VALUES ($1, $2, 2)
+	`, userID, productID)
+
+	w := httptest.NewRecorder()
+	handler.CheckoutHandler(w, withUser(httptest.NewRequest(http.MethodPost, "/api/v1/checkout", nil), userID))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected checkout to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	var order models.CheckoutResponse
+	json.NewDecoder(w.Body).Decode(&order)
+
+	setStatus := func(status string) int {
+		t.Helper()
+		body, _ := json.Marshal(models.UpdateOrderStatusRequest{Status: status})
+		r := httptest.NewRequest(http.MethodPut, "/api/v1/orders/"+order.OrderID+"/status", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.UpdateOrderStatusHandler(w, withURLParam(r, "id", order.OrderID))
+		return w.Code
+	}
+	if code := setStatus("shipped"); code != http.StatusOK {
+		t.Fatalf("Expected the order to be shipped, got %d", code)
+	}
+	if code := setStatus("cancelled"); code != http.StatusConflict {
+		t.Errorf("Expected 409 when cancelling a shipped order, got %d", code)
+	}
+
+	var stock int
+	db.QueryRow(context.Background(), `SELECT stock_quantity FROM products WHERE id = $1`, productID).Scan(&stock)
+	if stock != 3 {
+		t.Errorf("Expected a shipped order's stock not to be put back, got %d", stock)
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"ecommerce-api-v2/internal/pagination"
+	"net/http"
+	"strings"
+)
+
+// Cursor scopes keep a cursor from one list from being used on another.
+const (
+	cursorScopeProducts       = "products"
+	cursorScopeOrders         = "orders"
+	cursorScopeUsers          = "admin_users"
+	cursorScopeStockMovements = "stock_movements"
+)
+
+// cursorSigner returns s, or the per-process default signer when the
+// handler wasn't given one.
+func cursorSigner(s *pagination.Signer) *pagination.Signer {
+	if s != nil {
+		return s
+	}
+	return pagination.DefaultSigner()
+}
+
+// parseCursor reads the cursor query parameter. It returns nil when there
+// is none, or writes a 400 and returns false if the cursor isn't valid
+// for scope. A cursor can't be combined with page.
+func parseCursor(w http.ResponseWriter, r *http.Request, s *pagination.Signer, scope string) (*pagination.Cursor, bool) {
+	token := r.URL.Query().Get("cursor")
+	if token == "" {
+		return nil, true
+	}
+
+	if r.URL.Query().Get("page") != "" {
+		http.Error(w, "Use either cursor or page, not both", http.StatusBadRequest)
+		return nil, false
+	}
+
+	c, err := cursorSigner(s).Decode(scope, token)
+	if err != nil {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return nil, false
+	}
+	return &c, true
+}
+
+// setPageLinks sets a Link header with the next and previous pages of the
+// request's list, keeping its other query parameters.
+func setPageLinks(w http.ResponseWriter, r *http.Request, next, prev string) {
+	var links []string
+	for _, l := range []struct{ rel, cursor string }{{"next", next}, {"prev", prev}} {
+		if l.cursor == "" {
+			continue
+		}
+		q := r.URL.Query()
+		q.Set("cursor", l.cursor)
+		links = append(links, `<`+r.URL.Path+`?`+q.Encode()+`>; rel="`+l.rel+`"`)
+	}
+
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
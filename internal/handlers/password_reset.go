@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"context"
+	"ecommerce-api-v2/internal/models"
+	"ecommerce-api-v2/internal/notifier"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const passwordResetTTL = time.Hour
+
+// sendPasswordReset issues a new reset token for the user and emails it.
+func (h *UserHandler) sendPasswordReset(ctx context.Context, userID uuid.UUID, email string) error {
+	token, err := generateToken()
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`
+	if _, err := h.DB.Exec(ctx, query, userID, hashToken(token), time.Now().Add(passwordResetTTL)); err != nil {
+		return err
+	}
+
+	h.notify(ctx, notifier.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body:    "Use the following token to reset your password. It expires in 1 hour.\n\n" + token,
+	})
+
+	return nil
+}
+
+func (h *UserHandler) RequestPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.PasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+	if req.Email == "" {
+		http.Error(w, "Email can't be empty", http.StatusBadRequest)
+		return
+	}
+
+	// The response is the same whether or not the account exists, and the
+	// lookup, token and email all happen after it is sent, so that neither
+	// the body nor the response time reveals which emails are registered.
+	email := req.Email
+	h.runInBackground(r.Context(), func(ctx context.Context) {
+		var userID uuid.UUID
+		err := h.DB.QueryRow(ctx, `SELECT id FROM users WHERE email = $1`, email).Scan(&userID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return
+		}
+		if err == nil {
+			err = h.sendPasswordReset(ctx, userID, email)
+		}
+		if err != nil {
+			log.Printf("Failed to send password reset: %v", err)
+		}
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "If an account with that email exists, a reset token has been sent",
+	})
+}
+
+func (h *UserHandler) ConfirmPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.ConfirmPasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	req.Token = strings.TrimSpace(req.Token)
+	if req.Token == "" || req.NewPassword == "" {
+		http.Error(w, "Token or new password can't be empty", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, "Could not reset password", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	query := `
+		SELECT id, user_id, expires_at, used_at
+		FROM password_reset_tokens
+		WHERE token_hash = $1
+		FOR UPDATE
+	`
+
+	var tokenID, userID uuid.UUID
+	var expiresAt time.Time
+	var usedAt *time.Time
+
+	err = tx.QueryRow(r.Context(), query, hashToken(req.Token)).Scan(&tokenID, &userID, &expiresAt, &usedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Could not reset password", http.StatusInternalServerError)
+		return
+	}
+
+	if usedAt != nil || time.Now().After(expiresAt) {
+		http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	}
+
+	var email string
+	if err := tx.QueryRow(r.Context(), `SELECT email FROM users WHERE id = $1`, userID).Scan(&email); err != nil {
+		http.Error(w, "Could not reset password", http.StatusInternalServerError)
+		return
+	}
+
+	if !h.checkPasswordPolicy(w, r, req.NewPassword, email) {
+		return
+	}
+
+	hashedPassword, err := h.hasher().Hash(req.NewPassword)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := tx.Exec(r.Context(), `UPDATE users SET password_hash = $1 WHERE id = $2`, hashedPassword, userID); err != nil {
+		http.Error(w, "Could not reset password", http.StatusInternalServerError)
+		return
+	}
+
+	// Every outstanding reset token for the user is spent, not just this one.
+	markUsedQuery := `UPDATE password_reset_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`
+	if _, err := tx.Exec(r.Context(), markUsedQuery, userID); err != nil {
+		http.Error(w, "Could not reset password", http.StatusInternalServerError)
+		return
+	}
+
+	revokeQuery := `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	if _, err := tx.Exec(r.Context(), revokeQuery, userID); err != nil {
+		http.Error(w, "Could not reset password", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, "Could not reset password", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Password has been reset successfully",
+	})
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"ecommerce-api-v2/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPasswordReset_Flow(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	notes := &recordingNotifier{}
+	handler := &UserHandler{DB: db, Keys: testKeySet(t), Notifier: notes}
+
+	loginTestUser(t, handler, "forgetful@example.com", "oldpassword123")
+
+	reqBody, _ := json.Marshal(models.PasswordResetRequest{Email: "forgetful@example.com"})
+	reqReset := httptest.NewRequest(http.MethodPost, "/api/v1/users/password-reset/request", bytes.NewReader(reqBody))
+	wReset := httptest.NewRecorder()
+	handler.RequestPasswordResetHandler(wReset, reqReset)
+
+	if wReset.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK for reset request, got %d", wReset.Code)
+	}
+
+	handler.background.Wait()
+	token := notes.lastToken()
+	if token == "" {
+		t.Fatalf("Expected a reset token to be sent through the notifier")
+	}
+
+	confirm := func() *httptest.ResponseRecorder {
+		body, _ := json.Marshal(models.ConfirmPasswordResetRequest{Token: token, NewPassword: "newpassword456"})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/users/password-reset/confirm", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.ConfirmPasswordResetHandler(w, req)
+		return w
+	}
+
+	if w := confirm(); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK for reset confirmation, got %d", w.Code)
+	}
+
+	if w := confirm(); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected reset token to be single-use, got %d on second use", w.Code)
+	}
+
+	var active int
+	db.QueryRow(context.Background(), "SELECT COUNT(*) FROM sessions WHERE revoked_at IS NULL").Scan(&active)
+	if active != 0 {
+		t.Errorf("Expected existing sessions to be revoked after reset, found %d active", active)
+	}
+
+	loginBody, _ := json.Marshal(models.LoginUserRequest{Email: "forgetful@example.com", Password: "newpassword456"})
+	reqLogin := httptest.NewRequest(http.MethodPost, "/api/v1/users/login", bytes.NewReader(loginBody))
+	wLogin := httptest.NewRecorder()
+	handler.LoginUserHandler(wLogin, reqLogin)
+
+	if wLogin.Code != http.StatusOK {
+		t.Errorf("Expected login with new password to succeed, got %d", wLogin.Code)
+	}
+}
+
+func TestPasswordReset_UnknownEmail(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	notes := &recordingNotifier{}
+	handler := &UserHandler{DB: db, Notifier: notes}
+
+	reqBody, _ := json.Marshal(models.PasswordResetRequest{Email: "nobody@example.com"})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/password-reset/request", bytes.NewReader(reqBody))
+	w := httptest.NewRecorder()
+	handler.RequestPasswordResetHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected 200 OK so account existence isn't leaked, got %d", w.Code)
+	}
+	handler.background.Wait()
+	if _, sent := notes.last(); sent {
+		t.Errorf("Expected no message to be sent for an unknown email")
+	}
+}
@@ -1,21 +1,161 @@
 package handlers
 
 import (
+	"context"
 	"ecommerce-api-v2/internal/models"
+	"ecommerce-api-v2/internal/pagination"
+	"ecommerce-api-v2/internal/storage"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type ProductHandler struct {
-	DB *pgxpool.Pool
+	DB      *pgxpool.Pool
+	Cursors *pagination.Signer
+	// Storage holds product images; uploads are refused when it is nil.
+	Storage storage.Storage
+	// MaxImageBytes caps the size of an uploaded image, 10 MiB by default.
+	MaxImageBytes int64
+
+	importWake chan struct{}
+}
+
+// productImagesColumn loads a product's images in display order as JSON.
+// Their url and thumbnails hold storage keys until resolveImageURLs turns
+// them into URLs.
+const productImagesColumn = `
+	COALESCE((
+		SELECT json_agg(json_build_object(
+			'id', pi.id, 'variant_id', pi.variant_id, 'url', pi.original_key, 'thumbnails', pi.thumbnail_keys,
+			'width', pi.width, 'height', pi.height, 'alt_text', pi.alt_text
+		) ORDER BY pi.position, pi.created_at)
+		FROM product_images pi
+		WHERE pi.product_id = products.id
+	), '[]')
+`
+
+const productColumns = `
+	id, sku, name, description, price, stock_quantity,
+	ARRAY(SELECT category_id::text FROM product_categories WHERE product_id = products.id ORDER BY category_id),
+	created_at, status, deleted_at,` + productImagesColumn
+
+// scanProduct scans productColumns into p, followed by any extra columns
+// the query selects.
+func scanProduct(row pgx.Row, p *models.GetProductResponse, extra ...any) error {
+	dest := append([]any{&p.ID, &p.SKU, &p.Name, &p.Description, &p.Price, &p.StockQuantity, &p.CategoryIDs, &p.CreatedAt, &p.Status, &p.DeletedAt, &p.Images}, extra...)
+	return row.Scan(dest...)
+}
+
+// parseCategoryIDs parses the category IDs of a product request. It
+// returns nil when the request left them out, or writes a 400 and returns
+// false if any ID is malformed.
+func parseCategoryIDs(w http.ResponseWriter, ids []string) ([]uuid.UUID, bool) {
+	if ids == nil {
+		return nil, true
+	}
+
+	parsed := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		categoryID, err := uuid.Parse(id)
+		if err != nil {
+			http.Error(w, "Invalid category ID format", http.StatusBadRequest)
+			return nil, false
+		}
+		parsed = append(parsed, categoryID)
+	}
+	return parsed, true
+}
+
+// setProductCategories replaces the categories a product is assigned to.
+func setProductCategories(ctx context.Context, tx pgx.Tx, productID uuid.UUID, categoryIDs []uuid.UUID) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM product_categories WHERE product_id = $1`, productID); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO product_categories (product_id, category_id)
+		SELECT $1, unnest($2::uuid[])
+		ON CONFLICT DO NOTHING
+	`
+	_, err := tx.Exec(ctx, query, productID, categoryIDs)
+	return err
+}
+
+// Products start out as drafts or active. Archiving is done by deleting
+// the product, and undone by restoring it.
+const (
+	productStatusDraft    = "draft"
+	productStatusActive   = "active"
+	productStatusArchived = "archived"
+)
+
+// productDetailsValid applies the rules every product must satisfy,
+// whether it is created through the API or imported in bulk.
+func productDetailsValid(req *models.CreateProductRequest) bool {
+	return req.Name != "" && req.Price > 0 && req.StockQuantity >= 0
+}
+
+// productStatusValid reports whether a product request may set status,
+// which only moves a product between draft and active. Empty means the
+// default or the current status.
+func productStatusValid(status string) bool {
+	switch status {
+	case "", productStatusDraft, productStatusActive:
+		return true
+	}
+	return false
+}
+
+// validateProductStatus writes a 400 and returns false if the status of a
+// product request isn't allowed.
+func validateProductStatus(w http.ResponseWriter, status string) bool {
+	if !productStatusValid(status) {
+		http.Error(w, "Invalid status. Allowed values: draft, active", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// validateProductSKU trims the SKU of a product request, which is
+// optional. It writes a 400 and returns false if the SKU is malformed.
+func validateProductSKU(w http.ResponseWriter, req *models.CreateProductRequest) bool {
+	req.SKU = strings.TrimSpace(req.SKU)
+	if req.SKU != "" && !validSKU.MatchString(req.SKU) {
+		http.Error(w, "SKU may only contain letters, digits, '.', '_' and '-' (max 64)", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// productWriteError maps a failed insert or update of a product to a
+// response.
+func productWriteError(w http.ResponseWriter, err error, fallback string) {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "products_sku_key" {
+		http.Error(w, "SKU already in use", http.StatusConflict)
+		return
+	}
+	http.Error(w, fallback, http.StatusInternalServerError)
+}
+
+func productCategoriesError(w http.ResponseWriter, err error, fallback string) {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		http.Error(w, "Category not found", http.StatusBadRequest)
+		return
+	}
+	http.Error(w, fallback, http.StatusInternalServerError)
 }
 
 func (h *ProductHandler) CreateProductHandler(w http.ResponseWriter, r *http.Request) {
@@ -26,19 +166,38 @@ func (h *ProductHandler) CreateProductHandler(w http.ResponseWriter, r *http.Req
 	}
 
 	req.Name = strings.TrimSpace(req.Name)
-	if req.Name == "" || req.Price <= 0 || req.StockQuantity < 0 {
+	if !productDetailsValid(&req) {
 		http.Error(w, "Invalid product details: name is required, price must be > 0, stock cannot be negative", http.StatusBadRequest)
 		return
 	}
 
+	if !validateProductStatus(w, req.Status) || !validateProductSKU(w, &req) {
+		return
+	}
+	if req.Status == "" {
+		req.Status = productStatusActive
+	}
+
+	categoryIDs, ok := parseCategoryIDs(w, req.CategoryIDs)
+	if !ok {
+		return
+	}
+
 	productID := uuid.New()
 
 	query := `
-		INSERT INTO products (id, name, description, price, stock_quantity)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO products (id, name, description, price, stock_quantity, status, sku)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))
 	`
 
-	_, err := h.DB.Exec(
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, "Could not create product", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	_, err = tx.Exec(
 		r.Context(),
 		query,
 		productID,
@@ -46,9 +205,37 @@ func (h *ProductHandler) CreateProductHandler(w http.ResponseWriter, r *http.Req
 		req.Description,
 		req.Price,
 		req.StockQuantity,
+		req.Status,
+		req.SKU,
 	)
 
 	if err != nil {
+		productWriteError(w, err, "Could not create product")
+		return
+	}
+
+	if req.StockQuantity > 0 {
+		_, err := recordStockMovement(r.Context(), tx, stockMovement{
+			ProductID: productID,
+			Type:      movementAdjustment,
+			Delta:     req.StockQuantity,
+			Reason:    "Initial stock",
+			ActorID:   requestActor(r),
+		}, req.StockQuantity)
+		if err != nil {
+			http.Error(w, "Could not create product", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if categoryIDs != nil {
+		if err := setProductCategories(r.Context(), tx, productID, categoryIDs); err != nil {
+			productCategoriesError(w, err, "Could not create product")
+			return
+		}
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
 		http.Error(w, "Could not create product", http.StatusInternalServerError)
 		return
 	}
@@ -61,9 +248,69 @@ func (h *ProductHandler) CreateProductHandler(w http.ResponseWriter, r *http.Req
 	})
 }
 
+// A product with variants is sold at its variants' prices and from their
+// stock, so listings treat its price as the lowest variant price and its
+// stock as the variants' combined stock.
+const (
+	productPriceExpr = `COALESCE((SELECT MIN(v.price) FROM product_variants v WHERE v.product_id = products.id), price)`
+	productStockExpr = `COALESCE((SELECT SUM(v.stock_quantity) FROM product_variants v WHERE v.product_id = products.id), stock_quantity)`
+)
+
+// productSorts maps the allowed values of the sort parameter to ORDER BY
+// clauses, each ending in id so pages don't overlap or skip rows.
+// Popularity counts units sold on orders that weren't cancelled.
+// "relevance" is handled separately since it needs the search query.
+var productSorts = map[string]string{
+	"newest":     "created_at DESC, id DESC",
+	"price_asc":  productPriceExpr + " ASC, id",
+	"price_desc": productPriceExpr + " DESC, id",
+	"name_asc":   "name ASC, id",
+	"name_desc":  "name DESC, id",
+	"popularity": `(
+		SELECT COALESCE(SUM(oi.quantity), 0)
+		FROM order_items oi
+		JOIN orders o ON oi.order_id = o.id
+		WHERE oi.product_id = products.id AND o.status <> 'cancelled'
+	) DESC, created_at DESC, id`,
+}
+
+// parsePriceParam reads a non-negative price from the query string. It
+// returns nil if the parameter is absent, or writes a 400 and returns false
+// if it isn't a valid price.
+func parsePriceParam(w http.ResponseWriter, r *http.Request, name string) (*int, bool) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return nil, true
+	}
+
+	price, err := strconv.Atoi(v)
+	if err != nil || price < 0 {
+		http.Error(w, "Invalid "+name+": must be a non-negative integer", http.StatusBadRequest)
+		return nil, false
+	}
+	return &price, true
+}
+
+// GetProductsHandler lists active products a page at a time. Results can
+// be narrowed by search, category, price, stock and variant attributes
+// (attr.<name>=<value>), and ordered by any of productSorts.
+//
+// Newest-first listings are paged with cursors unless a page number is
+// given; other sorts are paged by number.
 func (h *ProductHandler) GetProductsHandler(w http.ResponseWriter, r *http.Request) {
+	h.listProducts(w, r, false)
+}
+
+// AdminListProductsHandler lists products like GetProductsHandler, but
+// includes drafts and archived products. A status parameter narrows the
+// list to one status.
+func (h *ProductHandler) AdminListProductsHandler(w http.ResponseWriter, r *http.Request) {
+	h.listProducts(w, r, true)
+}
+
+func (h *ProductHandler) listProducts(w http.ResponseWriter, r *http.Request, admin bool) {
 	limit := 20
-	offset := 0
+	page := 1
 
 	if l := r.URL.Query().Get("limit"); l != "" {
 		if parsedLimit, err := strconv.Atoi(l); err == nil && parsedLimit > 0 && parsedLimit <= 100 {
@@ -73,18 +320,208 @@ func (h *ProductHandler) GetProductsHandler(w http.ResponseWriter, r *http.Reque
 
 	if p := r.URL.Query().Get("page"); p != "" {
 		if parsedPage, err := strconv.Atoi(p); err == nil && parsedPage > 1 {
-			offset = (parsedPage - 1) * limit
+			page = parsedPage
 		}
 	}
 
-	query := `
-		SELECT id, name, description, price, stock_quantity 
+	var filters models.ProductFilters
+	var conditions []string
+	var args []any
+	headline := "NULL::text"
+	var tsqueryArg int
+
+	status := r.URL.Query().Get("status")
+	if !admin {
+		status = productStatusActive
+	} else if status != "" {
+		switch status {
+		case productStatusDraft, productStatusActive, productStatusArchived:
+			filters.Status = &status
+		default:
+			http.Error(w, "Invalid status. Allowed values: draft, active, archived", http.StatusBadRequest)
+			return
+		}
+	}
+	if status != "" {
+		args = append(args, status)
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+	}
+
+	// A category filter matches products in the category or anywhere
+	// below it in the tree.
+	if c := r.URL.Query().Get("category"); c != "" {
+		categoryID, err := resolveCategory(r.Context(), h.DB, c)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				http.Error(w, "Category not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		filters.Category = &c
+		args = append(args, categoryID)
+		conditions = append(conditions, fmt.Sprintf(`id IN (
+			WITH RECURSIVE subtree AS (
+				SELECT id FROM categories WHERE id = $%d
+				UNION
+				SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id
+			)
+			SELECT pc.product_id FROM product_categories pc JOIN subtree s ON pc.category_id = s.id
+		)`, len(args)))
+	}
+
+	if q := r.URL.Query().Get("q"); q != "" {
+		tsquery, ok := searchQuery(q)
+		if !ok {
+			http.Error(w, "Search query must contain letters or digits", http.StatusBadRequest)
+			return
+		}
+
+		filters.Query = &q
+		args = append(args, tsquery)
+		tsqueryArg = len(args)
+		conditions = append(conditions, fmt.Sprintf(`search_vector @@ to_tsquery('english', $%d)`, tsqueryArg))
+		headline = fmt.Sprintf(productSearchHeadline, tsqueryArg)
+	}
+
+	minPrice, ok := parsePriceParam(w, r, "min_price")
+	if !ok {
+		return
+	}
+	maxPrice, ok := parsePriceParam(w, r, "max_price")
+	if !ok {
+		return
+	}
+	if minPrice != nil && maxPrice != nil && *minPrice > *maxPrice {
+		http.Error(w, "min_price cannot be greater than max_price", http.StatusBadRequest)
+		return
+	}
+	if minPrice != nil {
+		filters.MinPrice = minPrice
+		args = append(args, *minPrice)
+		conditions = append(conditions, fmt.Sprintf("%s >= $%d", productPriceExpr, len(args)))
+	}
+	if maxPrice != nil {
+		filters.MaxPrice = maxPrice
+		args = append(args, *maxPrice)
+		conditions = append(conditions, fmt.Sprintf("%s <= $%d", productPriceExpr, len(args)))
+	}
+
+	switch r.URL.Query().Get("in_stock") {
+	case "", "false":
+	case "true":
+		filters.InStock = true
+		conditions = append(conditions, productStockExpr+" > 0")
+	default:
+		http.Error(w, "Invalid in_stock. Allowed values: true, false", http.StatusBadRequest)
+		return
+	}
+
+	// Attribute filters match products with a single variant that has all
+	// the given option values, and that variant must be in stock when
+	// in_stock is set.
+	for key, values := range r.URL.Query() {
+		name, found := strings.CutPrefix(key, "attr.")
+		if !found {
+			continue
+		}
+
+		name = strings.ToLower(strings.TrimSpace(name))
+		value := strings.TrimSpace(values[0])
+		if name == "" || value == "" {
+			http.Error(w, "Attribute filters must have a name and a value, e.g. attr.size=M", http.StatusBadRequest)
+			return
+		}
+		if filters.Attributes == nil {
+			filters.Attributes = make(map[string]string)
+		}
+		filters.Attributes[name] = value
+	}
+	if len(filters.Attributes) > maxVariantOptions {
+		http.Error(w, "At most 5 attribute filters are allowed", http.StatusBadRequest)
+		return
+	}
+	if filters.Attributes != nil {
+		args = append(args, filters.Attributes)
+		attrCondition := fmt.Sprintf(`EXISTS (
+			SELECT 1 FROM product_variants v
+			WHERE v.product_id = products.id AND v.options @> $%d::jsonb`, len(args))
+		if filters.InStock {
+			attrCondition += ` AND v.stock_quantity > 0`
+		}
+		conditions = append(conditions, attrCondition+`
+		)`)
+	}
+
+	sort := r.URL.Query().Get("sort")
+	if sort == "" {
+		sort = "newest"
+		if tsqueryArg > 0 {
+			sort = "relevance"
+		}
+	}
+
+	var orderBy string
+	if sort == "relevance" {
+		if tsqueryArg == 0 {
+			http.Error(w, "Sorting by relevance requires a search query", http.StatusBadRequest)
+			return
+		}
+		orderBy = fmt.Sprintf(`ts_rank_cd(search_vector, to_tsquery('english', $%d)) DESC, created_at DESC, id`, tsqueryArg)
+	} else {
+		orderBy, ok = productSorts[sort]
+		if !ok {
+			http.Error(w, "Invalid sort. Allowed values: newest, price_asc, price_desc, name_asc, name_desc, popularity, relevance", http.StatusBadRequest)
+			return
+		}
+	}
+
+	cursor, ok := parseCursor(w, r, h.Cursors, cursorScopeProducts)
+	if !ok {
+		return
+	}
+	useCursor := cursor != nil || r.URL.Query().Get("page") == "" && sort == "newest"
+	if useCursor && sort != "newest" {
+		http.Error(w, "Cursors can only be used with sort=newest", http.StatusBadRequest)
+		return
+	}
+
+	where := "TRUE"
+	if len(conditions) > 0 {
+		where = strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := h.DB.QueryRow(r.Context(), `SELECT COUNT(*) FROM products WHERE `+where, args...).Scan(&total); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	var limitClause string
+	if useCursor {
+		if cursor != nil {
+			where += " AND " + cursor.Where("created_at", "id", len(args)+1)
+			args = append(args, cursor.Args()...)
+		}
+		orderBy = pagination.OrderBy(cursor, "created_at", "id")
+		args = append(args, limit+1)
+		limitClause = fmt.Sprintf("LIMIT $%d", len(args))
+	} else {
+		args = append(args, limit, (page-1)*limit)
+		limitClause = fmt.Sprintf("LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s, %s
 		FROM products
-		ORDER BY created_at DESC 
-		LIMIT $1 OFFSET $2
-	`
+		WHERE %s
+		ORDER BY %s
+		%s
+	`, productColumns, headline, where, orderBy, limitClause)
 
-	rows, err := h.DB.Query(r.Context(), query, limit, offset)
+	rows, err := h.DB.Query(r.Context(), query, args...)
 	if err != nil {
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
@@ -95,10 +532,11 @@ func (h *ProductHandler) GetProductsHandler(w http.ResponseWriter, r *http.Reque
 
 	for rows.Next() {
 		var p models.GetProductResponse
-		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.Price, &p.StockQuantity); err != nil {
+		if err := scanProduct(rows, &p, &p.Highlight); err != nil {
 			http.Error(w, "Error fetching rows", http.StatusInternalServerError)
 			return
 		}
+		h.resolveImageURLs(p.Images)
 		products = append(products, p)
 	}
 
@@ -107,24 +545,57 @@ func (h *ProductHandler) GetProductsHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	resp := models.ProductListResponse{
+		Limit:   limit,
+		Total:   total,
+		Sort:    sort,
+		Filters: filters,
+	}
+
+	if useCursor {
+		resp.Products, resp.NextCursor, resp.PrevCursor = pagination.Paginate(
+			cursorSigner(h.Cursors), cursorScopeProducts, cursor, products, limit,
+			func(p models.GetProductResponse) (time.Time, uuid.UUID) {
+				return p.CreatedAt, uuid.MustParse(p.ID)
+			},
+		)
+		setPageLinks(w, r, resp.NextCursor, resp.PrevCursor)
+	} else {
+		resp.Products = products
+		resp.Page = page
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(products)
+	json.NewEncoder(w).Encode(resp)
 }
 
+// GetProductHandler returns a product with its variants. Archived
+// products are still returned, so links from order history keep working,
+// but drafts are not found until they are made active.
 func (h *ProductHandler) GetProductHandler(w http.ResponseWriter, r *http.Request) {
+	h.getProduct(w, r, false)
+}
+
+// AdminGetProductHandler returns a product whatever its status.
+func (h *ProductHandler) AdminGetProductHandler(w http.ResponseWriter, r *http.Request) {
+	h.getProduct(w, r, true)
+}
+
+func (h *ProductHandler) getProduct(w http.ResponseWriter, r *http.Request, admin bool) {
 	productID := chi.URLParam(r, "id")
 	if _, err := uuid.Parse(productID); err != nil {
 		http.Error(w, "Invalid product ID format", http.StatusBadRequest)
 		return
 	}
 
-	query := `SELECT id, name, description, price, stock_quantity FROM products WHERE id = $1`
+	query := `SELECT ` + productColumns + ` FROM products WHERE id = $1`
+	if !admin {
+		query += ` AND status <> 'draft'`
+	}
 	var p models.GetProductResponse
 
-	err := h.DB.QueryRow(r.Context(), query, productID).Scan(
-		&p.ID, &p.Name, &p.Description, &p.Price, &p.StockQuantity,
-	)
+	err := scanProduct(h.DB.QueryRow(r.Context(), query, productID), &p)
 
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -135,6 +606,18 @@ func (h *ProductHandler) GetProductHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	h.resolveImageURLs(p.Images)
+
+	variants, err := getProductVariants(r.Context(), h.DB, productID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if len(variants) > 0 {
+		p.Variants = variants
+		p.Options = variantOptionMatrix(variants)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(p)
@@ -153,25 +636,69 @@ func (h *ProductHandler) UpdateProductHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	if req.Name == "" || req.Price <= 0 || req.StockQuantity < 0 {
+	if !productDetailsValid(&req) {
 		http.Error(w, "Invalid product details", http.StatusBadRequest)
 		return
 	}
 
+	if !validateProductStatus(w, req.Status) || !validateProductSKU(w, &req) {
+		return
+	}
+
+	categoryIDs, ok := parseCategoryIDs(w, req.CategoryIDs)
+	if !ok {
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, "Could not update product", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	// An archived product can still be edited, but only restoring it
+	// brings it back to draft or active.
+	var currentStatus string
+	err = tx.QueryRow(r.Context(), `SELECT status FROM products WHERE id = $1 FOR UPDATE`, productID).Scan(&currentStatus)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Could not update product", http.StatusInternalServerError)
+		return
+	}
+	if currentStatus == productStatusArchived && req.Status != "" {
+		http.Error(w, "Archived products must be restored before their status can change", http.StatusConflict)
+		return
+	}
+
+	// stock_quantity is ignored: stock only changes by recorded movements,
+	// through POST /products/{id}/stock-adjustments, so an update made from
+	// an earlier read can't undo a checkout or adjustment since.
 	query := `
 		UPDATE products 
-		SET name = $1, description = $2, price = $3, stock_quantity = $4 
-		WHERE id = $5
+		SET name = $1, description = $2, price = $3,
+			status = COALESCE(NULLIF($4, ''), status), sku = COALESCE(NULLIF($5, ''), sku)
+		WHERE id = $6
 	`
 
-	cmdTag, err := h.DB.Exec(r.Context(), query, req.Name, req.Description, req.Price, req.StockQuantity, productID)
+	_, err = tx.Exec(r.Context(), query, req.Name, req.Description, req.Price, req.Status, req.SKU, productID)
 	if err != nil {
-		http.Error(w, "Could not update product", http.StatusInternalServerError)
+		productWriteError(w, err, "Could not update product")
 		return
 	}
 
-	if cmdTag.RowsAffected() == 0 {
-		http.Error(w, "Product not found", http.StatusNotFound)
+	if categoryIDs != nil {
+		if err := setProductCategories(r.Context(), tx, uuid.MustParse(productID), categoryIDs); err != nil {
+			productCategoriesError(w, err, "Could not update product")
+			return
+		}
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, "Could not update product", http.StatusInternalServerError)
 		return
 	}
 
@@ -182,6 +709,10 @@ func (h *ProductHandler) UpdateProductHandler(w http.ResponseWriter, r *http.Req
 	})
 }
 
+// DeleteProductHandler archives a product rather than deleting it, since
+// orders keep referring to it. Archived products drop out of listings and
+// can't be added to carts, but keep their variants and images so they can
+// be restored. Archiving an archived product is a no-op.
 func (h *ProductHandler) DeleteProductHandler(w http.ResponseWriter, r *http.Request) {
 	productID := chi.URLParam(r, "id")
 	if _, err := uuid.Parse(productID); err != nil {
@@ -189,11 +720,15 @@ func (h *ProductHandler) DeleteProductHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	query := `DELETE FROM products WHERE id = $1`
+	query := `
+		UPDATE products
+		SET status = 'archived', deleted_at = COALESCE(deleted_at, NOW())
+		WHERE id = $1
+	`
 
 	cmdTag, err := h.DB.Exec(r.Context(), query, productID)
 	if err != nil {
-		http.Error(w, "Could not delete product. It may be part of an existing order.", http.StatusConflict)
+		http.Error(w, "Could not delete product", http.StatusInternalServerError)
 		return
 	}
 
@@ -205,6 +740,46 @@ func (h *ProductHandler) DeleteProductHandler(w http.ResponseWriter, r *http.Req
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Product deleted successfully",
+		"message": "Product archived successfully",
+	})
+}
+
+// RestoreProductHandler makes an archived product active again.
+func (h *ProductHandler) RestoreProductHandler(w http.ResponseWriter, r *http.Request) {
+	productID := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(productID); err != nil {
+		http.Error(w, "Invalid product ID format", http.StatusBadRequest)
+		return
+	}
+
+	query := `
+		WITH restored AS (
+			UPDATE products
+			SET status = 'active', deleted_at = NULL
+			WHERE id = $1 AND status = 'archived'
+			RETURNING id
+		)
+		SELECT EXISTS (SELECT 1 FROM products WHERE id = $1), EXISTS (SELECT 1 FROM restored)
+	`
+
+	var exists, restored bool
+	if err := h.DB.QueryRow(r.Context(), query, productID).Scan(&exists, &restored); err != nil {
+		http.Error(w, "Could not restore product", http.StatusInternalServerError)
+		return
+	}
+
+	if !exists {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if !restored {
+		http.Error(w, "Product is not archived", http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Product restored successfully",
 	})
 }
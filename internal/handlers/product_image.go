@@ -0,0 +1,371 @@
+package handlers
+
+import (
+	"context"
+	"ecommerce-api-v2/internal/imaging"
+	"ecommerce-api-v2/internal/models"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	defaultMaxImageBytes = 10 << 20
+	maxImageAltText      = 255
+)
+
+// thumbnailSizes are the resized copies made of every upload, by name and
+// the longest side in pixels. They are listed largest first, since each is
+// scaled from the one before rather than from the full-size image.
+var thumbnailSizes = []struct {
+	name string
+	size int
+}{
+	{"medium", 800},
+	{"small", 200},
+}
+
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+func (h *ProductHandler) maxImageBytes() int64 {
+	if h.MaxImageBytes > 0 {
+		return h.MaxImageBytes
+	}
+	return defaultMaxImageBytes
+}
+
+// resolveImageURLs replaces the storage keys productImagesColumn loads
+// with the URLs the images are served from.
+func (h *ProductHandler) resolveImageURLs(images []models.ProductImageResponse) {
+	if h.Storage == nil {
+		return
+	}
+	for i := range images {
+		images[i].URL = h.Storage.URL(images[i].URL)
+		for name, key := range images[i].Thumbnails {
+			images[i].Thumbnails[name] = h.Storage.URL(key)
+		}
+	}
+}
+
+// deleteImageObjects removes stored objects, logging rather than returning
+// failures: by the time it runs the database no longer refers to them, so
+// a failure only leaves an orphaned file behind.
+func (h *ProductHandler) deleteImageObjects(ctx context.Context, keys []string) {
+	ctx = context.WithoutCancel(ctx)
+	for _, key := range keys {
+		if err := h.Storage.Delete(ctx, key); err != nil {
+			log.Printf("Failed to delete stored image %s: %v", key, err)
+		}
+	}
+}
+
+// UploadProductImageHandler stores an image sent as the "image" field of a
+// multipart form, along with resized thumbnails, and appends it to the
+// product's images. The form may also name a variant_id the image shows
+// and an alt_text.
+func (h *ProductHandler) UploadProductImageHandler(w http.ResponseWriter, r *http.Request) {
+	if h.Storage == nil {
+		http.Error(w, "Image storage is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	productID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID format", http.StatusBadRequest)
+		return
+	}
+
+	// The body limit leaves room for the multipart framing and the other
+	// fields; the image itself is checked against maxBytes below.
+	maxBytes := h.maxImageBytes()
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+1<<20)
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			http.Error(w, "Image is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Invalid multipart form", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		http.Error(w, "An image file is required in the 'image' field", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		http.Error(w, "Could not read image", http.StatusBadRequest)
+		return
+	}
+	if int64(len(data)) > maxBytes {
+		http.Error(w, "Image is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	altText := strings.TrimSpace(r.FormValue("alt_text"))
+	if len(altText) > maxImageAltText {
+		http.Error(w, "Alt text must be at most 255 characters", http.StatusBadRequest)
+		return
+	}
+
+	var variantID *uuid.UUID
+	if v := r.FormValue("variant_id"); v != "" {
+		parsed, err := uuid.Parse(v)
+		if err != nil {
+			http.Error(w, "Invalid variant ID format", http.StatusBadRequest)
+			return
+		}
+		variantID = &parsed
+	}
+
+	img, contentType, err := imaging.Decode(data)
+	if err != nil {
+		switch {
+		case errors.Is(err, imaging.ErrUnsupportedFormat):
+			http.Error(w, "Unsupported image type. Allowed types: JPEG, PNG, GIF", http.StatusUnsupportedMediaType)
+		case errors.Is(err, imaging.ErrTooManyPixels):
+			http.Error(w, "Image dimensions are too large", http.StatusBadRequest)
+		default:
+			http.Error(w, "Could not decode image", http.StatusBadRequest)
+		}
+		return
+	}
+
+	// Check the product and variant before storing anything.
+	var productExists, variantMatches bool
+	checkQuery := `
+		SELECT
+			EXISTS (SELECT 1 FROM products WHERE id = $1),
+			$2::uuid IS NULL OR EXISTS (SELECT 1 FROM product_variants WHERE id = $2 AND product_id = $1)
+	`
+	if err := h.DB.QueryRow(r.Context(), checkQuery, productID, variantID).Scan(&productExists, &variantMatches); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !productExists {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if !variantMatches {
+		http.Error(w, "Variant not found", http.StatusBadRequest)
+		return
+	}
+
+	imageID := uuid.New()
+	prefix := "products/" + productID.String() + "/" + imageID.String() + "/"
+	originalKey := prefix + "original" + imageExtensions[contentType]
+
+	if err := h.Storage.Put(r.Context(), originalKey, data, contentType); err != nil {
+		log.Printf("Failed to store image %s: %v", originalKey, err)
+		http.Error(w, "Could not store image", http.StatusInternalServerError)
+		return
+	}
+	stored := []string{originalKey}
+
+	thumbnailKeys := make(map[string]string, len(thumbnailSizes))
+	scaled := img
+	for _, t := range thumbnailSizes {
+		scaled = imaging.Resize(scaled, t.size)
+		thumb, thumbType, err := imaging.Encode(scaled, contentType)
+		if err == nil {
+			key := prefix + t.name + imageExtensions[thumbType]
+			if err = h.Storage.Put(r.Context(), key, thumb, thumbType); err == nil {
+				thumbnailKeys[t.name] = key
+				stored = append(stored, key)
+			}
+		}
+		if err != nil {
+			log.Printf("Failed to store %s thumbnail of image %s: %v", t.name, imageID, err)
+			h.deleteImageObjects(r.Context(), stored)
+			http.Error(w, "Could not store image", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	bounds := img.Bounds()
+	query := `
+		INSERT INTO product_images (
+			id, product_id, variant_id, original_key, thumbnail_keys,
+			content_type, width, height, size_bytes, alt_text, position
+		)
+		SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, COALESCE(MAX(position) + 1, 0)
+		FROM product_images
+		WHERE product_id = $2
+	`
+	_, err = h.DB.Exec(r.Context(), query,
+		imageID, productID, variantID, originalKey, thumbnailKeys,
+		contentType, bounds.Dx(), bounds.Dy(), len(data), altText,
+	)
+	if err != nil {
+		h.deleteImageObjects(r.Context(), stored)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Could not save image", http.StatusInternalServerError)
+		return
+	}
+
+	resp := models.ProductImageResponse{
+		ID:         imageID.String(),
+		URL:        originalKey,
+		Thumbnails: thumbnailKeys,
+		Width:      bounds.Dx(),
+		Height:     bounds.Dy(),
+		AltText:    altText,
+	}
+	if variantID != nil {
+		v := variantID.String()
+		resp.VariantID = &v
+	}
+	h.resolveImageURLs([]models.ProductImageResponse{resp})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ReorderProductImagesHandler sets the display order of a product's
+// images. The request must list every one of them exactly once.
+func (h *ProductHandler) ReorderProductImagesHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID format", http.StatusBadRequest)
+		return
+	}
+
+	var req models.ReorderProductImagesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	imageIDs := make([]uuid.UUID, 0, len(req.ImageIDs))
+	seen := make(map[uuid.UUID]bool, len(req.ImageIDs))
+	for _, id := range req.ImageIDs {
+		imageID, err := uuid.Parse(id)
+		if err != nil {
+			http.Error(w, "Invalid image ID format", http.StatusBadRequest)
+			return
+		}
+		if seen[imageID] {
+			http.Error(w, "image_ids must list each of the product's images exactly once", http.StatusBadRequest)
+			return
+		}
+		seen[imageID] = true
+		imageIDs = append(imageIDs, imageID)
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, "Could not reorder images", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	updateQuery := `
+		UPDATE product_images pi
+		SET position = o.ord - 1
+		FROM unnest($2::uuid[]) WITH ORDINALITY AS o(id, ord)
+		WHERE pi.id = o.id AND pi.product_id = $1
+	`
+	cmdTag, err := tx.Exec(r.Context(), updateQuery, productID, imageIDs)
+	if err != nil {
+		http.Error(w, "Could not reorder images", http.StatusInternalServerError)
+		return
+	}
+
+	var total int
+	if err := tx.QueryRow(r.Context(), `SELECT COUNT(*) FROM product_images WHERE product_id = $1`, productID).Scan(&total); err != nil {
+		http.Error(w, "Could not reorder images", http.StatusInternalServerError)
+		return
+	}
+	if int(cmdTag.RowsAffected()) != len(imageIDs) || total != len(imageIDs) {
+		http.Error(w, "image_ids must list each of the product's images exactly once", http.StatusBadRequest)
+		return
+	}
+
+	images := make([]models.ProductImageResponse, 0)
+	if err := tx.QueryRow(r.Context(), `SELECT `+productImagesColumn+` FROM products WHERE id = $1`, productID).Scan(&images); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Could not reorder images", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, "Could not reorder images", http.StatusInternalServerError)
+		return
+	}
+
+	h.resolveImageURLs(images)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(images)
+}
+
+func (h *ProductHandler) DeleteProductImageHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID format", http.StatusBadRequest)
+		return
+	}
+
+	imageID, err := uuid.Parse(chi.URLParam(r, "image_id"))
+	if err != nil {
+		http.Error(w, "Invalid image ID format", http.StatusBadRequest)
+		return
+	}
+
+	var originalKey string
+	var thumbnailKeys map[string]string
+	query := `
+		DELETE FROM product_images
+		WHERE id = $1 AND product_id = $2
+		RETURNING original_key, thumbnail_keys
+	`
+	if err := h.DB.QueryRow(r.Context(), query, imageID, productID).Scan(&originalKey, &thumbnailKeys); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Image not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Could not delete image", http.StatusInternalServerError)
+		return
+	}
+
+	if h.Storage != nil {
+		keys := []string{originalKey}
+		for _, key := range thumbnailKeys {
+			keys = append(keys, key)
+		}
+		h.deleteImageObjects(r.Context(), keys)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Image deleted successfully",
+	})
+}
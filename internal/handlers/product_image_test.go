@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"ecommerce-api-v2/internal/models"
+	"ecommerce-api-v2/internal/storage"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func imageUploadRequest(t *testing.T, productID string, data []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("image", "photo.png")
+	fw.Write(data)
+	mw.WriteField("alt_text", "Front view")
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/products/"+productID+"/images", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return withURLParam(req, "id", productID)
+}
+
+func TestProductImages_UploadReorderDelete(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	dir := t.TempDir()
+	handler := &ProductHandler{DB: db, Storage: &storage.LocalStorage{Dir: dir, BaseURL: "/media"}}
+
+	productID := uuid.New()
+	db.Exec(context.Background(), `
+		INSERT INTO products (id, name, price, stock_quantity)
+		VALUES ($1, 'Desk Lamp', 4500, 3)
+	`, productID)
+
+	var pngData bytes.Buffer
+	png.Encode(&pngData, image.NewNRGBA(image.Rect(0, 0, 1200, 600)))
+
+	upload := func(data []byte) (int, models.ProductImageResponse) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handler.UploadProductImageHandler(w, imageUploadRequest(t, productID.String(), data))
+		var img models.ProductImageResponse
+		json.NewDecoder(w.Body).Decode(&img)
+		return w.Code, img
+	}
+
+	code, first := upload(pngData.Bytes())
+	if code != http.StatusCreated {
+		t.Fatalf("Expected image to be uploaded, got %d", code)
+	}
+	if first.Width != 1200 || first.AltText != "Front view" || !strings.HasPrefix(first.URL, "/media/products/") {
+		t.Errorf("Unexpected image %+v", first)
+	}
+
+	small := strings.TrimPrefix(first.Thumbnails["small"], "/media/")
+	f, err := os.Open(filepath.Join(dir, filepath.FromSlash(small)))
+	if err != nil {
+		t.Fatalf("Expected the small thumbnail to be stored: %v", err)
+	}
+	cfg, _ := png.DecodeConfig(f)
+	f.Close()
+	if cfg.Width != 200 || cfg.Height != 100 {
+		t.Errorf("Expected a 200x100 thumbnail, got %dx%d", cfg.Width, cfg.Height)
+	}
+
+	if code, _ := upload([]byte("%PDF-1.4 not an image")); code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415 for a non-image upload, got %d", code)
+	}
+
+	handler.MaxImageBytes = 100
+	if code, _ := upload(pngData.Bytes()); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for an oversized upload, got %d", code)
+	}
+	handler.MaxImageBytes = 0
+
+	_, second := upload(pngData.Bytes())
+
+	body, _ := json.Marshal(models.ReorderProductImagesRequest{ImageIDs: []string{second.ID, first.ID}})
+	req := withURLParam(httptest.NewRequest(http.MethodPut, "/api/v1/products/"+productID.String()+"/images/order", bytes.NewReader(body)), "id", productID.String())
+	w := httptest.NewRecorder()
+	handler.ReorderProductImagesHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected reorder to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+
+	body, _ = json.Marshal(models.ReorderProductImagesRequest{ImageIDs: []string{second.ID}})
+	req = withURLParam(httptest.NewRequest(http.MethodPut, "/api/v1/products/"+productID.String()+"/images/order", bytes.NewReader(body)), "id", productID.String())
+	w = httptest.NewRecorder()
+	handler.ReorderProductImagesHandler(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 when an image is left out, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.GetProductHandler(w, withURLParam(httptest.NewRequest(http.MethodGet, "/api/v1/products/"+productID.String(), nil), "id", productID.String()))
+	var product models.GetProductResponse
+	json.NewDecoder(w.Body).Decode(&product)
+	if len(product.Images) != 2 || product.Images[0].ID != second.ID || !strings.HasPrefix(product.Images[0].Thumbnails["medium"], "/media/") {
+		t.Errorf("Expected the product to list its images in the new order, got %+v", product.Images)
+	}
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", productID.String())
+	rctx.URLParams.Add("image_id", first.ID)
+	req = httptest.NewRequest(http.MethodDelete, "/api/v1/products/"+productID.String()+"/images/"+first.ID, nil)
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w = httptest.NewRecorder()
+	handler.DeleteProductImageHandler(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected image to be deleted, got %d", w.Code)
+	}
+	if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(small))); !os.IsNotExist(err) {
+		t.Errorf("Expected the thumbnail file to be removed, got %v", err)
+	}
+}
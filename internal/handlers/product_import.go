@@ -0,0 +1,769 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"ecommerce-api-v2/internal/middleware"
+	"ecommerce-api-v2/internal/models"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	maxImportBytes  = 20 << 20
+	importBatchSize = 100
+	// exportFlushRows is how many products the export writes between
+	// flushes to the client.
+	exportFlushRows = 500
+)
+
+const (
+	importFormatCSV    = "csv"
+	importFormatNDJSON = "ndjson"
+)
+
+// importContentTypes maps the Content-Type of an uploaded file to its
+// format.
+var importContentTypes = map[string]string{
+	"text/csv":             importFormatCSV,
+	"application/x-ndjson": importFormatNDJSON,
+	"application/jsonl":    importFormatNDJSON,
+}
+
+// productCSVColumns are the columns of a CSV export, in order. An import
+// may use any of them in any order, but needs name and price. id picks the
+// product a row updates and created_at is ignored, so an export can be
+// edited and imported back.
+var productCSVColumns = []string{"id", "sku", "name", "description", "price", "stock_quantity", "status", "category_ids", "created_at"}
+
+const importJobColumns = `
+	id, format, status, total_rows, processed_rows, created_rows, updated_rows, failed_rows,
+	last_error, created_by, created_at, started_at, finished_at
+`
+
+func scanImportJob(row pgx.Row, job *models.ProductImportJobResponse) error {
+	return row.Scan(
+		&job.ID, &job.Format, &job.Status, &job.TotalRows, &job.ProcessedRows, &job.CreatedRows, &job.UpdatedRows, &job.FailedRows,
+		&job.LastError, &job.CreatedBy, &job.CreatedAt, &job.StartedAt, &job.FinishedAt,
+	)
+}
+
+// productImportRow is a row of an uploaded file, numbered by the line it
+// starts on. err is set when the row itself couldn't be read.
+type productImportRow struct {
+	line int
+	// id is the product the row updates, if it names one.
+	id  string
+	req models.CreateProductRequest
+	// hasDescription and hasStock are set when the row gives a description
+	// or stock quantity. A row that leaves one out keeps the product's
+	// current value when it updates a product.
+	hasDescription bool
+	hasStock       bool
+	err            error
+}
+
+// parseProductImport reads every row of an uploaded file. It only returns
+// an error when the file as a whole can't be read; a bad row is reported
+// on the row and skipped when the job runs.
+func parseProductImport(format string, data []byte) ([]productImportRow, error) {
+	// Spreadsheets often start their exports with a byte order mark.
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	var rows []productImportRow
+	var err error
+	if format == importFormatCSV {
+		rows, err = parseProductCSV(data)
+	} else {
+		rows = parseProductNDJSON(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("the file has no rows")
+	}
+	return rows, nil
+}
+
+// parseProductCSV reads a CSV file with a header row naming its columns.
+// category_ids holds category IDs separated by "|"; leaving the column out
+// keeps a product's categories, while an empty cell clears them. Leaving
+// out the description column, or the stock_quantity column or cell, keeps
+// the product's current value.
+func parseProductCSV(data []byte) ([]productImportRow, error) {
+	cr := csv.NewReader(bytes.NewReader(data))
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("the file has no rows")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !slices.Contains(productCSVColumns, name) {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		if _, dup := columns[name]; dup {
+			return nil, fmt.Errorf("duplicate column %q", name)
+		}
+		columns[name] = i
+	}
+	for _, required := range []string{"name", "price"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("missing column %q", required)
+		}
+	}
+
+	var rows []productImportRow
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+
+		// A row with the wrong number of fields is still returned, so it
+		// can be reported and skipped. Any other error leaves the reader
+		// unable to tell where the next row starts.
+		if err != nil && !errors.Is(err, csv.ErrFieldCount) {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		row := productImportRow{line: line}
+		if err != nil {
+			row.err = fmt.Errorf("expected %d fields, got %d", len(header), len(record))
+			rows = append(rows, row)
+			continue
+		}
+
+		field := func(name string) (string, bool) {
+			i, ok := columns[name]
+			if !ok {
+				return "", false
+			}
+			return strings.TrimSpace(record[i]), true
+		}
+
+		row.id, _ = field("id")
+		row.req.SKU, _ = field("sku")
+		row.req.Name, _ = field("name")
+		row.req.Description, row.hasDescription = field("description")
+		row.req.Status, _ = field("status")
+
+		price, _ := field("price")
+		if row.req.Price, err = strconv.Atoi(price); err != nil {
+			row.err = errors.New("price must be a whole number")
+		}
+		if stock, ok := field("stock_quantity"); ok && stock != "" {
+			row.hasStock = true
+			if row.req.StockQuantity, err = strconv.Atoi(stock); err != nil {
+				row.err = errors.New("stock_quantity must be a whole number")
+			}
+		}
+		if categories, ok := field("category_ids"); ok {
+			row.req.CategoryIDs = []string{}
+			for _, id := range strings.Split(categories, "|") {
+				if id = strings.TrimSpace(id); id != "" {
+					row.req.CategoryIDs = append(row.req.CategoryIDs, id)
+				}
+			}
+		}
+
+		rows = append(rows, row)
+	}
+}
+
+// parseProductNDJSON reads a file of JSON objects shaped like
+// CreateProductRequest, plus an optional id, one per line. Blank lines are
+// skipped. Leaving out description or stock_quantity keeps the product's
+// current value.
+func parseProductNDJSON(data []byte) []productImportRow {
+	var rows []productImportRow
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		row := productImportRow{line: i + 1}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(line, &row.req); err != nil {
+			row.err = errors.New("invalid JSON")
+		} else if err := json.Unmarshal(line, &fields); err == nil {
+			_, row.hasDescription = fields["description"]
+			_, row.hasStock = fields["stock_quantity"]
+			if id, ok := fields["id"]; ok && json.Unmarshal(id, &row.id) != nil {
+				row.err = errors.New("id must be a string")
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// checkImportRow applies the rules of CreateProductHandler to an imported
+// row. It returns the row's category IDs, or nil to keep a product's
+// current ones.
+func checkImportRow(req *models.CreateProductRequest) ([]uuid.UUID, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	req.SKU = strings.TrimSpace(req.SKU)
+
+	if !productDetailsValid(req) {
+		return nil, errors.New("name is required, price must be > 0, stock cannot be negative")
+	}
+	// archived is only accepted for a product that already is, so an
+	// export can be imported back.
+	if req.Status != productStatusArchived && !productStatusValid(req.Status) {
+		return nil, errors.New("status must be draft, active or archived")
+	}
+	if req.SKU != "" && !validSKU.MatchString(req.SKU) {
+		return nil, errors.New("sku may only contain letters, digits, '.', '_' and '-' (max 64)")
+	}
+
+	if req.CategoryIDs == nil {
+		return nil, nil
+	}
+	categoryIDs := make([]uuid.UUID, 0, len(req.CategoryIDs))
+	for _, id := range req.CategoryIDs {
+		categoryID, err := uuid.Parse(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid category ID %q", id)
+		}
+		categoryIDs = append(categoryIDs, categoryID)
+	}
+	return categoryIDs, nil
+}
+
+// ImportProductsHandler queues a CSV or NDJSON file of products, sent as
+// the request body, for import. A row with an id updates that product, and
+// one with a SKU the product that has it, if any; other rows create
+// products. The import runs in the
+// background and its progress is reported by GetProductImportHandler.
+func (h *ProductHandler) ImportProductsHandler(w http.ResponseWriter, r *http.Request) {
+	ctxValue := r.Context().Value(middleware.UserContextKey)
+	claims, ok := ctxValue.(middleware.UserClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	actorID, _ := uuid.Parse(claims.UserID)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	format, ok := importContentTypes[mediaType]
+	if !ok {
+		http.Error(w, "Upload the file as text/csv or application/x-ndjson", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			http.Error(w, "File is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Could not read file", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := parseProductImport(format, data)
+	if err != nil {
+		http.Error(w, "Invalid file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job := models.ProductImportJobResponse{Errors: []models.ProductImportError{}}
+	query := `
+		INSERT INTO product_import_jobs (created_by, format, payload, total_rows)
+		VALUES ($1, $2, $3, $4)
+		RETURNING ` + importJobColumns
+	if err := scanImportJob(h.DB.QueryRow(r.Context(), query, actorID, format, data, len(rows)), &job); err != nil {
+		http.Error(w, "Could not queue import", http.StatusInternalServerError)
+		return
+	}
+
+	h.wakeImportJob()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// GetProductImportHandler reports the progress of an import, along with
+// the rows skipped so far and why.
+func (h *ProductHandler) GetProductImportHandler(w http.ResponseWriter, r *http.Request) {
+	jobID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid import ID format", http.StatusBadRequest)
+		return
+	}
+
+	var job models.ProductImportJobResponse
+	err = scanImportJob(h.DB.QueryRow(r.Context(), `SELECT `+importJobColumns+` FROM product_import_jobs WHERE id = $1`, jobID), &job)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Import not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := h.DB.Query(r.Context(), `
+		SELECT row_number, sku, message
+		FROM product_import_errors
+		WHERE job_id = $1
+		ORDER BY row_number
+	`, jobID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	job.Errors = make([]models.ProductImportError, 0)
+	for rows.Next() {
+		var e models.ProductImportError
+		if err := rows.Scan(&e.Row, &e.SKU, &e.Message); err != nil {
+			http.Error(w, "Error fetching rows", http.StatusInternalServerError)
+			return
+		}
+		job.Errors = append(job.Errors, e)
+	}
+
+	if rows.Err() != nil {
+		http.Error(w, "Error iterating over import errors", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(job)
+}
+
+// ProcessProductImports runs every queued import to completion and returns
+// how many were finished. A job that fails part way keeps the batches it
+// committed, and resumes after them once it is picked up again.
+func (h *ProductHandler) ProcessProductImports(ctx context.Context) (int, error) {
+	var finished int
+
+	for {
+		jobID, err := h.processNextImport(ctx)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return finished, nil
+		}
+		if err != nil {
+			if jobID == uuid.Nil {
+				return finished, err
+			}
+
+			log.Printf("Failed to process product import %s: %v", jobID, err)
+			errorQuery := `UPDATE product_import_jobs SET last_error = $2 WHERE id = $1`
+			if _, dbErr := h.DB.Exec(ctx, errorQuery, jobID, err.Error()); dbErr != nil {
+				return finished, dbErr
+			}
+			continue
+		}
+
+		finished++
+	}
+}
+
+// processNextImport claims the oldest queued import and runs it. A job
+// left running without progress for five minutes, say by a restart, is
+// claimed again. It returns pgx.ErrNoRows when there is nothing to do.
+func (h *ProductHandler) processNextImport(ctx context.Context) (uuid.UUID, error) {
+	var jobID uuid.UUID
+	var createdBy *uuid.UUID
+	var format string
+	var payload []byte
+	var processed int
+	claimQuery := `
+		UPDATE product_import_jobs
+		SET status = 'running', started_at = COALESCE(started_at, NOW())
+		WHERE id = (
+			SELECT id
+			FROM product_import_jobs
+			WHERE status = 'pending' OR (status = 'running' AND updated_at < NOW() - INTERVAL '5 minutes')
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, created_by, format, payload, processed_rows
+	`
+	if err := h.DB.QueryRow(ctx, claimQuery).Scan(&jobID, &createdBy, &format, &payload, &processed); err != nil {
+		return uuid.Nil, err
+	}
+
+	// The file was checked when it was uploaded, so it can only fail here
+	// if it no longer parses the way it did then.
+	rows, err := parseProductImport(format, payload)
+	if err != nil {
+		failQuery := `
+			UPDATE product_import_jobs
+			SET status = 'failed', last_error = $2, payload = NULL, finished_at = NOW()
+			WHERE id = $1
+		`
+		_, err = h.DB.Exec(ctx, failQuery, jobID, err.Error())
+		return jobID, err
+	}
+
+	for processed < len(rows) {
+		end := min(processed+importBatchSize, len(rows))
+		if err := h.importBatch(ctx, jobID, createdBy, rows[processed:end], processed); err != nil {
+			return jobID, err
+		}
+		processed = end
+	}
+
+	doneQuery := `
+		UPDATE product_import_jobs
+		SET status = 'completed', last_error = NULL, payload = NULL, finished_at = NOW()
+		WHERE id = $1
+	`
+	_, err = h.DB.Exec(ctx, doneQuery, jobID)
+	return jobID, err
+}
+
+// importBatch imports rows, which follow the first offset rows of the
+// file, and records the job's progress in the same transaction. Stock
+// changes are recorded as made by createdBy, who uploaded the file.
+func (h *ProductHandler) importBatch(ctx context.Context, jobID uuid.UUID, createdBy *uuid.UUID, rows []productImportRow, offset int) error {
+	tx, err := h.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var created, updated, failed int
+	for _, row := range rows {
+		inserted, rowErr, err := importProductRow(ctx, tx, jobID, createdBy, row)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case rowErr != nil:
+			failed++
+			errorQuery := `
+				INSERT INTO product_import_errors (job_id, row_number, sku, message)
+				VALUES ($1, $2, $3, $4)
+			`
+			if _, err := tx.Exec(ctx, errorQuery, jobID, row.line, row.req.SKU, rowErr.Error()); err != nil {
+				return err
+			}
+		case inserted:
+			created++
+		default:
+			updated++
+		}
+	}
+
+	// Checking processed_rows keeps a worker that lost the job, because it
+	// stalled long enough for another to claim it, from importing the
+	// same rows twice.
+	progressQuery := `
+		UPDATE product_import_jobs
+		SET processed_rows = processed_rows + $3,
+			created_rows = created_rows + $4,
+			updated_rows = updated_rows + $5,
+			failed_rows = failed_rows + $6
+		WHERE id = $1 AND processed_rows = $2
+	`
+	cmdTag, err := tx.Exec(ctx, progressQuery, jobID, offset, len(rows), created, updated, failed)
+	if err != nil {
+		return err
+	}
+	if cmdTag.RowsAffected() == 0 {
+		return errors.New("import was taken over by another worker")
+	}
+
+	return tx.Commit(ctx)
+}
+
+// importProductRow creates or updates the product in row. A new product's
+// stock is recorded as an import movement; an existing product's stock is
+// left alone, since it only changes by recorded movements, and a file
+// exported before a checkout would otherwise undo it. rowErr explains why
+// the row was skipped; err is a failure of the whole batch.
+func importProductRow(ctx context.Context, tx pgx.Tx, jobID uuid.UUID, createdBy *uuid.UUID, row productImportRow) (inserted bool, rowErr, err error) {
+	if row.err != nil {
+		return false, row.err, nil
+	}
+
+	req := row.req
+	categoryIDs, rowErr := checkImportRow(&req)
+	if rowErr != nil {
+		return false, rowErr, nil
+	}
+
+	// A savepoint lets a row the database rejects be skipped without
+	// losing the rest of the batch.
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return false, nil, err
+	}
+	defer sp.Rollback(ctx)
+
+	// Fields the row leaves out are passed as NULL, which keeps the
+	// product's current value on update or uses the default on insert.
+	var description *string
+	if row.hasDescription {
+		description = &req.Description
+	}
+	var stock *int
+	if row.hasStock {
+		stock = &req.StockQuantity
+	}
+
+	// The row updates the product with its id or, without one, its SKU.
+	var productID uuid.UUID
+	var lookup pgx.Row
+	switch {
+	case row.id != "":
+		if productID, err = uuid.Parse(row.id); err != nil {
+			return false, errors.New("invalid product ID"), nil
+		}
+		lookup = sp.QueryRow(ctx, `SELECT status FROM products WHERE id = $1 FOR UPDATE`, productID)
+	case req.SKU != "":
+		lookup = sp.QueryRow(ctx, `SELECT id, status FROM products WHERE sku = $1 FOR UPDATE`, req.SKU)
+	}
+
+	var currentStatus string
+	exists := false
+	if lookup != nil {
+		if row.id != "" {
+			err = lookup.Scan(&currentStatus)
+		} else {
+			err = lookup.Scan(&productID, &currentStatus)
+		}
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return importRowDBError(err)
+		}
+		exists = err == nil
+	}
+	if row.id != "" && !exists {
+		return false, errors.New("product not found"), nil
+	}
+
+	// Like UpdateProductHandler, an import can edit an archived product
+	// but not change its status, and archiving is left to DELETE. An
+	// archived product exported as such reads back unchanged.
+	archiving := req.Status == productStatusArchived
+	switch {
+	case exists && currentStatus == productStatusArchived && req.Status != "" && !archiving:
+		return false, errors.New("archived products must be restored before their status can change"), nil
+	case archiving && currentStatus != productStatusArchived:
+		return false, errors.New("products can only be archived by deleting them"), nil
+	}
+
+	var newStock int
+	if exists {
+		query := `
+			UPDATE products
+			SET name = $2, description = COALESCE($3, description), price = $4,
+				status = COALESCE(NULLIF($5, ''), status), sku = COALESCE(NULLIF($6, ''), sku)
+			WHERE id = $1
+		`
+		_, err = sp.Exec(ctx, query, productID, req.Name, description, req.Price, req.Status, req.SKU)
+	} else {
+		query := `
+			INSERT INTO products (name, description, price, stock_quantity, status, sku)
+			VALUES ($1, COALESCE($2, ''), $3, COALESCE($4, 0), COALESCE(NULLIF($5, ''), 'active'), NULLIF($6, ''))
+			RETURNING id, stock_quantity
+		`
+		err = sp.QueryRow(ctx, query, req.Name, description, req.Price, stock, req.Status, req.SKU).Scan(&productID, &newStock)
+		inserted = true
+	}
+	if err != nil {
+		return importRowDBError(err)
+	}
+
+	if categoryIDs != nil {
+		if err := setProductCategories(ctx, sp, productID, categoryIDs); err != nil {
+			return importRowDBError(err)
+		}
+	}
+
+	if newStock != 0 {
+		_, err := recordStockMovement(ctx, sp, stockMovement{
+			ProductID:   productID,
+			Type:        movementImport,
+			Delta:       newStock,
+			ActorID:     createdBy,
+			ImportJobID: &jobID,
+		}, newStock)
+		if err != nil {
+			return importRowDBError(err)
+		}
+	}
+
+	return inserted, nil, sp.Commit(ctx)
+}
+
+// importRowDBError turns an error the database raised for a row into the
+// reason the row was skipped. Other errors fail the batch.
+func importRowDBError(err error) (bool, error, error) {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false, nil, err
+	}
+	switch pgErr.Code {
+	case "23503":
+		return false, errors.New("category not found"), nil
+	case "23505":
+		return false, errors.New("sku is already in use"), nil
+	}
+	return false, errors.New("could not save product"), nil
+}
+
+// wakeImportJob starts the import job right away rather than at its next
+// tick. It does nothing when the job isn't running.
+func (h *ProductHandler) wakeImportJob() {
+	if h.importWake == nil {
+		return
+	}
+	select {
+	case h.importWake <- struct{}{}:
+	default:
+	}
+}
+
+// StartProductImportJob runs queued imports as they are uploaded, and
+// every interval to pick up any left unfinished, until ctx is done. It
+// must be called before the server starts handling requests.
+func (h *ProductHandler) StartProductImportJob(ctx context.Context, interval time.Duration) {
+	h.importWake = make(chan struct{}, 1)
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-h.importWake:
+			}
+
+			n, err := h.ProcessProductImports(ctx)
+			if err != nil {
+				log.Printf("Failed to process product imports: %v", err)
+			}
+			if n > 0 {
+				log.Printf("Finished %d product imports", n)
+			}
+		}
+	}()
+}
+
+// ExportProductsHandler streams the whole catalog, archived products and
+// drafts included, as CSV or, with format=ndjson, as JSON Lines. A status
+// parameter limits the export to one status.
+func (h *ProductHandler) ExportProductsHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = importFormatCSV
+	}
+	if format != importFormatCSV && format != importFormatNDJSON {
+		http.Error(w, "Invalid format. Allowed values: csv, ndjson", http.StatusBadRequest)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", productStatusDraft, productStatusActive, productStatusArchived:
+	default:
+		http.Error(w, "Invalid status. Allowed values: draft, active, archived", http.StatusBadRequest)
+		return
+	}
+
+	query := `
+		SELECT
+			id, sku, name, COALESCE(description, ''), price, stock_quantity, status,
+			ARRAY(SELECT category_id::text FROM product_categories WHERE product_id = products.id ORDER BY category_id),
+			created_at
+		FROM products
+		WHERE $1 = '' OR status = $1
+		ORDER BY created_at, id
+	`
+	rows, err := h.DB.Query(r.Context(), query, status)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var cw *csv.Writer
+	enc := json.NewEncoder(w)
+	if format == importFormatCSV {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="products.csv"`)
+		cw = csv.NewWriter(w)
+		cw.Write(productCSVColumns)
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="products.ndjson"`)
+	}
+	w.WriteHeader(http.StatusOK)
+
+	// Once the status line is sent a failure can't be reported to the
+	// client, so it is logged and the export cut short.
+	flusher, _ := w.(http.Flusher)
+	for n := 1; rows.Next(); n++ {
+		var p models.ProductExportRow
+		if err := rows.Scan(&p.ID, &p.SKU, &p.Name, &p.Description, &p.Price, &p.StockQuantity, &p.Status, &p.CategoryIDs, &p.CreatedAt); err != nil {
+			log.Printf("Product export failed: %v", err)
+			return
+		}
+
+		if cw != nil {
+			var sku string
+			if p.SKU != nil {
+				sku = *p.SKU
+			}
+			cw.Write([]string{
+				p.ID, sku, p.Name, p.Description, strconv.Itoa(p.Price), strconv.Itoa(p.StockQuantity),
+				p.Status, strings.Join(p.CategoryIDs, "|"), p.CreatedAt.Format(time.RFC3339),
+			})
+		} else {
+			enc.Encode(p)
+		}
+
+		if n%exportFlushRows == 0 {
+			if cw != nil {
+				cw.Flush()
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+
+	if cw != nil {
+		cw.Flush()
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Product export failed: %v", err)
+	}
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"ecommerce-api-v2/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestParseProductImport(t *testing.T) {
+	csvData := "\xef\xbb\xbfSKU,name,price,stock_quantity,category_ids\n" +
+		"MUG-1,Mug,500,10,\n" +
+		"LAMP-1,\"Desk\nLamp\",abc,1\n" +
+		"KETTLE-1,Kettle,8000,,\n"
+	rows, err := parseProductImport(importFormatCSV, []byte(csvData))
+	if err != nil {
+		t.Fatalf("Expected the CSV to parse, got %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("Expected 3 rows, got %d", len(rows))
+	}
+	if rows[0].line != 2 || rows[0].req.SKU != "MUG-1" || rows[0].req.Price != 500 || rows[0].req.CategoryIDs == nil || !rows[0].hasStock || rows[0].hasDescription {
+		t.Errorf("Unexpected first row %+v", rows[0])
+	}
+	if rows[1].err == nil || rows[1].line != 3 {
+		t.Errorf("Expected the short row to be reported on line 3, got %+v", rows[1])
+	}
+	if rows[2].line != 5 || rows[2].hasStock || rows[2].err != nil {
+		t.Errorf("Expected the row after a multi-line field to start on line 5, got %+v", rows[2])
+	}
+
+	for _, data := range []string{"", "name,price,colour\n", "name,name,price\n", "sku,name\nA,B\n", "name,price\n"} {
+		if _, err := parseProductImport(importFormatCSV, []byte(data)); err == nil {
+			t.Errorf("Expected %q to be rejected", data)
+		}
+	}
+
+	rows, err = parseProductImport(importFormatNDJSON, []byte(`{"name": "Mug", "price": 500}`+"\n\nnot json\n"))
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("Expected 2 NDJSON rows, got %d, %v", len(rows), err)
+	}
+	if rows[1].line != 3 || rows[1].err == nil {
+		t.Errorf("Expected the invalid line to be reported as line 3, got %+v", rows[1])
+	}
+	if rows[0].hasDescription || rows[0].hasStock {
+		t.Errorf("Expected keys left out of an NDJSON row not to be set, got %+v", rows[0])
+	}
+}
+
+func TestProductImport_PartialColumnsKeepOtherFields(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	handler := &ProductHandler{DB: db}
+
+	adminID := uuid.New()
+	db.Exec(context.Background(), `
+		INSERT INTO users (id, email, password_hash, role)
+		VALUES ($1, 'prices@example.com', 'hash', 'admin')
+	`, adminID)
+	db.Exec(context.Background(), `
+		INSERT INTO products (name, description, price, stock_quantity, sku)
+		VALUES ('Mug', 'Blue glaze', 400, 7, 'MUG-1')
+	`)
+
+	for _, upload := range []struct{ contentType, data string }{
+		{"text/csv", "sku,name,price\nMUG-1,Mug,650\n"},
+		{"application/x-ndjson", `{"sku": "MUG-1", "name": "Mug", "price": 700}` + "\n"},
+	} {
+		req := withUser(httptest.NewRequest(http.MethodPost, "/api/v1/admin/products/imports", strings.NewReader(upload.data)), adminID)
+		req.Header.Set("Content-Type", upload.contentType)
+		w := httptest.NewRecorder()
+		handler.ImportProductsHandler(w, req)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("Expected the import to be queued, got %d: %s", w.Code, w.Body.String())
+		}
+		if n, err := handler.ProcessProductImports(context.Background()); err != nil || n != 1 {
+			t.Fatalf("Expected one import to finish, got %d, %v", n, err)
+		}
+	}
+
+	var description string
+	var price, stock, movements int
+	db.QueryRow(context.Background(), `SELECT description, price, stock_quantity FROM products WHERE sku = 'MUG-1'`).Scan(&description, &price, &stock)
+	if description != "Blue glaze" || stock != 7 || price != 700 {
+		t.Errorf("Expected only the price to change, got %q, %d, %d", description, price, stock)
+	}
+	db.QueryRow(context.Background(), `SELECT COUNT(*) FROM inventory_movements`).Scan(&movements)
+	if movements != 0 {
+		t.Errorf("Expected no stock movements, got %d", movements)
+	}
+}
+
+func TestProductImport_UpsertsBySKUAndExports(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	handler := &ProductHandler{DB: db}
+
+	adminID := uuid.New()
+	db.Exec(context.Background(), `
+		INSERT INTO users (id, email, password_hash, role)
+		VALUES ($1, 'catalog@example.com', 'hash', 'admin')
+	`, adminID)
+	db.Exec(context.Background(), `
+		INSERT INTO products (name, price, stock_quantity, sku)
+		VALUES ('Old Mug', 400, 1, 'MUG-1')
+	`)
+
+	data := "sku,name,price,stock_quantity,status\n" +
+		"MUG-1,Mug,500,10,\n" +
+		",Kettle,8000,2,draft\n" +
+		"LAMP-1,Lamp,-5,1,\n"
+	req := withUser(httptest.NewRequest(http.MethodPost, "/api/v1/admin/products/imports", strings.NewReader(data)), adminID)
+	req.Header.Set("Content-Type", "text/csv")
+	w := httptest.NewRecorder()
+	handler.ImportProductsHandler(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected the import to be queued, got %d: %s", w.Code, w.Body.String())
+	}
+	var job models.ProductImportJobResponse
+	json.NewDecoder(w.Body).Decode(&job)
+	if job.Status != "pending" || job.TotalRows != 3 {
+		t.Errorf("Unexpected queued job %+v", job)
+	}
+
+	if n, err := handler.ProcessProductImports(context.Background()); err != nil || n != 1 {
+		t.Fatalf("Expected one import to finish, got %d, %v", n, err)
+	}
+
+	w = httptest.NewRecorder()
+	handler.GetProductImportHandler(w, withURLParam(httptest.NewRequest(http.MethodGet, "/api/v1/admin/products/imports/"+job.ID, nil), "id", job.ID))
+	json.NewDecoder(w.Body).Decode(&job)
+	if job.Status != "completed" || job.CreatedRows != 1 || job.UpdatedRows != 1 || job.FailedRows != 1 {
+		t.Errorf("Unexpected finished job %+v", job)
+	}
+	if len(job.Errors) != 1 || job.Errors[0].Row != 4 || job.Errors[0].SKU != "LAMP-1" {
+		t.Errorf("Expected the invalid row to be reported, got %+v", job.Errors)
+	}
+
+	var name string
+	db.QueryRow(context.Background(), `SELECT name FROM products WHERE sku = 'MUG-1'`).Scan(&name)
+	if name != "Mug" {
+		t.Errorf("Expected the existing product to be updated by SKU, got %q", name)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ExportProductsHandler(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/products/export?format=ndjson", nil))
+	var exported []models.ProductExportRow
+	dec := json.NewDecoder(bytes.NewReader(w.Body.Bytes()))
+	for dec.More() {
+		var p models.ProductExportRow
+		if err := dec.Decode(&p); err != nil {
+			t.Fatalf("Expected NDJSON, got %v", err)
+		}
+		exported = append(exported, p)
+	}
+	if len(exported) != 2 || exported[1].Status != "draft" {
+		t.Errorf("Expected both products, drafts included, got %+v", exported)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ExportProductsHandler(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/products/export", nil))
+	if !strings.HasPrefix(w.Body.String(), strings.Join(productCSVColumns, ",")+"\n") {
+		t.Errorf("Expected a CSV header, got %q", w.Body.String())
+	}
+	if rows, err := parseProductImport(importFormatCSV, w.Body.Bytes()); err != nil || len(rows) != 2 {
+		t.Errorf("Expected the CSV export to read back as an import, got %d rows, %v", len(rows), err)
+	}
+}
+
+func TestProductImport_ExportReadsBackUnchanged(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	handler := &ProductHandler{DB: db}
+
+	adminID := uuid.New()
+	db.Exec(context.Background(), `
+		INSERT INTO users (id, email, password_hash, role)
+		VALUES ($1, 'roundtrip@example.com', 'hash', 'admin')
+	`, adminID)
+	db.Exec(context.Background(), `
+		INSERT INTO products (name, price, stock_quantity, status, deleted_at) VALUES
+			('Teapot', 3000, 4, 'active', NULL),
+			('Old Teapot', 2500, 0, 'archived', NOW())
+	`)
+
+	w := httptest.NewRecorder()
+	handler.ExportProductsHandler(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/products/export", nil))
+
+	req := withUser(httptest.NewRequest(http.MethodPost, "/api/v1/admin/products/imports", bytes.NewReader(w.Body.Bytes())), adminID)
+	req.Header.Set("Content-Type", "text/csv")
+	w = httptest.NewRecorder()
+	handler.ImportProductsHandler(w, req)
+	var job models.ProductImportJobResponse
+	json.NewDecoder(w.Body).Decode(&job)
+
+	if n, err := handler.ProcessProductImports(context.Background()); err != nil || n != 1 {
+		t.Fatalf("Expected one import to finish, got %d, %v", n, err)
+	}
+
+	w = httptest.NewRecorder()
+	handler.GetProductImportHandler(w, withURLParam(httptest.NewRequest(http.MethodGet, "/api/v1/admin/products/imports/"+job.ID, nil), "id", job.ID))
+	json.NewDecoder(w.Body).Decode(&job)
+	if job.CreatedRows != 0 || job.UpdatedRows != 2 || job.FailedRows != 0 {
+		t.Errorf("Expected both products to be updated in place, got %+v", job)
+	}
+
+	var count int
+	db.QueryRow(context.Background(), `SELECT COUNT(*) FROM products`).Scan(&count)
+	if count != 2 {
+		t.Errorf("Expected no duplicates, got %d products", count)
+	}
+}
+
+func TestProductImport_ReimportKeepsStockChangedSinceExport(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	handler := &ProductHandler{DB: db}
+	orderHandler := &OrderHandler{DB: db}
+
+	adminID := uuid.New()
+	userID := uuid.New()
+	productID := uuid.New()
+	db.Exec(context.Background(), `
+		INSERT INTO users (id, email, password_hash, role) VALUES
+			($1, 'reimport-admin@example.com', 'hash', 'admin'),
+			($2, 'reimport-buyer@example.com', 'hash', 'customer')
+	`, adminID, userID)
+	db.Exec(context.Background(), `
+		INSERT INTO products (id, name, price, stock_quantity, sku)
+		VALUES ($1, 'Teapot', 3000, 4, 'POT-1')
+	`, productID)
+
+	w := httptest.NewRecorder()
+	handler.ExportProductsHandler(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/products/export", nil))
+	exported := w.Body.Bytes()
+
+	db.Exec(context.Background(), `
+		INSERT INTO cart_items (user_id, product_id, quantity) VALUES ($1, $2, 3)
+	`, userID, productID)
+	w = httptest.NewRecorder()
+	orderHandler.CheckoutHandler(w, withUser(httptest.NewRequest(http.MethodPost, "/api/v1/checkout", nil), userID))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected checkout to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req := withUser(httptest.NewRequest(http.MethodPost, "/api/v1/admin/products/imports", bytes.NewReader(exported)), adminID)
+	req.Header.Set("Content-Type", "text/csv")
+	w = httptest.NewRecorder()
+	handler.ImportProductsHandler(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected the import to be queued, got %d: %s", w.Code, w.Body.String())
+	}
+	if n, err := handler.ProcessProductImports(context.Background()); err != nil || n != 1 {
+		t.Fatalf("Expected one import to finish, got %d, %v", n, err)
+	}
+
+	var stock, movements int
+	db.QueryRow(context.Background(), `SELECT stock_quantity FROM products WHERE id = $1`, productID).Scan(&stock)
+	if stock != 1 {
+		t.Errorf("Expected the import to keep the stock left after checkout, got %d", stock)
+	}
+	db.QueryRow(context.Background(), `SELECT COUNT(*) FROM inventory_movements WHERE type = 'import'`).Scan(&movements)
+	if movements != 0 {
+		t.Errorf("Expected no import movements for an existing product, got %d", movements)
+	}
+}
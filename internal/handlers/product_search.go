@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"ecommerce-api-v2/internal/models"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxSearchTerms      = 10
+	defaultSuggestLimit = 5
+	maxSuggestLimit     = 10
+	// productSearchHeadline builds the highlight excerpt. ts_headline copies
+	// the text as is, so it is HTML-escaped first and the <mark> tags are
+	// the only markup in the result.
+	productSearchHeadline = `ts_headline('english', ` + htmlEscapedProductText + `, to_tsquery('english', $%d),
+		'StartSel="<mark>", StopSel="</mark>", MaxWords=35, MinWords=15, MaxFragments=2')`
+	htmlEscapedProductText = `replace(replace(replace(replace(replace(name || ' ' || COALESCE(description, ''),
+		'&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;')`
+)
+
+var searchTerm = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// searchQuery turns free text into a to_tsquery expression that matches
+// products containing every term, with the last term matched as a prefix
+// so results show up while the customer is still typing. Only letters and
+// digits are kept, so the input can't inject tsquery operators. It returns
+// false if q holds no searchable terms.
+func searchQuery(q string) (string, bool) {
+	terms := searchTerm.FindAllString(strings.ToLower(q), maxSearchTerms)
+	if len(terms) == 0 {
+		return "", false
+	}
+
+	terms[len(terms)-1] += ":*"
+	return strings.Join(terms, " & "), true
+}
+
+// SuggestProductsHandler returns the names of the best matching products
+// for a partial search, for type-ahead as the customer types.
+func (h *ProductHandler) SuggestProductsHandler(w http.ResponseWriter, r *http.Request) {
+	tsquery, ok := searchQuery(r.URL.Query().Get("q"))
+	if !ok {
+		http.Error(w, "Search query must contain letters or digits", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultSuggestLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if parsedLimit, err := strconv.Atoi(l); err == nil && parsedLimit > 0 && parsedLimit <= maxSuggestLimit {
+			limit = parsedLimit
+		}
+	}
+
+	query := `
+		SELECT id, name
+		FROM products
+		WHERE search_vector @@ to_tsquery('english', $1) AND status = 'active'
+		ORDER BY ts_rank(search_vector, to_tsquery('english', $1)) DESC, name
+		LIMIT $2
+	`
+
+	rows, err := h.DB.Query(r.Context(), query, tsquery, limit)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	suggestions := make([]models.ProductSuggestion, 0)
+	for rows.Next() {
+		var s models.ProductSuggestion
+		if err := rows.Scan(&s.ID, &s.Name); err != nil {
+			http.Error(w, "Error fetching rows", http.StatusInternalServerError)
+			return
+		}
+		suggestions = append(suggestions, s)
+	}
+
+	if rows.Err() != nil {
+		http.Error(w, "Error iterating over products", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(suggestions)
+}
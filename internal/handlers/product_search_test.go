@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"ecommerce-api-v2/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSearchQuery(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+		ok    bool
+	}{
+		{"wireless headph", "wireless & headph:*", true},
+		{"  Café  ", "café:*", true},
+		{"usb-c & !cable", "usb & c & cable:*", true},
+		{"'):* | ", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := searchQuery(tt.input)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("searchQuery(%q) = %q, %v; expected %q, %v", tt.input, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestProductSearch_RanksAndHighlights(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	handler := &ProductHandler{DB: db}
+
+	db.Exec(context.Background(), `
+		INSERT INTO products (name, description, price, stock_quantity) VALUES
+			('Phone Case', 'Fits most headphones cases <img src=x onerror=alert(1)>', 900, 10),
+			('Wireless Headphones', 'Noise cancelling over-ear headphones', 9900, 5),
+			('Garden Hose', 'Twenty metres long', 2500, 3)
+	`)
+
+	w := httptest.NewRecorder()
+	handler.GetProductsHandler(w, httptest.NewRequest(http.MethodGet, "/api/v1/products?q=headph", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d", w.Code)
+	}
+
+	var list models.ProductListResponse
+	json.NewDecoder(w.Body).Decode(&list)
+	products := list.Products
+	if len(products) != 2 {
+		t.Fatalf("Expected the two headphone matches, got %+v", products)
+	}
+	if products[0].Name != "Wireless Headphones" {
+		t.Errorf("Expected the name match to rank first, got %q", products[0].Name)
+	}
+	if products[0].Highlight == nil || !strings.Contains(*products[0].Highlight, "<mark>Headphones</mark>") {
+		t.Errorf("Expected a highlighted snippet, got %v", products[0].Highlight)
+	}
+	if products[1].Highlight == nil || strings.Contains(*products[1].Highlight, "<img") || !strings.Contains(*products[1].Highlight, "&lt;img") {
+		t.Errorf("Expected the product text in the snippet to be HTML-escaped, got %v", products[1].Highlight)
+	}
+
+	w = httptest.NewRecorder()
+	handler.SuggestProductsHandler(w, httptest.NewRequest(http.MethodGet, "/api/v1/products/suggest?q=gard", nil))
+	var suggestions []models.ProductSuggestion
+	json.NewDecoder(w.Body).Decode(&suggestions)
+	if len(suggestions) != 1 || suggestions[0].Name != "Garden Hose" {
+		t.Errorf("Expected the garden hose to be suggested, got %+v", suggestions)
+	}
+
+	w = httptest.NewRecorder()
+	handler.GetProductsHandler(w, httptest.NewRequest(http.MethodGet, "/api/v1/products?q=%26%7C", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a query without terms, got %d", w.Code)
+	}
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"ecommerce-api-v2/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestGetProductsHandler_FiltersAndSorts(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	handler := &ProductHandler{DB: db}
+
+	shirtID := uuid.New()
+	db.Exec(context.Background(), `
+		INSERT INTO products (id, name, price, stock_quantity) VALUES
+			(gen_random_uuid(), 'Budget Mug', 500, 10),
+			(gen_random_uuid(), 'Sold Out Lamp', 3000, 0),
+			($1, 'T-Shirt', 9999, 0),
+			(gen_random_uuid(), 'Premium Kettle', 8000, 2)
+	`, shirtID)
+	db.Exec(context.Background(), `
+		INSERT INTO product_variants (product_id, sku, options, price, stock_quantity) VALUES
+			($1, 'TEE-S', '{"size": "S"}', 1500, 0),
+			($1, 'TEE-M', '{"size": "M"}', 1800, 4)
+	`, shirtID)
+
+	list := func(query string) (int, models.ProductListResponse) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handler.GetProductsHandler(w, httptest.NewRequest(http.MethodGet, "/api/v1/products?"+query, nil))
+		var resp models.ProductListResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp
+	}
+
+	_, resp := list("sort=price_asc&limit=2")
+	if resp.Total != 4 || len(resp.Products) != 2 {
+		t.Fatalf("Expected 2 of 4 products, got %d of %d", len(resp.Products), resp.Total)
+	}
+	if resp.Products[0].Name != "Budget Mug" || resp.Products[1].Name != "T-Shirt" {
+		t.Errorf("Expected the shirt to sort by its cheapest variant, got %q, %q", resp.Products[0].Name, resp.Products[1].Name)
+	}
+
+	_, resp = list("min_price=1000&max_price=5000&in_stock=true")
+	if resp.Total != 1 || resp.Products[0].Name != "T-Shirt" {
+		t.Errorf("Expected only the in-stock shirt in range, got %+v", resp.Products)
+	}
+	if resp.Filters.MinPrice == nil || *resp.Filters.MinPrice != 1000 || !resp.Filters.InStock {
+		t.Errorf("Expected the applied filters to be echoed back, got %+v", resp.Filters)
+	}
+
+	_, resp = list("attr.size=S&in_stock=true")
+	if resp.Total != 0 {
+		t.Errorf("Expected no in-stock size S variant, got %+v", resp.Products)
+	}
+
+	_, resp = list("attr.Size=M")
+	if resp.Total != 1 || resp.Filters.Attributes["size"] != "M" {
+		t.Errorf("Expected the shirt to match size M, got %+v", resp)
+	}
+
+	for _, query := range []string{"sort=random", "sort=relevance", "min_price=-1", "min_price=50&max_price=10", "in_stock=maybe"} {
+		if code, _ := list(query); code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %q, got %d", query, code)
+		}
+	}
+}
+
+func TestProductStatus_ArchiveAndRestore(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	handler := &ProductHandler{DB: db}
+	cartHandler := &CartHandler{DB: db}
+
+	userID := uuid.New()
+	lampID := uuid.New()
+	draftID := uuid.New()
+	db.Exec(context.Background(), `
+		INSERT INTO users (id, email, password_hash, role)
+		VALUES ($1, 'archive@example.com', 'hash', 'customer')
+	`, userID)
+	db.Exec(context.Background(), `
+		INSERT INTO products (id, name, price, stock_quantity, status) VALUES
+			($1, 'Desk Lamp', 4500, 3, 'active'),
+			($2, 'Secret Lamp', 9000, 3, 'draft')
+	`, lampID, draftID)
+	db.Exec(context.Background(), `
+		INSERT INTO orders (id, user_id, total_amount) VALUES ($1, $2, 4500)
+	`, uuid.New(), userID)
+	db.Exec(context.Background(), `
+		INSERT INTO order_items (order_id, product_id, quantity, price_at_purchase)
+		SELECT id, $1, 1, 4500 FROM orders WHERE user_id = $2
+	`, lampID, userID)
+	db.Exec(context.Background(), `
+		INSERT INTO cart_items (user_id, product_id, quantity) VALUES ($1, $2, 1)
+	`, userID, lampID)
+
+	productRequest := func(method, path, id string) *http.Request {
+		return withURLParam(httptest.NewRequest(method, path, nil), "id", id)
+	}
+	list := func(handle http.HandlerFunc, query string) models.ProductListResponse {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handle(w, httptest.NewRequest(http.MethodGet, "/api/v1/products?"+query, nil))
+		var resp models.ProductListResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		return resp
+	}
+
+	if resp := list(handler.GetProductsHandler, ""); resp.Total != 1 || resp.Products[0].Status != "active" {
+		t.Fatalf("Expected only the active product to be listed, got %+v", resp.Products)
+	}
+
+	w := httptest.NewRecorder()
+	handler.GetProductHandler(w, productRequest(http.MethodGet, "/api/v1/products/"+draftID.String(), draftID.String()))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected drafts to be hidden from the storefront, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.DeleteProductHandler(w, productRequest(http.MethodDelete, "/api/v1/products/"+lampID.String(), lampID.String()))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected a product with orders to be archived, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if resp := list(handler.GetProductsHandler, ""); resp.Total != 0 {
+		t.Errorf("Expected archived products to be hidden, got %+v", resp.Products)
+	}
+	if resp := list(handler.AdminListProductsHandler, "status=archived"); resp.Total != 1 || resp.Products[0].DeletedAt == nil {
+		t.Errorf("Expected admins to see the archived product, got %+v", resp.Products)
+	}
+
+	w = httptest.NewRecorder()
+	handler.GetProductHandler(w, productRequest(http.MethodGet, "/api/v1/products/"+lampID.String(), lampID.String()))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected archived products to stay viewable for order history, got %d", w.Code)
+	}
+
+	body, _ := json.Marshal(models.AddToCartRequest{ProductID: lampID.String(), Quantity: 1})
+	w = httptest.NewRecorder()
+	cartHandler.AddToCartHandler(w, withUser(httptest.NewRequest(http.MethodPost, "/api/v1/cart", bytes.NewReader(body)), userID))
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected archived products to be rejected from carts, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	cartHandler.GetCartHandler(w, withUser(httptest.NewRequest(http.MethodGet, "/api/v1/cart", nil), userID))
+	var cart models.CartResponse
+	json.NewDecoder(w.Body).Decode(&cart)
+	if len(cart.Items) != 1 || cart.Items[0].Available || cart.TotalPrice != 0 {
+		t.Errorf("Expected the cart line to stay but be marked unavailable, got %+v", cart)
+	}
+
+	w = httptest.NewRecorder()
+	handler.RestoreProductHandler(w, productRequest(http.MethodPost, "/api/v1/products/"+lampID.String()+"/restore", lampID.String()))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the product to be restored, got %d", w.Code)
+	}
+	if resp := list(handler.GetProductsHandler, ""); resp.Total != 1 || resp.Products[0].DeletedAt != nil {
+		t.Errorf("Expected the restored product to be listed again, got %+v", resp.Products)
+	}
+
+	w = httptest.NewRecorder()
+	handler.RestoreProductHandler(w, productRequest(http.MethodPost, "/api/v1/products/"+lampID.String()+"/restore", lampID.String()))
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 when restoring an active product, got %d", w.Code)
+	}
+}
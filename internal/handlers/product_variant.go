@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"context"
+	"ecommerce-api-v2/internal/models"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	maxVariantOptions     = 5
+	maxOptionValueLength  = 100
+	productVariantColumns = `id, product_id, sku, options, price, stock_quantity, created_at, updated_at`
+)
+
+var validSKU = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+func scanProductVariant(row pgx.Row, v *models.ProductVariantResponse) error {
+	return row.Scan(&v.ID, &v.ProductID, &v.SKU, &v.Options, &v.Price, &v.StockQuantity, &v.CreatedAt, &v.UpdatedAt)
+}
+
+// getProductVariants returns a product's variants ordered by SKU.
+func getProductVariants(ctx context.Context, db *pgxpool.Pool, productID string) ([]models.ProductVariantResponse, error) {
+	rows, err := db.Query(ctx, `SELECT `+productVariantColumns+` FROM product_variants WHERE product_id = $1 ORDER BY sku`, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variants := make([]models.ProductVariantResponse, 0)
+	for rows.Next() {
+		var v models.ProductVariantResponse
+		if err := scanProductVariant(rows, &v); err != nil {
+			return nil, err
+		}
+		variants = append(variants, v)
+	}
+	return variants, rows.Err()
+}
+
+// variantOptionMatrix lists, for each option name, the distinct values the
+// variants use, in the order they first appear.
+func variantOptionMatrix(variants []models.ProductVariantResponse) map[string][]string {
+	matrix := make(map[string][]string)
+	seen := make(map[string]bool)
+
+	for _, v := range variants {
+		names := make([]string, 0, len(v.Options))
+		for name := range v.Options {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			key := name + "\x00" + v.Options[name]
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			matrix[name] = append(matrix[name], v.Options[name])
+		}
+	}
+	return matrix
+}
+
+// validateVariantRequest normalizes req, or writes a 400 and returns false.
+// Option names are lower-cased so "Size" and "size" can't both exist.
+func validateVariantRequest(w http.ResponseWriter, req *models.CreateProductVariantRequest) bool {
+	req.SKU = strings.TrimSpace(req.SKU)
+	if !validSKU.MatchString(req.SKU) {
+		http.Error(w, "SKU is required and may only contain letters, digits, '.', '_' and '-' (max 64)", http.StatusBadRequest)
+		return false
+	}
+
+	if req.Price <= 0 || req.StockQuantity < 0 {
+		http.Error(w, "Invalid variant details: price must be > 0, stock cannot be negative", http.StatusBadRequest)
+		return false
+	}
+
+	if len(req.Options) > maxVariantOptions {
+		http.Error(w, "A variant can have at most 5 options", http.StatusBadRequest)
+		return false
+	}
+
+	options := make(map[string]string, len(req.Options))
+	for name, value := range req.Options {
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+		if name == "" || value == "" || len(name) > maxOptionValueLength || len(value) > maxOptionValueLength {
+			http.Error(w, "Option names and values must be non-empty and at most 100 characters", http.StatusBadRequest)
+			return false
+		}
+		if _, dup := options[name]; dup {
+			http.Error(w, "Duplicate option "+name, http.StatusBadRequest)
+			return false
+		}
+		options[name] = value
+	}
+	req.Options = options
+
+	return true
+}
+
+// variantWriteError maps a failed insert or update to a response.
+func variantWriteError(w http.ResponseWriter, err error, fallback string) {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == "23505" && pgErr.ConstraintName == "product_variants_sku_key":
+			http.Error(w, "SKU already in use", http.StatusConflict)
+			return
+		case pgErr.Code == "23505":
+			http.Error(w, "The product already has a variant with these options", http.StatusConflict)
+			return
+		case pgErr.Code == "23503":
+			http.Error(w, "Product not found", http.StatusNotFound)
+			return
+		}
+	}
+	http.Error(w, fallback, http.StatusInternalServerError)
+}
+
+func (h *ProductHandler) CreateProductVariantHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID format", http.StatusBadRequest)
+		return
+	}
+
+	var req models.CreateProductVariantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if !validateVariantRequest(w, &req) {
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, "Could not create variant", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	var v models.ProductVariantResponse
+	query := `
+		INSERT INTO product_variants (product_id, sku, options, price, stock_quantity)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING ` + productVariantColumns
+	err = scanProductVariant(tx.QueryRow(r.Context(), query, productID, req.SKU, req.Options, req.Price, req.StockQuantity), &v)
+	if err != nil {
+		variantWriteError(w, err, "Could not create variant")
+		return
+	}
+
+	if req.StockQuantity > 0 {
+		variantID := uuid.MustParse(v.ID)
+		_, err := recordStockMovement(r.Context(), tx, stockMovement{
+			ProductID: productID,
+			VariantID: &variantID,
+			Type:      movementAdjustment,
+			Delta:     req.StockQuantity,
+			Reason:    "Initial stock",
+			ActorID:   requestActor(r),
+		}, req.StockQuantity)
+		if err != nil {
+			http.Error(w, "Could not create variant", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, "Could not create variant", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (h *ProductHandler) UpdateProductVariantHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID format", http.StatusBadRequest)
+		return
+	}
+
+	variantID, err := uuid.Parse(chi.URLParam(r, "variant_id"))
+	if err != nil {
+		http.Error(w, "Invalid variant ID format", http.StatusBadRequest)
+		return
+	}
+
+	var req models.CreateProductVariantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if !validateVariantRequest(w, &req) {
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, "Could not update variant", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	var exists bool
+	lockQuery := `SELECT true FROM product_variants WHERE id = $1 AND product_id = $2 FOR UPDATE`
+	if err := tx.QueryRow(r.Context(), lockQuery, variantID, productID).Scan(&exists); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Variant not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Could not update variant", http.StatusInternalServerError)
+		return
+	}
+
+	// Like UpdateProductHandler, stock_quantity is ignored; stock
+	// adjustments change it.
+	var v models.ProductVariantResponse
+	query := `
+		UPDATE product_variants
+		SET sku = $1, options = $2, price = $3
+		WHERE id = $4
+		RETURNING ` + productVariantColumns
+	err = scanProductVariant(tx.QueryRow(r.Context(), query, req.SKU, req.Options, req.Price, variantID), &v)
+	if err != nil {
+		variantWriteError(w, err, "Could not update variant")
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, "Could not update variant", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (h *ProductHandler) DeleteProductVariantHandler(w http.ResponseWriter, r *http.Request) {
+	productID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid product ID format", http.StatusBadRequest)
+		return
+	}
+
+	variantID, err := uuid.Parse(chi.URLParam(r, "variant_id"))
+	if err != nil {
+		http.Error(w, "Invalid variant ID format", http.StatusBadRequest)
+		return
+	}
+
+	cmdTag, err := h.DB.Exec(r.Context(), `DELETE FROM product_variants WHERE id = $1 AND product_id = $2`, variantID, productID)
+	if err != nil {
+		http.Error(w, "Could not delete variant. It may be part of an existing order.", http.StatusConflict)
+		return
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		http.Error(w, "Variant not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Variant deleted successfully",
+	})
+}
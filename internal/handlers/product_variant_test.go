@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"ecommerce-api-v2/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestVariantOptionMatrix(t *testing.T) {
+	variants := []models.ProductVariantResponse{
+		{SKU: "TEE-S-RED", Options: map[string]string{"size": "S", "color": "red"}},
+		{SKU: "TEE-M-RED", Options: map[string]string{"size": "M", "color": "red"}},
+		{SKU: "TEE-M-BLUE", Options: map[string]string{"size": "M", "color": "blue"}},
+	}
+
+	matrix := variantOptionMatrix(variants)
+	if got := matrix["size"]; len(got) != 2 || got[0] != "S" || got[1] != "M" {
+		t.Errorf("Expected sizes [S M], got %v", got)
+	}
+	if got := matrix["color"]; len(got) != 2 || got[0] != "red" || got[1] != "blue" {
+		t.Errorf("Expected colors [red blue], got %v", got)
+	}
+}
+
+func TestProductVariants_CartAndCheckout(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	productHandler := &ProductHandler{DB: db}
+	cartHandler := &CartHandler{DB: db}
+	orderHandler := &OrderHandler{DB: db}
+
+	userID := uuid.New()
+	productID := uuid.New()
+
+	db.Exec(context.Background(), `
+		INSERT INTO users (id, email, password_hash, role)
+		VALUES ($1, 'variants@example.com', 'hash', 'customer')
+	`, userID)
+
+	db.Exec(context.Background(), `
+		INSERT INTO products (id, name, price, stock_quantity)
+		VALUES ($1, 'T-Shirt', 1500, 0)
+	`, productID)
+
+	createVariant := func(req models.CreateProductVariantRequest) (int, models.ProductVariantResponse) {
+		t.Helper()
+		body, _ := json.Marshal(req)
+		r := withURLParam(httptest.NewRequest(http.MethodPost, "/api/v1/products/"+productID.String()+"/variants", bytes.NewReader(body)), "id", productID.String())
+		w := httptest.NewRecorder()
+		productHandler.CreateProductVariantHandler(w, r)
+		var v models.ProductVariantResponse
+		json.NewDecoder(w.Body).Decode(&v)
+		return w.Code, v
+	}
+
+	code, medium := createVariant(models.CreateProductVariantRequest{
+		SKU: "TEE-M", Options: map[string]string{"Size": " M "}, Price: 1800, StockQuantity: 3,
+	})
+	if code != http.StatusCreated {
+		t.Fatalf("Expected variant to be created, got %d", code)
+	}
+	if medium.Options["size"] != "M" {
+		t.Errorf("Expected option names to be normalized, got %v", medium.Options)
+	}
+
+	if code, _ := createVariant(models.CreateProductVariantRequest{
+		SKU: "TEE-M-2", Options: map[string]string{"size": "M"}, Price: 1800,
+	}); code != http.StatusConflict {
+		t.Errorf("Expected 409 for a duplicate option combination, got %d", code)
+	}
+
+	addToCart := func(req models.AddToCartRequest) int {
+		t.Helper()
+		body, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		cartHandler.AddToCartHandler(w, withUser(httptest.NewRequest(http.MethodPost, "/api/v1/cart", bytes.NewReader(body)), userID))
+		return w.Code
+	}
+
+	if code := addToCart(models.AddToCartRequest{ProductID: productID.String(), Quantity: 1}); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 when adding a product with variants without a variant, got %d", code)
+	}
+	if code := addToCart(models.AddToCartRequest{ProductID: productID.String(), VariantID: uuid.NewString(), Quantity: 1}); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a variant of another product, got %d", code)
+	}
+	if code := addToCart(models.AddToCartRequest{ProductID: productID.String(), VariantID: medium.ID, Quantity: 2}); code != http.StatusOK {
+		t.Fatalf("Expected variant to be added to cart, got %d", code)
+	}
+
+	w := httptest.NewRecorder()
+	cartHandler.GetCartHandler(w, withUser(httptest.NewRequest(http.MethodGet, "/api/v1/cart", nil), userID))
+	var cart models.CartResponse
+	json.NewDecoder(w.Body).Decode(&cart)
+	if len(cart.Items) != 1 || cart.Items[0].Price != 1800 || cart.Items[0].SKU == nil || *cart.Items[0].SKU != "TEE-M" {
+		t.Fatalf("Expected the cart to hold the variant at its own price, got %+v", cart.Items)
+	}
+
+	w = httptest.NewRecorder()
+	orderHandler.CheckoutHandler(w, withUser(httptest.NewRequest(http.MethodPost, "/api/v1/checkout", nil), userID))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected checkout to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var stock int
+	db.QueryRow(context.Background(), "SELECT stock_quantity FROM product_variants WHERE id = $1", medium.ID).Scan(&stock)
+	if stock != 1 {
+		t.Errorf("Expected variant stock to drop to 1, got %d", stock)
+	}
+
+	var sku string
+	db.QueryRow(context.Background(), "SELECT sku FROM order_items WHERE variant_id = $1", medium.ID).Scan(&sku)
+	if sku != "TEE-M" {
+		t.Errorf("Expected the order item to record the SKU, got %q", sku)
+	}
+
+	w = httptest.NewRecorder()
+	productHandler.GetProductHandler(w, withURLParam(httptest.NewRequest(http.MethodGet, "/api/v1/products/"+productID.String(), nil), "id", productID.String()))
+	var product models.GetProductResponse
+	json.NewDecoder(w.Body).Decode(&product)
+	if len(product.Variants) != 1 || len(product.Options["size"]) != 1 {
+		t.Errorf("Expected the product to list its variant matrix, got %+v", product)
+	}
+}
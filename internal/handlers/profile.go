@@ -0,0 +1,388 @@
+package handlers
+
+import (
+	"context"
+	"ecommerce-api-v2/internal/middleware"
+	"ecommerce-api-v2/internal/models"
+	"ecommerce-api-v2/internal/notifier"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	maxFullNameLength = 255
+	maxPhoneLength    = 50
+)
+
+// checkPassword reports whether password matches the user's current one.
+func (h *UserHandler) checkPassword(ctx context.Context, userID uuid.UUID, password string) (bool, error) {
+	var passwordHash string
+	if err := h.DB.QueryRow(ctx, `SELECT password_hash FROM users WHERE id = $1`, userID).Scan(&passwordHash); err != nil {
+		return false, err
+	}
+	return h.hasher().Verify(password, passwordHash), nil
+}
+
+func (h *UserHandler) GetProfileHandler(w http.ResponseWriter, r *http.Request) {
+	ctxValue := r.Context().Value(middleware.UserContextKey)
+	claims, ok := ctxValue.(middleware.UserClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := `
+		SELECT id, email, full_name, phone, role, email_verified_at, totp_enabled_at IS NOT NULL, created_at
+		FROM users
+		WHERE id = $1
+	`
+
+	var p models.UserProfileResponse
+	err := h.DB.QueryRow(r.Context(), query, claims.UserID).Scan(
+		&p.ID, &p.Email, &p.FullName, &p.Phone, &p.Role, &p.EmailVerifiedAt, &p.TwoFactorEnabled, &p.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(p)
+}
+
+func (h *UserHandler) UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	ctxValue := r.Context().Value(middleware.UserContextKey)
+	claims, ok := ctxValue.(middleware.UserClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.UpdateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	if req.FullName != nil {
+		*req.FullName = strings.TrimSpace(*req.FullName)
+		if len(*req.FullName) > maxFullNameLength {
+			http.Error(w, "Full name is too long", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Phone != nil {
+		*req.Phone = strings.TrimSpace(*req.Phone)
+		if len(*req.Phone) > maxPhoneLength {
+			http.Error(w, "Phone number is too long", http.StatusBadRequest)
+			return
+		}
+	}
+
+	query := `
+		UPDATE users
+		SET full_name = COALESCE($1, full_name), phone = COALESCE($2, phone)
+		WHERE id = $3
+	`
+
+	cmdTag, err := h.DB.Exec(r.Context(), query, req.FullName, req.Phone, claims.UserID)
+	if err != nil {
+		http.Error(w, "Could not update profile", http.StatusInternalServerError)
+		return
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	h.GetProfileHandler(w, r)
+}
+
+func (h *UserHandler) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	ctxValue := r.Context().Value(middleware.UserContextKey)
+	claims, ok := ctxValue.(middleware.UserClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := uuid.Parse(claims.UserID)
+
+	var req models.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		http.Error(w, "Current and new password can't be empty", http.StatusBadRequest)
+		return
+	}
+
+	matches, err := h.checkPassword(r.Context(), userID, req.CurrentPassword)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !matches {
+		http.Error(w, "Current password is incorrect", http.StatusUnauthorized)
+		return
+	}
+
+	var email string
+	if err := h.DB.QueryRow(r.Context(), `SELECT email FROM users WHERE id = $1`, userID).Scan(&email); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if !h.checkPasswordPolicy(w, r, req.NewPassword, email) {
+		return
+	}
+
+	hashedPassword, err := h.hasher().Hash(req.NewPassword)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, "Could not change password", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	if _, err := tx.Exec(r.Context(), `UPDATE users SET password_hash = $1 WHERE id = $2`, hashedPassword, userID); err != nil {
+		http.Error(w, "Could not change password", http.StatusInternalServerError)
+		return
+	}
+
+	// Other devices must sign in again with the new password.
+	revokeQuery := `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND family_id <> $2 AND revoked_at IS NULL`
+	if _, err := tx.Exec(r.Context(), revokeQuery, userID, claims.SessionID); err != nil {
+		http.Error(w, "Could not change password", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, "Could not change password", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Password changed successfully",
+	})
+}
+
+func (h *UserHandler) ChangeEmailHandler(w http.ResponseWriter, r *http.Request) {
+	ctxValue := r.Context().Value(middleware.UserContextKey)
+	claims, ok := ctxValue.(middleware.UserClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := uuid.Parse(claims.UserID)
+
+	var req models.ChangeEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	req.NewEmail = strings.ToLower(strings.TrimSpace(req.NewEmail))
+	if req.NewEmail == "" || req.Password == "" {
+		http.Error(w, "New email or password can't be empty", http.StatusBadRequest)
+		return
+	}
+
+	if !validEmail(req.NewEmail) {
+		http.Error(w, "Invalid email address", http.StatusBadRequest)
+		return
+	}
+
+	matches, err := h.checkPassword(r.Context(), userID, req.Password)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !matches {
+		http.Error(w, "Password is incorrect", http.StatusUnauthorized)
+		return
+	}
+
+	var currentEmail string
+	var taken bool
+	query := `
+		SELECT email, EXISTS (SELECT 1 FROM users WHERE email = $2)
+		FROM users
+		WHERE id = $1
+	`
+	if err := h.DB.QueryRow(r.Context(), query, userID, req.NewEmail).Scan(&currentEmail, &taken); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if currentEmail == req.NewEmail {
+		http.Error(w, "New email is the same as the current one", http.StatusBadRequest)
+		return
+	}
+	if taken {
+		http.Error(w, "Email already in use", http.StatusConflict)
+		return
+	}
+
+	token, err := createVerificationToken(r.Context(), h.DB, userID, req.NewEmail)
+	if err != nil {
+		http.Error(w, "Could not create verification token", http.StatusInternalServerError)
+		return
+	}
+
+	h.sendVerificationEmail(r.Context(), req.NewEmail, token)
+	h.notify(r.Context(), notifier.Message{
+		To:      currentEmail,
+		Subject: "Email change requested",
+		Body:    "A change of your account email to " + req.NewEmail + " was requested. If this wasn't you, reset your password immediately.",
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Check your new email address to confirm the change",
+	})
+}
+
+// anonymizeUser scrubs personal data from a user row that can't be deleted
+// because orders still reference it, and removes everything else tied to
+// the account.
+func anonymizeUser(ctx context.Context, tx pgx.Tx, userID uuid.UUID) error {
+	attemptsQuery := `DELETE FROM login_attempts WHERE email = (SELECT email FROM users WHERE id = $1)`
+	if _, err := tx.Exec(ctx, attemptsQuery, userID); err != nil {
+		return err
+	}
+	linkRequestsQuery := `DELETE FROM magic_link_requests WHERE email = (SELECT email FROM users WHERE id = $1)`
+	if _, err := tx.Exec(ctx, linkRequestsQuery, userID); err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE users SET
+			email = 'deleted-' || id || '@deleted.invalid',
+			password_hash = '!',
+			full_name = '',
+			phone = '',
+			role = 'customer',
+			email_verified_at = NULL,
+			totp_secret = NULL,
+			totp_enabled_at = NULL,
+			totp_last_used_step = NULL,
+			failed_login_attempts = 0,
+			locked_until = NULL,
+			deleted_at = NOW()
+		WHERE id = $1
+	`
+	if _, err := tx.Exec(ctx, query, userID); err != nil {
+		return err
+	}
+
+	cleanup := []string{
+		`DELETE FROM cart_items WHERE user_id = $1`,
+		`DELETE FROM sessions WHERE user_id = $1`,
+		`DELETE FROM password_reset_tokens WHERE user_id = $1`,
+		`DELETE FROM email_verification_tokens WHERE user_id = $1`,
+		`DELETE FROM recovery_codes WHERE user_id = $1`,
+		`DELETE FROM api_keys WHERE created_by = $1`,
+		`DELETE FROM user_identities WHERE user_id = $1`,
+		`DELETE FROM magic_link_tokens WHERE user_id = $1`,
+	}
+	for _, stmt := range cleanup {
+		if _, err := tx.Exec(ctx, stmt, userID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// eraseUser deletes the user outright when they have never ordered.
+// orders.user_id is ON DELETE RESTRICT, so customers who have ordered are
+// anonymized instead to keep their order history intact for accounting.
+func eraseUser(ctx context.Context, tx pgx.Tx, userID uuid.UUID) error {
+	var hasOrders bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM orders WHERE user_id = $1)`, userID).Scan(&hasOrders); err != nil {
+		return err
+	}
+
+	if hasOrders {
+		return anonymizeUser(ctx, tx, userID)
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM login_attempts WHERE email = (SELECT email FROM users WHERE id = $1)`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM magic_link_requests WHERE email = (SELECT email FROM users WHERE id = $1)`, userID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, `DELETE FROM users WHERE id = $1`, userID)
+	return err
+}
+
+func (h *UserHandler) DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	ctxValue := r.Context().Value(middleware.UserContextKey)
+	claims, ok := ctxValue.(middleware.UserClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := uuid.Parse(claims.UserID)
+
+	var req models.DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	matches, err := h.checkPassword(r.Context(), userID, req.Password)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !matches {
+		http.Error(w, "Password is incorrect", http.StatusUnauthorized)
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, "Could not delete account", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	if err := eraseUser(r.Context(), tx, userID); err != nil {
+		http.Error(w, "Could not delete account", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, "Could not delete account", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Account deleted successfully",
+	})
+}
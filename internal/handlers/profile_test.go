@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"ecommerce-api-v2/internal/middleware"
+	"ecommerce-api-v2/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func withUser(req *http.Request, userID uuid.UUID) *http.Request {
+	ctx := context.WithValue(req.Context(), middleware.UserContextKey, middleware.UserClaims{
+		UserID:    userID.String(),
+		Role:      "customer",
+		SessionID: uuid.NewString(),
+	})
+	return req.WithContext(ctx)
+}
+
+func TestChangePasswordHandler_RequiresCurrentPassword(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	handler := &UserHandler{DB: db}
+
+	userID := registerTestUser(t, handler, "changer@example.com")
+
+	change := func(current string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(models.ChangePasswordRequest{CurrentPassword: current, NewPassword: "brandnewpassword"})
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/users/me/password", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.ChangePasswordHandler(w, withUser(req, userID))
+		return w
+	}
+
+	if w := change("not-my-password"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 with a wrong current password, got %d", w.Code)
+	}
+
+	if w := change("securepassword123"); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 OK with the correct current password, got %d", w.Code)
+	}
+}
+
+func TestDeleteAccountHandler_AnonymizesCustomersWithOrders(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	handler := &UserHandler{DB: db}
+
+	userID := registerTestUser(t, handler, "leaving@example.com")
+
+	_, err := db.Exec(context.Background(), `
+		INSERT INTO orders (user_id, total_amount, status) VALUES ($1, 1000, 'delivered')
+	`, userID)
+	if err != nil {
+		t.Fatalf("Failed to insert test order: %v", err)
+	}
+
+	body, _ := json.Marshal(models.DeleteAccountRequest{Password: "securepassword123"})
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/users/me", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.DeleteAccountHandler(w, withUser(req, userID))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK for account deletion, got %d", w.Code)
+	}
+
+	var email string
+	if err := db.QueryRow(context.Background(), "SELECT email FROM users WHERE id = $1", userID).Scan(&email); err != nil {
+		t.Fatalf("Expected the user row to be kept for its orders: %v", err)
+	}
+	if !strings.HasSuffix(email, "@deleted.invalid") {
+		t.Errorf("Expected email to be anonymized, got %q", email)
+	}
+
+	var orderCount int
+	db.QueryRow(context.Background(), "SELECT COUNT(*) FROM orders WHERE user_id = $1", userID).Scan(&orderCount)
+	if orderCount != 1 {
+		t.Errorf("Expected order history to be preserved, found %d orders", orderCount)
+	}
+}
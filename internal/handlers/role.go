@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"ecommerce-api-v2/internal/middleware"
+	"ecommerce-api-v2/internal/models"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type RoleHandler struct {
+	DB *pgxpool.Pool
+}
+
+func (h *RoleHandler) GetRolesHandler(w http.ResponseWriter, r *http.Request) {
+	query := `
+		SELECT r.name, r.description,
+			COALESCE(array_agg(rp.permission ORDER BY rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '{}'),
+			r.magic_link_enabled
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role = r.name
+		GROUP BY r.name, r.description, r.magic_link_enabled
+		ORDER BY r.name
+	`
+
+	rows, err := h.DB.Query(r.Context(), query)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	roles := make([]models.RoleResponse, 0)
+
+	for rows.Next() {
+		var role models.RoleResponse
+		if err := rows.Scan(&role.Name, &role.Description, &role.Permissions, &role.MagicLinkEnabled); err != nil {
+			http.Error(w, "Error reading roles", http.StatusInternalServerError)
+			return
+		}
+		roles = append(roles, role)
+	}
+
+	if rows.Err() != nil {
+		http.Error(w, "Error iterating over roles", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(roles)
+}
+
+func (h *RoleHandler) AssignRoleHandler(w http.ResponseWriter, r *http.Request) {
+	ctxValue := r.Context().Value(middleware.UserContextKey)
+	claims, ok := ctxValue.(middleware.UserClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID format", http.StatusBadRequest)
+		return
+	}
+
+	if userID.String() == claims.UserID {
+		http.Error(w, "You cannot change your own role", http.StatusBadRequest)
+		return
+	}
+
+	var req models.AssignRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+		return
+	}
+
+	req.Role = strings.TrimSpace(req.Role)
+	if req.Role == "" {
+		http.Error(w, "Role is required", http.StatusBadRequest)
+		return
+	}
+
+	actorID, _ := uuid.Parse(claims.UserID)
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, "Database error while assigning role", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	var previousRole string
+	query := `
+		UPDATE users u SET role = $1
+		FROM (SELECT id, role FROM users WHERE id = $2 FOR UPDATE) prev
+		WHERE u.id = prev.id
+		RETURNING prev.role
+	`
+	err = tx.QueryRow(r.Context(), query, req.Role, userID).Scan(&previousRole)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			http.Error(w, "Unknown role", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Database error while assigning role", http.StatusInternalServerError)
+		return
+	}
+
+	details := map[string]any{"from": previousRole, "to": req.Role}
+	if err := recordAudit(r, tx, &actorID, auditRoleChanged, userID, details); err != nil {
+		http.Error(w, "Database error while assigning role", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, "Database error while assigning role", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "User role updated to " + req.Role,
+	})
+}
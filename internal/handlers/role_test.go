@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"ecommerce-api-v2/internal/middleware"
+	"ecommerce-api-v2/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func TestAssignRoleHandler(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	handler := &RoleHandler{DB: db}
+
+	adminID := uuid.New()
+	userID := uuid.New()
+
+	db.Exec(context.Background(), `
+		INSERT INTO users (id, email, password_hash, role) 
+		VALUES ($1, 'boss@example.com', 'hash', 'admin'), ($2, 'staff@example.com', 'hash', 'customer')
+	`, adminID, userID)
+
+	assign := func(role string) *httptest.ResponseRecorder {
+		bodyBytes, _ := json.Marshal(models.AssignRoleRequest{Role: role})
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/admin/users/"+userID.String()+"/role", bytes.NewReader(bodyBytes))
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", userID.String())
+		ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+		ctx = context.WithValue(ctx, middleware.UserContextKey, middleware.UserClaims{
+			UserID: adminID.String(),
+			Role:   "admin",
+		})
+		req = req.WithContext(ctx)
+
+		w := httptest.NewRecorder()
+		handler.AssignRoleHandler(w, req)
+		return w
+	}
+
+	if w := assign("catalog_manager"); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK when assigning a known role, got %d", w.Code)
+	}
+
+	var role string
+	db.QueryRow(context.Background(), "SELECT role FROM users WHERE id = $1", userID).Scan(&role)
+	if role != "catalog_manager" {
+		t.Errorf("Expected role to be catalog_manager, got %q", role)
+	}
+
+	if w := assign("overlord"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 Bad Request for an unknown role, got %d", w.Code)
+	}
+}
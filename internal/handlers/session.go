@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"ecommerce-api-v2/internal/middleware"
+	"ecommerce-api-v2/internal/models"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// execer is satisfied by both *pgxpool.Pool and pgx.Tx.
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (h *UserHandler) signAccessToken(user models.User, sessionID uuid.UUID) (string, error) {
+	now := time.Now()
+	claims := models.Claims{
+		UserID:    user.ID,
+		Role:      user.Role,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(accessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	return h.Keys.Sign(&claims)
+}
+
+// createSession starts a new refresh token family for the user and returns
+// the access token and refresh token pair for it. twoFactor records whether
+// the login passed a second factor.
+func (h *UserHandler) createSession(ctx context.Context, user models.User, twoFactor bool) (string, string, error) {
+	refreshToken, err := generateToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	familyID := uuid.New()
+
+	query := `
+		INSERT INTO sessions (family_id, user_id, refresh_token_hash, expires_at, two_factor_verified)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	_, err = h.DB.Exec(ctx, query, familyID, user.ID, hashToken(refreshToken), time.Now().Add(refreshTokenTTL), twoFactor)
+	if err != nil {
+		return "", "", err
+	}
+
+	accessToken, err := h.signAccessToken(user, familyID)
+	if err != nil {
+		return "", "", err
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+func writeTokenPair(w http.ResponseWriter, accessToken, refreshToken string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"token":         accessToken,
+		"refresh_token": refreshToken,
+	})
+}
+
+func (h *UserHandler) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.RefreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	req.RefreshToken = strings.TrimSpace(req.RefreshToken)
+	if req.RefreshToken == "" {
+		http.Error(w, "Refresh token can't be empty", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, "Could not refresh session", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	query := `
+		SELECT s.id, s.family_id, s.expires_at, s.used_at, s.revoked_at, s.two_factor_verified, u.id, u.email, u.role, u.suspended_at
+		FROM sessions s
+		JOIN users u ON s.user_id = u.id
+		WHERE s.refresh_token_hash = $1
+		FOR UPDATE OF s
+	`
+
+	var sessionID, familyID uuid.UUID
+	var expiresAt time.Time
+	var usedAt, revokedAt, suspendedAt *time.Time
+	var twoFactor bool
+	var user models.User
+
+	err = tx.QueryRow(r.Context(), query, hashToken(req.RefreshToken)).Scan(
+		&sessionID, &familyID, &expiresAt, &usedAt, &revokedAt, &twoFactor, &user.ID, &user.Email, &user.Role, &suspendedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Could not refresh session", http.StatusInternalServerError)
+		return
+	}
+
+	if revokedAt != nil || time.Now().After(expiresAt) {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	if suspendedAt != nil {
+		http.Error(w, "Account suspended", http.StatusForbidden)
+		return
+	}
+
+	if usedAt != nil {
+		// A rotated token was presented again, so either the client or an
+		// attacker holds a stolen copy. Kill every token in the family.
+		revokeQuery := `UPDATE sessions SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`
+		if _, err := tx.Exec(r.Context(), revokeQuery, familyID); err != nil {
+			http.Error(w, "Could not refresh session", http.StatusInternalServerError)
+			return
+		}
+		if err := tx.Commit(r.Context()); err != nil {
+			http.Error(w, "Could not refresh session", http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, "Refresh token reuse detected, session revoked", http.StatusUnauthorized)
+		return
+	}
+
+	newRefreshToken, err := generateToken()
+	if err != nil {
+		http.Error(w, "Could not refresh session", http.StatusInternalServerError)
+		return
+	}
+
+	markUsedQuery := `UPDATE sessions SET used_at = NOW() WHERE id = $1`
+	if _, err := tx.Exec(r.Context(), markUsedQuery, sessionID); err != nil {
+		http.Error(w, "Could not refresh session", http.StatusInternalServerError)
+		return
+	}
+
+	insertQuery := `
+		INSERT INTO sessions (family_id, user_id, refresh_token_hash, expires_at, two_factor_verified)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	if _, err := tx.Exec(r.Context(), insertQuery, familyID, user.ID, hashToken(newRefreshToken), expiresAt, twoFactor); err != nil {
+		http.Error(w, "Could not refresh session", http.StatusInternalServerError)
+		return
+	}
+
+	accessToken, err := h.signAccessToken(user, familyID)
+	if err != nil {
+		http.Error(w, "Could not generate token", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, "Could not refresh session", http.StatusInternalServerError)
+		return
+	}
+
+	writeTokenPair(w, accessToken, newRefreshToken)
+}
+
+func (h *UserHandler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	ctxValue := r.Context().Value(middleware.UserContextKey)
+	claims, ok := ctxValue.(middleware.UserClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL`
+
+	if _, err := h.DB.Exec(r.Context(), query, claims.SessionID, claims.UserID); err != nil {
+		http.Error(w, "Could not log out", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Logged out successfully",
+	})
+}
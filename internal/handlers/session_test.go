@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"ecommerce-api-v2/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func loginTestUser(t *testing.T, handler *UserHandler, email, password string) map[string]string {
+	t.Helper()
+
+	bodyBytes, _ := json.Marshal(map[string]string{
+		"email":    email,
+		"password": password,
+	})
+
+	reqReg := httptest.NewRequest(http.MethodPost, "/api/v1/users/register", bytes.NewReader(bodyBytes))
+	wReg := httptest.NewRecorder()
+	handler.RegisterUserHandler(wReg, reqReg)
+	if wReg.Code != http.StatusCreated {
+		t.Fatalf("Test setup failed: expected user to be created, got status %d", wReg.Code)
+	}
+
+	reqLogin := httptest.NewRequest(http.MethodPost, "/api/v1/users/login", bytes.NewReader(bodyBytes))
+	wLogin := httptest.NewRecorder()
+	handler.LoginUserHandler(wLogin, reqLogin)
+	if wLogin.Code != http.StatusOK {
+		t.Fatalf("Test setup failed: expected login to succeed, got status %d", wLogin.Code)
+	}
+
+	var tokens map[string]string
+	if err := json.NewDecoder(wLogin.Body).Decode(&tokens); err != nil {
+		t.Fatalf("Failed to decode login response: %v", err)
+	}
+	return tokens
+}
+
+func refresh(handler *UserHandler, refreshToken string) *httptest.ResponseRecorder {
+	bodyBytes, _ := json.Marshal(models.RefreshTokenRequest{RefreshToken: refreshToken})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/refresh", bytes.NewReader(bodyBytes))
+	w := httptest.NewRecorder()
+	handler.RefreshTokenHandler(w, req)
+	return w
+}
+
+func TestRefreshTokenHandler_Rotation(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	handler := &UserHandler{DB: db, Keys: testKeySet(t)}
+
+	tokens := loginTestUser(t, handler, "refresh@example.com", "securepassword123")
+	if tokens["refresh_token"] == "" {
+		t.Fatalf("Expected 'refresh_token' in login response")
+	}
+
+	w := refresh(handler, tokens["refresh_token"])
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK for refresh, got %d", w.Code)
+	}
+
+	var rotated map[string]string
+	json.NewDecoder(w.Body).Decode(&rotated)
+
+	if rotated["refresh_token"] == "" || rotated["refresh_token"] == tokens["refresh_token"] {
+		t.Errorf("Expected a new refresh token after rotation")
+	}
+	if rotated["token"] == "" {
+		t.Errorf("Expected a new access token after rotation")
+	}
+}
+
+func TestRefreshTokenHandler_ReuseRevokesFamily(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	handler := &UserHandler{DB: db, Keys: testKeySet(t)}
+
+	tokens := loginTestUser(t, handler, "reuse@example.com", "securepassword123")
+
+	w1 := refresh(handler, tokens["refresh_token"])
+	if w1.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK for first refresh, got %d", w1.Code)
+	}
+
+	var rotated map[string]string
+	json.NewDecoder(w1.Body).Decode(&rotated)
+
+	w2 := refresh(handler, tokens["refresh_token"])
+	if w2.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 Unauthorized when reusing a rotated token, got %d", w2.Code)
+	}
+
+	w3 := refresh(handler, rotated["refresh_token"])
+	if w3.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the whole token family to be revoked after reuse, got %d", w3.Code)
+	}
+
+	var active int
+	db.QueryRow(context.Background(), "SELECT COUNT(*) FROM sessions WHERE revoked_at IS NULL").Scan(&active)
+	if active != 0 {
+		t.Errorf("Expected no active sessions after reuse detection, found %d", active)
+	}
+}
@@ -2,7 +2,12 @@ package handlers
 
 import (
 	"context"
+	"ecommerce-api-v2/internal/auth"
+	"ecommerce-api-v2/internal/notifier"
 	"log"
+	"strings"
+	"sync"
+	"testing"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -16,7 +21,7 @@ func setupTestDB() *pgxpool.Pool {
 	}
 
 	_, err = pool.Exec(context.Background(), `
-		TRUNCATE TABLE cart_items, order_items, orders, products, users CASCADE;
+		TRUNCATE TABLE inventory_movements, product_import_errors, product_import_jobs, product_images, product_variants, product_categories, categories, erasure_requests, magic_link_requests, magic_link_tokens, oidc_login_states, user_identities, api_keys, recovery_codes, audit_logs, login_attempts, email_verification_tokens, password_reset_tokens, sessions, cart_items, order_items, orders, products, users CASCADE;
 	`)
 	if err != nil {
 		log.Fatalf("Failed to truncate tables: %v", err)
@@ -24,3 +29,45 @@ func setupTestDB() *pgxpool.Pool {
 
 	return pool
 }
+
+type recordingNotifier struct {
+	mu       sync.Mutex
+	messages []notifier.Message
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, msg notifier.Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.messages = append(n.messages, msg)
+	return nil
+}
+
+func (n *recordingNotifier) last() (notifier.Message, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(n.messages) == 0 {
+		return notifier.Message{}, false
+	}
+	return n.messages[len(n.messages)-1], true
+}
+
+// lastToken returns the token from the most recent message, which is always
+// the final line of the body.
+func (n *recordingNotifier) lastToken() string {
+	msg, ok := n.last()
+	if !ok {
+		return ""
+	}
+	lines := strings.Split(strings.TrimSpace(msg.Body), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+func testKeySet(t *testing.T) *auth.KeySet {
+	t.Helper()
+
+	keys, err := auth.LoadKeySet(t.TempDir(), "EdDSA")
+	if err != nil {
+		t.Fatalf("Failed to create signing keys: %v", err)
+	}
+	return keys
+}
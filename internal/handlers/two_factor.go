@@ -0,0 +1,425 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"ecommerce-api-v2/internal/auth"
+	"ecommerce-api-v2/internal/middleware"
+	"ecommerce-api-v2/internal/models"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	totpIssuer             = "Ecommerce API"
+	twoFactorChallengeTTL  = 5 * time.Minute
+	twoFactorPurpose       = "2fa"
+	recoveryCodeCount      = 10
+	recoveryCodeHalfLength = 5
+)
+
+func (h *UserHandler) signChallengeToken(userID uuid.UUID) (string, error) {
+	now := time.Now()
+	claims := models.ChallengeClaims{
+		UserID:  userID,
+		Purpose: twoFactorPurpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(twoFactorChallengeTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	return h.Keys.Sign(&claims)
+}
+
+// writeTwoFactorChallenge answers a login whose first factor succeeded with
+// a challenge token to redeem at /users/login/2fa.
+func (h *UserHandler) writeTwoFactorChallenge(w http.ResponseWriter, userID uuid.UUID) {
+	challengeToken, err := h.signChallengeToken(userID)
+	if err != nil {
+		http.Error(w, "Could not generate token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"two_factor_required": true,
+		"challenge_token":     challengeToken,
+	})
+}
+
+func (h *UserHandler) parseChallengeToken(tokenString string) (uuid.UUID, error) {
+	claims := &models.ChallengeClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, h.Keys.Keyfunc, jwt.WithValidMethods(auth.ValidMethods))
+	if err != nil || !token.Valid {
+		return uuid.Nil, errors.New("invalid challenge token")
+	}
+	if claims.Purpose != twoFactorPurpose {
+		return uuid.Nil, errors.New("token is not a two-factor challenge")
+	}
+	return claims.UserID, nil
+}
+
+func generateRecoveryCodes() ([]string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, recoveryCodeCount)
+
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(encoding.EncodeToString(b))[:2*recoveryCodeHalfLength]
+		codes[i] = code[:recoveryCodeHalfLength] + "-" + code[recoveryCodeHalfLength:]
+	}
+
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID uuid.UUID) ([]string, error) {
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return nil, err
+	}
+
+	for _, code := range codes {
+		query := `INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`
+		if _, err := tx.Exec(ctx, query, userID, hashToken(normalizeRecoveryCode(code))); err != nil {
+			return nil, err
+		}
+	}
+
+	return codes, nil
+}
+
+// verifySecondFactor checks a TOTP code or, failing that, a recovery code
+// for the user and consumes whichever matched so it can't be replayed.
+func verifySecondFactor(ctx context.Context, tx pgx.Tx, userID uuid.UUID, code, recoveryCode string) (bool, error) {
+	var secret *string
+	var lastUsedStep *int64
+
+	query := `SELECT totp_secret, totp_last_used_step FROM users WHERE id = $1 FOR UPDATE`
+	if err := tx.QueryRow(ctx, query, userID).Scan(&secret, &lastUsedStep); err != nil {
+		return false, err
+	}
+
+	if secret == nil {
+		return false, nil
+	}
+
+	if code != "" {
+		step, ok := auth.ValidateTOTP(*secret, code, time.Now())
+		if ok && (lastUsedStep == nil || step > *lastUsedStep) {
+			if _, err := tx.Exec(ctx, `UPDATE users SET totp_last_used_step = $1 WHERE id = $2`, step, userID); err != nil {
+				return false, err
+			}
+			return true, nil
+		}
+	}
+
+	if recoveryCode != "" {
+		query := `
+			UPDATE recovery_codes SET used_at = NOW()
+			WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+		`
+		cmdTag, err := tx.Exec(ctx, query, userID, hashToken(normalizeRecoveryCode(recoveryCode)))
+		if err != nil {
+			return false, err
+		}
+		return cmdTag.RowsAffected() == 1, nil
+	}
+
+	return false, nil
+}
+
+func (h *UserHandler) EnrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	ctxValue := r.Context().Value(middleware.UserContextKey)
+	claims, ok := ctxValue.(middleware.UserClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var email string
+	var enabledAt *time.Time
+	query := `SELECT email, totp_enabled_at FROM users WHERE id = $1`
+	if err := h.DB.QueryRow(r.Context(), query, claims.UserID).Scan(&email, &enabledAt); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if enabledAt != nil {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	updateQuery := `UPDATE users SET totp_secret = $1, totp_last_used_step = NULL WHERE id = $2`
+	if _, err := h.DB.Exec(r.Context(), updateQuery, secret, claims.UserID); err != nil {
+		http.Error(w, "Could not start enrollment", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.TwoFactorEnrollResponse{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(totpIssuer, email, secret),
+	})
+}
+
+func (h *UserHandler) ConfirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	ctxValue := r.Context().Value(middleware.UserContextKey)
+	claims, ok := ctxValue.(middleware.UserClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := uuid.Parse(claims.UserID)
+
+	var req models.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, "Could not enable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	var enabledAt *time.Time
+	if err := tx.QueryRow(r.Context(), `SELECT totp_enabled_at FROM users WHERE id = $1`, userID).Scan(&enabledAt); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if enabledAt != nil {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	valid, err := verifySecondFactor(r.Context(), tx, userID, req.Code, "")
+	if err != nil {
+		http.Error(w, "Could not enable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		http.Error(w, "Invalid two-factor code", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := tx.Exec(r.Context(), `UPDATE users SET totp_enabled_at = NOW() WHERE id = $1`, userID); err != nil {
+		http.Error(w, "Could not enable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(r.Context(), tx, userID)
+	if err != nil {
+		http.Error(w, "Could not generate recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	// Sessions opened with only a password are closed; this one stays, and
+	// counts as verified since its user has just entered a code.
+	revokeQuery := `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND family_id <> $2 AND revoked_at IS NULL`
+	if _, err := tx.Exec(r.Context(), revokeQuery, userID, claims.SessionID); err != nil {
+		http.Error(w, "Could not enable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	verifyQuery := `UPDATE sessions SET two_factor_verified = TRUE WHERE family_id = $1`
+	if _, err := tx.Exec(r.Context(), verifyQuery, claims.SessionID); err != nil {
+		http.Error(w, "Could not enable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, "Could not enable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"message":        "Two-factor authentication enabled. Store these recovery codes somewhere safe, they will not be shown again.",
+		"recovery_codes": codes,
+	})
+}
+
+func (h *UserHandler) DisableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	ctxValue := r.Context().Value(middleware.UserContextKey)
+	claims, ok := ctxValue.(middleware.UserClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userID, _ := uuid.Parse(claims.UserID)
+
+	var req models.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, "Could not disable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	var enabledAt *time.Time
+	if err := tx.QueryRow(r.Context(), `SELECT totp_enabled_at FROM users WHERE id = $1`, userID).Scan(&enabledAt); err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if enabledAt == nil {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	valid, err := verifySecondFactor(r.Context(), tx, userID, req.Code, req.Code)
+	if err != nil {
+		http.Error(w, "Could not disable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		http.Error(w, "Invalid two-factor code", http.StatusBadRequest)
+		return
+	}
+
+	disableQuery := `
+		UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_used_step = NULL
+		WHERE id = $1
+	`
+	if _, err := tx.Exec(r.Context(), disableQuery, userID); err != nil {
+		http.Error(w, "Could not disable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := tx.Exec(r.Context(), `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		http.Error(w, "Could not disable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, "Could not disable two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+func (h *UserHandler) TwoFactorLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.ChallengeToken == "" || (req.Code == "" && req.RecoveryCode == "") {
+		http.Error(w, "Challenge token and a code or recovery code are required", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := h.parseChallengeToken(req.ChallengeToken)
+	if err != nil {
+		http.Error(w, "Invalid or expired challenge token", http.StatusUnauthorized)
+		return
+	}
+
+	var user models.User
+	var lockedUntil, suspendedAt *time.Time
+	query := `SELECT id, email, role, locked_until, suspended_at FROM users WHERE id = $1`
+	if err := h.DB.QueryRow(r.Context(), query, userID).Scan(&user.ID, &user.Email, &user.Role, &lockedUntil, &suspendedAt); err != nil {
+		http.Error(w, "Invalid or expired challenge token", http.StatusUnauthorized)
+		return
+	}
+
+	if suspendedAt != nil {
+		http.Error(w, "Account suspended", http.StatusForbidden)
+		return
+	}
+
+	ip := clientIP(r)
+
+	wait, err := h.checkLoginThrottle(r, user.Email, ip)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if wait > 0 {
+		tooManyAttempts(w, wait)
+		return
+	}
+
+	if lockedUntil != nil && time.Now().Before(*lockedUntil) {
+		if err := h.recordLoginAttempt(r, user.Email, ip, false); err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	valid, err := verifySecondFactor(r.Context(), tx, user.ID, req.Code, req.RecoveryCode)
+	if err == nil {
+		err = tx.Commit(r.Context())
+	}
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !valid {
+		// Wrong codes count towards the same lockout as wrong passwords.
+		if err := h.recordAccountFailure(r, user.ID); err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		if err := h.recordLoginAttempt(r, user.Email, ip, false); err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, "Invalid two-factor code", http.StatusUnauthorized)
+		return
+	}
+
+	h.completeLogin(w, r, user, ip, true)
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"ecommerce-api-v2/internal/auth"
+	"ecommerce-api-v2/internal/middleware"
+	"ecommerce-api-v2/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTwoFactor_EnrollAndLogin(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	handler := &UserHandler{DB: db, Keys: testKeySet(t)}
+
+	userID := registerTestUser(t, handler, "careful@example.com")
+
+	authed := func(req *http.Request) *http.Request {
+		ctx := context.WithValue(req.Context(), middleware.UserContextKey, middleware.UserClaims{
+			UserID: userID.String(),
+			Role:   "customer",
+		})
+		return req.WithContext(ctx)
+	}
+
+	wEnroll := httptest.NewRecorder()
+	handler.EnrollTwoFactorHandler(wEnroll, authed(httptest.NewRequest(http.MethodPost, "/api/v1/users/2fa/enroll", nil)))
+	if wEnroll.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK for enrollment, got %d", wEnroll.Code)
+	}
+
+	var enrollment models.TwoFactorEnrollResponse
+	json.NewDecoder(wEnroll.Body).Decode(&enrollment)
+
+	code, _ := auth.TOTPCode(enrollment.Secret, time.Now())
+	confirmBody, _ := json.Marshal(models.TwoFactorCodeRequest{Code: code})
+	wConfirm := httptest.NewRecorder()
+	handler.ConfirmTwoFactorHandler(wConfirm, authed(httptest.NewRequest(http.MethodPost, "/api/v1/users/2fa/confirm", bytes.NewReader(confirmBody))))
+	if wConfirm.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK for confirmation, got %d", wConfirm.Code)
+	}
+
+	var confirmation struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	json.NewDecoder(wConfirm.Body).Decode(&confirmation)
+	if len(confirmation.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("Expected %d recovery codes, got %d", recoveryCodeCount, len(confirmation.RecoveryCodes))
+	}
+
+	loginBody, _ := json.Marshal(models.LoginUserRequest{Email: "careful@example.com", Password: "securepassword123"})
+	wLogin := httptest.NewRecorder()
+	handler.LoginUserHandler(wLogin, httptest.NewRequest(http.MethodPost, "/api/v1/users/login", bytes.NewReader(loginBody)))
+
+	var challenge map[string]any
+	json.NewDecoder(wLogin.Body).Decode(&challenge)
+	if _, exists := challenge["token"]; exists {
+		t.Fatalf("CRITICAL SECURITY FAILURE: Access token returned before the second factor was checked!")
+	}
+	challengeToken, _ := challenge["challenge_token"].(string)
+	if challengeToken == "" {
+		t.Fatalf("Expected a challenge token when 2FA is enabled")
+	}
+
+	secondFactor := func(req models.TwoFactorLoginRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		handler.TwoFactorLoginHandler(w, httptest.NewRequest(http.MethodPost, "/api/v1/users/login/2fa", bytes.NewReader(body)))
+		return w
+	}
+
+	recovery := confirmation.RecoveryCodes[0]
+	if w := secondFactor(models.TwoFactorLoginRequest{ChallengeToken: challengeToken, RecoveryCode: recovery}); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 OK with a recovery code, got %d", w.Code)
+	}
+
+	var verified int
+	db.QueryRow(context.Background(), `SELECT COUNT(*) FROM sessions WHERE user_id = $1 AND two_factor_verified`, userID).Scan(&verified)
+	if verified != 1 {
+		t.Errorf("Expected the session opened with a second factor to be marked verified, found %d", verified)
+	}
+
+	if w := secondFactor(models.TwoFactorLoginRequest{ChallengeToken: challengeToken, RecoveryCode: recovery}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected recovery codes to be single-use, got %d on second use", w.Code)
+	}
+}
@@ -1,23 +1,134 @@
 package handlers
 
 import (
+	"context"
+	"ecommerce-api-v2/internal/auth"
 	"ecommerce-api-v2/internal/models"
+	"ecommerce-api-v2/internal/notifier"
+	"ecommerce-api-v2/internal/oidc"
+	"ecommerce-api-v2/internal/pagination"
+	"ecommerce-api-v2/internal/password"
 	"encoding/json"
 	"errors"
+	"log"
 	"net/http"
+	"net/mail"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"golang.org/x/crypto/bcrypt"
 )
 
+// dummyPasswordHashes caches one hash of a throwaway password per hasher
+// configuration, keyed by password.Hasher.
+var dummyPasswordHashes sync.Map
+
+// dummyPasswordHash returns a hash made with the given hasher, so comparing
+// against it costs as much as checking a real password.
+func dummyPasswordHash(hasher password.Hasher) string {
+	if hash, ok := dummyPasswordHashes.Load(hasher); ok {
+		return hash.(string)
+	}
+	hash, _ := hasher.Hash("dummy-password")
+	actual, _ := dummyPasswordHashes.LoadOrStore(hasher, hash)
+	return actual.(string)
+}
+
 type UserHandler struct {
-	DB        *pgxpool.Pool
-	JWTSecret []byte
+	DB            *pgxpool.Pool
+	Keys          *auth.KeySet
+	Notifier      notifier.Notifier
+	LoginPolicy   LoginPolicy
+	OIDCProviders map[string]*oidc.Provider
+	// MagicLinkURL is prepended to the token in sign-in link emails, e.g.
+	// "https://shop.example.com/login/link?token=". Without it the email
+	// contains only the token.
+	MagicLinkURL string
+	// PasswordPolicy applies to every new password; DefaultPolicy is used
+	// when it is nil.
+	PasswordPolicy *password.Policy
+	// PasswordHasher hashes new passwords and decides when stored hashes
+	// are upgraded at login; DefaultHasher is used when it is nil.
+	PasswordHasher *password.Hasher
+	// Cursors signs pagination cursors for the admin user list; a
+	// per-process key is used when it is nil.
+	Cursors *pagination.Signer
+
+	// background tracks work started by runInBackground, so tests can wait
+	// for it.
+	background sync.WaitGroup
+}
+
+func (h *UserHandler) hasher() password.Hasher {
+	if h.PasswordHasher != nil {
+		return *h.PasswordHasher
+	}
+	return password.DefaultHasher()
+}
+
+// notify delivers msg through the configured notifier, falling back to the
+// log when none is set. Delivery failures are logged rather than returned
+// because callers must not reveal them to the client.
+func (h *UserHandler) notify(ctx context.Context, msg notifier.Message) {
+	n := h.Notifier
+	if n == nil {
+		n = &notifier.LogNotifier{}
+	}
+	if err := n.Notify(ctx, msg); err != nil {
+		log.Printf("Failed to send %q notification: %v", msg.Subject, err)
+	}
+}
+
+// backgroundTimeout bounds work that outlives the request that started it.
+const backgroundTimeout = time.Minute
+
+// runInBackground runs fn after the request has been answered, so that how
+// long fn takes can't be read from the response time. fn's context keeps
+// the request's values but isn't cancelled with it.
+func (h *UserHandler) runInBackground(ctx context.Context, fn func(ctx context.Context)) {
+	h.background.Add(1)
+	go func() {
+		defer h.background.Done()
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), backgroundTimeout)
+		defer cancel()
+		fn(ctx)
+	}()
+}
+
+// checkPasswordPolicy validates a new password for the account with the
+// given email. If the password breaks any rule it writes a 400 listing
+// every violation and returns false.
+func (h *UserHandler) checkPasswordPolicy(w http.ResponseWriter, r *http.Request, newPassword, email string) bool {
+	policy := password.DefaultPolicy()
+	if h.PasswordPolicy != nil {
+		policy = *h.PasswordPolicy
+	}
+
+	violations, err := policy.Validate(r.Context(), newPassword, email)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return false
+	}
+
+	if len(violations) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{
+			"error":      "Password does not meet the password policy",
+			"violations": violations,
+		})
+		return false
+	}
+
+	return true
+}
+
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email
 }
 
 func (h *UserHandler) RegisterUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -38,7 +149,16 @@ func (h *UserHandler) RegisterUserHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), 12)
+	if !validEmail(req.Email) {
+		http.Error(w, "Invalid email address", http.StatusBadRequest)
+		return
+	}
+
+	if !h.checkPasswordPolicy(w, r, req.Password, req.Email) {
+		return
+	}
+
+	hashedPassword, err := h.hasher().Hash(req.Password)
 	if err != nil {
 		http.Error(w, "Server error", http.StatusInternalServerError)
 		return
@@ -47,7 +167,7 @@ func (h *UserHandler) RegisterUserHandler(w http.ResponseWriter, r *http.Request
 	newUser := models.User{
 		ID:           uuid.New(),
 		Email:        req.Email,
-		PasswordHash: string(hashedPassword),
+		PasswordHash: hashedPassword,
 		Role:         "customer",
 	}
 
@@ -56,7 +176,14 @@ func (h *UserHandler) RegisterUserHandler(w http.ResponseWriter, r *http.Request
         VALUES ($1, $2, $3, $4)
     `
 
-	_, err = h.DB.Exec(
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, "Could not create user", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	_, err = tx.Exec(
 		r.Context(),
 		query,
 		newUser.ID,
@@ -76,10 +203,23 @@ func (h *UserHandler) RegisterUserHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	verificationToken, err := createVerificationToken(r.Context(), tx, newUser.ID, "")
+	if err != nil {
+		http.Error(w, "Could not create user", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, "Could not create user", http.StatusInternalServerError)
+		return
+	}
+
+	h.sendVerificationEmail(r.Context(), newUser.Email, verificationToken)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]string{
-		"message": "User registered successfully",
+		"message": "User registered successfully, check your email to verify your account",
 	})
 }
 
@@ -101,47 +241,121 @@ func (h *UserHandler) LoginUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ip := clientIP(r)
+
+	wait, err := h.checkLoginThrottle(r, req.Email, ip)
+	if err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	if wait > 0 {
+		tooManyAttempts(w, wait)
+		return
+	}
+
+	rejectLogin := func() {
+		if err := h.recordLoginAttempt(r, req.Email, ip, false); err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+	}
+
+	hasher := h.hasher()
+
 	var user models.User
-	query := `SELECT id, email, password_hash, role FROM users WHERE email = $1`
+	var lockedUntil, totpEnabledAt, suspendedAt *time.Time
+	query := `SELECT id, email, password_hash, role, locked_until, totp_enabled_at, suspended_at FROM users WHERE email = $1`
 
-	err := h.DB.QueryRow(
+	err = h.DB.QueryRow(
 		r.Context(),
 		query,
 		req.Email,
-	).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Role)
+	).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Role, &lockedUntil, &totpEnabledAt, &suspendedAt)
 
 	if err != nil {
-		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		// Spend the same time as a real comparison so response timing
+		// doesn't reveal whether the email is registered.
+		hasher.Verify(req.Password, dummyPasswordHash(hasher))
+		rejectLogin()
+		return
+	}
+
+	passwordOK := hasher.Verify(req.Password, user.PasswordHash)
+
+	// A locked account answers exactly like a wrong password.
+	if lockedUntil != nil && time.Now().Before(*lockedUntil) {
+		rejectLogin()
+		return
+	}
+
+	if !passwordOK {
+		if err := h.recordAccountFailure(r, user.ID); err != nil {
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
+		}
+		rejectLogin()
 		return
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password))
+	// Suspension is only revealed to someone who knows the password.
+	if suspendedAt != nil {
+		http.Error(w, "Account suspended", http.StatusForbidden)
+		return
+	}
+
+	h.upgradePasswordHash(r.Context(), hasher, user, req.Password)
+
+	if totpEnabledAt != nil {
+		h.writeTwoFactorChallenge(w, user.ID)
+		return
+	}
+
+	h.completeLogin(w, r, user, ip, false)
+}
+
+// upgradePasswordHash rehashes a just-verified password when its stored
+// hash is weaker than the hasher's target. The update only applies if the
+// hash hasn't changed since it was read, and failures are logged rather
+// than failing the login.
+func (h *UserHandler) upgradePasswordHash(ctx context.Context, hasher password.Hasher, user models.User, plaintext string) {
+	needsRehash, err := hasher.NeedsRehash(user.PasswordHash)
+	if err != nil || !needsRehash {
+		return
+	}
+
+	newHash, err := hasher.Hash(plaintext)
 	if err != nil {
-		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		log.Printf("Failed to rehash password for user %s: %v", user.ID, err)
 		return
 	}
 
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := models.Claims{
-		UserID: user.ID,
-		Role:   user.Role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+	query := `UPDATE users SET password_hash = $1 WHERE id = $2 AND password_hash = $3`
+	if _, err := h.DB.Exec(ctx, query, newHash, user.ID, user.PasswordHash); err != nil {
+		log.Printf("Failed to store upgraded password hash for user %s: %v", user.ID, err)
+	}
+}
+
+// completeLogin records a successful login, clears any failed-attempt state
+// and issues a new session for the user. twoFactor records whether the
+// login passed a second factor.
+func (h *UserHandler) completeLogin(w http.ResponseWriter, r *http.Request, user models.User, ip string, twoFactor bool) {
+	if err := h.recordLoginAttempt(r, user.Email, ip, true); err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &claims)
+	resetQuery := `UPDATE users SET failed_login_attempts = 0, locked_until = NULL WHERE id = $1 AND (failed_login_attempts > 0 OR locked_until IS NOT NULL)`
+	if _, err := h.DB.Exec(r.Context(), resetQuery, user.ID); err != nil {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
 
-	tokenString, err := token.SignedString(h.JWTSecret)
+	accessToken, refreshToken, err := h.createSession(r.Context(), user, twoFactor)
 	if err != nil {
 		http.Error(w, "Could not generate token", http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
-		"token": tokenString,
-	})
+	writeTokenPair(w, accessToken, refreshToken)
 }
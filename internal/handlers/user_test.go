@@ -2,11 +2,16 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"ecommerce-api-v2/internal/models"
+	"ecommerce-api-v2/internal/password"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestRegisterUserHandler_Success(t *testing.T) {
@@ -84,7 +89,7 @@ func TestRegisterUserHandler_DuplicateEmail(t *testing.T) {
 func TestLoginUserHandler_Success(t *testing.T) {
 	db := setupTestDB()
 	defer db.Close()
-	handler := &UserHandler{DB: db}
+	handler := &UserHandler{DB: db, Keys: testKeySet(t)}
 
 	credentials := map[string]string{
 		"email":    "logintest@example.com",
@@ -162,3 +167,77 @@ func TestLoginUserHandler_BadPassword(t *testing.T) {
 		t.Errorf("CRITICAL SECURITY FAILURE: Token was returned despite a bad password!")
 	}
 }
+
+func TestRegisterUserHandler_PasswordPolicy(t *testing.T) {
+	handler := &UserHandler{}
+
+	reqBody := models.RegisterUserRequest{
+		Email:    "weak@example.com",
+		Password: "weak",
+	}
+	bodyBytes, _ := json.Marshal(reqBody)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/register", bytes.NewReader(bodyBytes))
+	w := httptest.NewRecorder()
+
+	handler.RegisterUserHandler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status code 400, got %d", w.Code)
+	}
+
+	var resp struct {
+		Violations []struct {
+			Rule string `json:"rule"`
+		} `json:"violations"`
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+
+	if len(resp.Violations) != 2 || resp.Violations[0].Rule != "min_length" || resp.Violations[1].Rule != "not_email" {
+		t.Errorf("Expected min_length and not_email violations, got %+v", resp.Violations)
+	}
+}
+
+func TestLoginUserHandler_UpgradesPasswordHash(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+
+	weak := password.DefaultHasher()
+	weak.BcryptCost = bcrypt.MinCost
+	handler := &UserHandler{DB: db, Keys: testKeySet(t), PasswordHasher: &weak}
+
+	credentials := map[string]string{
+		"email":    "rehash@example.com",
+		"password": "securepassword123",
+	}
+	bodyBytes, _ := json.Marshal(credentials)
+
+	wReg := httptest.NewRecorder()
+	handler.RegisterUserHandler(wReg, httptest.NewRequest(http.MethodPost, "/api/v1/users/register", bytes.NewReader(bodyBytes)))
+	if wReg.Code != http.StatusCreated {
+		t.Fatalf("Test setup failed: expected user to be created, got status %d", wReg.Code)
+	}
+
+	target := password.DefaultHasher()
+	target.Algorithm = password.Argon2id
+	target.Argon2.Memory = 8 * 1024
+	target.Argon2.Time = 1
+	handler.PasswordHasher = &target
+
+	wLogin := httptest.NewRecorder()
+	handler.LoginUserHandler(wLogin, httptest.NewRequest(http.MethodPost, "/api/v1/users/login", bytes.NewReader(bodyBytes)))
+	if wLogin.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 OK for valid login, got %d", wLogin.Code)
+	}
+
+	var storedHash string
+	if err := db.QueryRow(context.Background(), "SELECT password_hash FROM users WHERE email = $1", "rehash@example.com").Scan(&storedHash); err != nil {
+		t.Fatalf("Failed to query test database: %v", err)
+	}
+	if !strings.HasPrefix(storedHash, "$argon2id$") {
+		t.Errorf("Expected password hash to be upgraded to argon2id, got %q", storedHash)
+	}
+	if !target.Verify("securepassword123", storedHash) {
+		t.Errorf("Expected upgraded hash to match the password")
+	}
+}
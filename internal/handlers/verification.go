@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"context"
+	"ecommerce-api-v2/internal/middleware"
+	"ecommerce-api-v2/internal/models"
+	"ecommerce-api-v2/internal/notifier"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	emailVerificationTTL = 48 * time.Hour
+
+	verificationResendInterval = time.Minute
+	verificationResendHourly   = 5
+)
+
+// createVerificationToken issues a token that verifies the user's current
+// email, or newEmail when it is not empty.
+func createVerificationToken(ctx context.Context, q execer, userID uuid.UUID, newEmail string) (string, error) {
+	token, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+
+	var email *string
+	if newEmail != "" {
+		email = &newEmail
+	}
+
+	query := `
+		INSERT INTO email_verification_tokens (user_id, token_hash, expires_at, email)
+		VALUES ($1, $2, $3, $4)
+	`
+	if _, err := q.Exec(ctx, query, userID, hashToken(token), time.Now().Add(emailVerificationTTL), email); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (h *UserHandler) sendVerificationEmail(ctx context.Context, email, token string) {
+	h.notify(ctx, notifier.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body:    "Use the following token to verify your email address. It expires in 48 hours.\n\n" + token,
+	})
+}
+
+func (h *UserHandler) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	req.Token = strings.TrimSpace(req.Token)
+	if req.Token == "" {
+		http.Error(w, "Token can't be empty", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin(r.Context())
+	if err != nil {
+		http.Error(w, "Could not verify email", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	query := `
+		SELECT user_id, email, expires_at, used_at
+		FROM email_verification_tokens
+		WHERE token_hash = $1
+		FOR UPDATE
+	`
+
+	var userID uuid.UUID
+	var newEmail *string
+	var expiresAt time.Time
+	var usedAt *time.Time
+
+	err = tx.QueryRow(r.Context(), query, hashToken(req.Token)).Scan(&userID, &newEmail, &expiresAt, &usedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Invalid or expired verification token", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Could not verify email", http.StatusInternalServerError)
+		return
+	}
+
+	if usedAt != nil || time.Now().After(expiresAt) {
+		http.Error(w, "Invalid or expired verification token", http.StatusBadRequest)
+		return
+	}
+
+	if newEmail != nil {
+		changeQuery := `UPDATE users SET email = $1, email_verified_at = NOW() WHERE id = $2`
+		if _, err := tx.Exec(r.Context(), changeQuery, *newEmail, userID); err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+				http.Error(w, "Email already in use", http.StatusConflict)
+				return
+			}
+			http.Error(w, "Could not verify email", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		verifyQuery := `UPDATE users SET email_verified_at = NOW() WHERE id = $1 AND email_verified_at IS NULL`
+		if _, err := tx.Exec(r.Context(), verifyQuery, userID); err != nil {
+			http.Error(w, "Could not verify email", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Only tokens of the same kind are spent: confirming a signup link
+	// mustn't cancel an email change in progress, or the other way round.
+	markUsedQuery := `
+		UPDATE email_verification_tokens SET used_at = NOW()
+		WHERE user_id = $1 AND used_at IS NULL AND (email IS NULL) = $2
+	`
+	if _, err := tx.Exec(r.Context(), markUsedQuery, userID, newEmail == nil); err != nil {
+		http.Error(w, "Could not verify email", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		http.Error(w, "Could not verify email", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Email verified successfully",
+	})
+}
+
+func (h *UserHandler) ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	ctxValue := r.Context().Value(middleware.UserContextKey)
+	claims, ok := ctxValue.(middleware.UserClaims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		http.Error(w, "Invalid user ID in token", http.StatusUnauthorized)
+		return
+	}
+
+	query := `
+		SELECT u.email, u.email_verified_at,
+			(SELECT MAX(created_at) FROM email_verification_tokens WHERE user_id = u.id),
+			(SELECT COUNT(*) FROM email_verification_tokens WHERE user_id = u.id AND created_at > NOW() - INTERVAL '1 hour')
+		FROM users u
+		WHERE u.id = $1
+	`
+
+	var email string
+	var verifiedAt, lastSentAt *time.Time
+	var sentLastHour int
+
+	err = h.DB.QueryRow(r.Context(), query, userID).Scan(&email, &verifiedAt, &lastSentAt, &sentLastHour)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if verifiedAt != nil {
+		http.Error(w, "Email is already verified", http.StatusConflict)
+		return
+	}
+
+	if lastSentAt != nil {
+		if wait := verificationResendInterval - time.Since(*lastSentAt); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			http.Error(w, "Please wait before requesting another verification email", http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	if sentLastHour >= verificationResendHourly {
+		w.Header().Set("Retry-After", strconv.Itoa(int(time.Hour.Seconds())))
+		http.Error(w, "Too many verification emails requested, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	token, err := createVerificationToken(r.Context(), h.DB, userID, "")
+	if err != nil {
+		http.Error(w, "Could not create verification token", http.StatusInternalServerError)
+		return
+	}
+
+	h.sendVerificationEmail(r.Context(), email, token)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Verification email sent",
+	})
+}
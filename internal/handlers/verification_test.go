@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"ecommerce-api-v2/internal/middleware"
+	"ecommerce-api-v2/internal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func registerTestUser(t *testing.T, handler *UserHandler, email string) uuid.UUID {
+	t.Helper()
+
+	bodyBytes, _ := json.Marshal(models.RegisterUserRequest{Email: email, Password: "securepassword123"})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/register", bytes.NewReader(bodyBytes))
+	w := httptest.NewRecorder()
+	handler.RegisterUserHandler(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Test setup failed: expected user to be created, got status %d", w.Code)
+	}
+
+	var userID uuid.UUID
+	if err := handler.DB.QueryRow(context.Background(), "SELECT id FROM users WHERE email = $1", email).Scan(&userID); err != nil {
+		t.Fatalf("Failed to look up registered user: %v", err)
+	}
+	return userID
+}
+
+func TestVerifyEmailHandler_Success(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	notes := &recordingNotifier{}
+	handler := &UserHandler{DB: db, Notifier: notes}
+
+	userID := registerTestUser(t, handler, "verifyme@example.com")
+
+	token := notes.lastToken()
+	if token == "" {
+		t.Fatalf("Expected a verification token to be sent at registration")
+	}
+
+	changeQuery := `
+		INSERT INTO email_verification_tokens (user_id, token_hash, email, expires_at)
+		VALUES ($1, 'pending-change', 'verifyme-new@example.com', NOW() + INTERVAL '1 hour')
+	`
+	db.Exec(context.Background(), changeQuery, userID)
+
+	bodyBytes, _ := json.Marshal(models.VerifyEmailRequest{Token: token})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/verify", bytes.NewReader(bodyBytes))
+	w := httptest.NewRecorder()
+	handler.VerifyEmailHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK for verification, got %d", w.Code)
+	}
+
+	var verifiedAt *time.Time
+	db.QueryRow(context.Background(), "SELECT email_verified_at FROM users WHERE id = $1", userID).Scan(&verifiedAt)
+	if verifiedAt == nil {
+		t.Errorf("Expected email_verified_at to be set after verification")
+	}
+
+	var changeUsedAt *time.Time
+	db.QueryRow(context.Background(), "SELECT used_at FROM email_verification_tokens WHERE token_hash = 'pending-change'").Scan(&changeUsedAt)
+	if changeUsedAt != nil {
+		t.Errorf("Expected a pending email change to survive verifying the signup email")
+	}
+}
+
+func TestResendVerificationHandler_Throttled(t *testing.T) {
+	db := setupTestDB()
+	defer db.Close()
+	handler := &UserHandler{DB: db, Notifier: &recordingNotifier{}}
+
+	userID := registerTestUser(t, handler, "impatient@example.com")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/verify/resend", nil)
+	ctx := context.WithValue(req.Context(), middleware.UserContextKey, middleware.UserClaims{
+		UserID: userID.String(),
+		Role:   "customer",
+	})
+	req = req.WithContext(ctx)
+
+	w := httptest.NewRecorder()
+	handler.ResendVerificationHandler(w, req)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 Too Many Requests right after registration, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected a Retry-After header on throttled resend")
+	}
+}
@@ -0,0 +1,134 @@
+// Package imaging decodes uploaded images and makes thumbnails of them
+// using only the standard library.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+// MaxPixels bounds the size of an image Decode accepts. A small file can
+// declare huge dimensions, so this is checked before the pixels are
+// decoded. At 16 megapixels a decoded image takes at most about 128 MB,
+// for a 16-bit PNG.
+const MaxPixels = 16_000_000
+
+var (
+	ErrUnsupportedFormat = errors.New("imaging: unsupported image format")
+	ErrTooManyPixels     = errors.New("imaging: image dimensions are too large")
+)
+
+// formats maps the content types Decode accepts to their decoders. The
+// type is sniffed from the data rather than trusted from the upload.
+var formats = map[string]struct {
+	decode       func([]byte) (image.Image, error)
+	decodeConfig func([]byte) (image.Config, error)
+}{
+	"image/jpeg": {
+		func(b []byte) (image.Image, error) { return jpeg.Decode(bytes.NewReader(b)) },
+		func(b []byte) (image.Config, error) { return jpeg.DecodeConfig(bytes.NewReader(b)) },
+	},
+	"image/png": {
+		func(b []byte) (image.Image, error) { return png.Decode(bytes.NewReader(b)) },
+		func(b []byte) (image.Config, error) { return png.DecodeConfig(bytes.NewReader(b)) },
+	},
+	"image/gif": {
+		func(b []byte) (image.Image, error) { return gif.Decode(bytes.NewReader(b)) },
+		func(b []byte) (image.Config, error) { return gif.DecodeConfig(bytes.NewReader(b)) },
+	},
+}
+
+// Decode sniffs the format of data and decodes it, returning the image and
+// its content type. Only the first frame of an animated GIF is decoded.
+func Decode(data []byte) (image.Image, string, error) {
+	contentType := http.DetectContentType(data)
+	format, ok := formats[contentType]
+	if !ok {
+		return nil, "", ErrUnsupportedFormat
+	}
+
+	cfg, err := format.decodeConfig(data)
+	if err != nil {
+		return nil, "", err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > MaxPixels {
+		return nil, "", ErrTooManyPixels
+	}
+
+	img, err := format.decode(data)
+	if err != nil {
+		return nil, "", err
+	}
+	return img, contentType, nil
+}
+
+// Resize scales src down to fit within maxSize by maxSize, keeping its
+// aspect ratio. Each output pixel is the average of the source pixels it
+// covers. Images that already fit are returned unchanged. The source is
+// converted a band of rows at a time, so resizing never holds a second
+// full-size copy of it.
+func Resize(src image.Image, maxSize int) image.Image {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	if sw <= maxSize && sh <= maxSize {
+		return src
+	}
+
+	dw, dh := maxSize, maxSize
+	if sw > sh {
+		dh = max(1, sh*maxSize/sw)
+	} else {
+		dw = max(1, sw*maxSize/sh)
+	}
+
+	// Averaging premultiplied RGBA keeps transparent pixels from bleeding
+	// their color into the edges of opaque ones. band holds the source rows
+	// covered by one output row.
+	band := image.NewRGBA(image.Rect(0, 0, sw, (sh+dh-1)/dh))
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		sy0, sy1 := y*sh/dh, max((y+1)*sh/dh, y*sh/dh+1)
+		draw.Draw(band, image.Rect(0, 0, sw, sy1-sy0), src, image.Pt(b.Min.X, b.Min.Y+sy0), draw.Src)
+
+		for x := 0; x < dw; x++ {
+			sx0, sx1 := x*sw/dw, max((x+1)*sw/dw, x*sw/dw+1)
+
+			var r, g, bl, a, n int
+			for sy := 0; sy < sy1-sy0; sy++ {
+				row := band.Pix[sy*band.Stride:]
+				for sx := sx0; sx < sx1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += int(p[0])
+					g += int(p[1])
+					bl += int(p[2])
+					a += int(p[3])
+					n++
+				}
+			}
+
+			d := dst.Pix[y*dst.Stride+x*4:]
+			d[0], d[1], d[2], d[3] = uint8(r/n), uint8(g/n), uint8(bl/n), uint8(a/n)
+		}
+	}
+	return dst
+}
+
+// Encode writes img as a JPEG when contentType is image/jpeg, and as a PNG
+// otherwise, so images that may have transparency keep it. It returns the
+// encoded bytes and their content type.
+func Encode(img image.Image, contentType string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if contentType == "image/jpeg" {
+		err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+		return buf.Bytes(), "image/jpeg", err
+	}
+	err := png.Encode(&buf, img)
+	return buf.Bytes(), "image/png", err
+}
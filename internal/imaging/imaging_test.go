@@ -0,0 +1,97 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 4, 3))
+	img, contentType, err := Decode(encodePNG(t, src))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if contentType != "image/png" || img.Bounds().Dx() != 4 || img.Bounds().Dy() != 3 {
+		t.Errorf("Expected a 4x3 PNG, got %s %v", contentType, img.Bounds())
+	}
+
+	if _, _, err := Decode([]byte("<svg xmlns='http://www.w3.org/2000/svg'></svg>")); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("Expected ErrUnsupportedFormat for SVG, got %v", err)
+	}
+}
+
+func TestDecode_RejectsHugeDimensions(t *testing.T) {
+	// Only the header is checked, so a PNG declaring huge dimensions is
+	// refused without allocating its pixels.
+	header := encodePNG(t, image.NewGray(image.Rect(0, 0, 1, 1)))
+	// Patch width and height in the IHDR chunk to 10000x10000 and fix up
+	// its checksum.
+	copy(header[16:24], []byte{0, 0, 0x27, 0x10, 0, 0, 0x27, 0x10})
+	binary.BigEndian.PutUint32(header[29:33], crc32.ChecksumIEEE(header[12:29]))
+
+	if _, _, err := Decode(header); !errors.Is(err, ErrTooManyPixels) {
+		t.Errorf("Expected ErrTooManyPixels, got %v", err)
+	}
+}
+
+func TestResize(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			// Alternate black and white columns average out to grey.
+			if x%2 == 0 {
+				src.Set(x, y, color.White)
+			} else {
+				src.Set(x, y, color.Black)
+			}
+		}
+	}
+
+	dst := Resize(src, 100)
+	if dst.Bounds().Dx() != 100 || dst.Bounds().Dy() != 50 {
+		t.Fatalf("Expected 100x50, got %v", dst.Bounds())
+	}
+
+	r, _, _, _ := dst.At(10, 10).RGBA()
+	if grey := r >> 8; grey < 120 || grey > 135 {
+		t.Errorf("Expected averaged grey, got %d", grey)
+	}
+
+	if small := Resize(dst, 200); small != dst {
+		t.Error("Expected an image that already fits to be returned unchanged")
+	}
+}
+
+func TestResize_OffsetSource(t *testing.T) {
+	// A sub-image doesn't start at the origin; only its own pixels count.
+	full := image.NewGray(image.Rect(0, 0, 300, 300))
+	for y := 100; y < 300; y++ {
+		for x := 100; x < 300; x++ {
+			full.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+	src := full.SubImage(image.Rect(100, 100, 300, 300))
+
+	dst := Resize(src, 50)
+	if dst.Bounds().Dx() != 50 || dst.Bounds().Dy() != 50 {
+		t.Fatalf("Expected 50x50, got %v", dst.Bounds())
+	}
+	if r, _, _, _ := dst.At(0, 0).RGBA(); r>>8 != 255 {
+		t.Errorf("Expected only the sub-image's white pixels to be averaged, got %d", r>>8)
+	}
+}
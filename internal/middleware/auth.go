@@ -2,12 +2,18 @@ package middleware
 
 import (
 	"context"
+	"ecommerce-api-v2/internal/auth"
 	"ecommerce-api-v2/internal/models"
-	"fmt"
+	"errors"
+	"net"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type contextKey string
@@ -15,13 +21,44 @@ type contextKey string
 const UserContextKey contextKey = "userContext"
 
 type UserClaims struct {
-	UserID string
-	Role   string
+	UserID      string
+	Role        string
+	SessionID   string
+	Permissions []string
+	// TwoFactorVerified is set when the session was opened with a second
+	// factor and the account still has two-factor authentication enabled.
+	TwoFactorVerified bool
+	// APIKeyID is set instead of SessionID when the request authenticated
+	// with an API key rather than a user's access token.
+	APIKeyID string
+	// ImpersonatorID is set when a staff member is acting as UserID. The
+	// request carries none of the staff member's permissions, and
+	// SessionID is the staff member's session.
+	ImpersonatorID string
 }
 
-func AuthMiddleware(jwtSecret []byte) func(http.Handler) http.Handler {
+func (c UserClaims) HasPermission(permission string) bool {
+	for _, p := range c.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func AuthMiddleware(keys *auth.KeySet, db *pgxpool.Pool) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if apiKey := r.Header.Get(auth.APIKeyHeader); apiKey != "" {
+				userCtxPayload, ok := authenticateAPIKey(w, r, db, apiKey)
+				if !ok {
+					return
+				}
+				ctx := context.WithValue(r.Context(), UserContextKey, userCtxPayload)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
 			authHeader := r.Header.Get("Authorization")
 			if authHeader == "" {
 				http.Error(w, "Missing authorization header", http.StatusUnauthorized)
@@ -38,21 +75,63 @@ func AuthMiddleware(jwtSecret []byte) func(http.Handler) http.Handler {
 
 			claims := &models.Claims{}
 
-			token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-				}
-				return jwtSecret, nil
-			})
+			token, err := jwt.ParseWithClaims(tokenString, claims, keys.Keyfunc, jwt.WithValidMethods(auth.ValidMethods))
 
 			if err != nil || !token.Valid {
 				http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
 				return
 			}
 
+			if claims.SessionID == uuid.Nil {
+				http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+				return
+			}
+
+			if claims.ImpersonatorID != nil {
+				userCtxPayload, ok := authenticateImpersonation(w, r, db, claims)
+				if !ok {
+					return
+				}
+				ctx := context.WithValue(r.Context(), UserContextKey, userCtxPayload)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			// The role and its permissions are read from the database rather
+			// than the token so that role changes take effect immediately.
+			var role string
+			var permissions []string
+			var twoFactorVerified, suspended bool
+			sessionQuery := `
+				SELECT u.role, COALESCE(array_agg(DISTINCT rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '{}'),
+					bool_or(s.two_factor_verified) AND u.totp_enabled_at IS NOT NULL, u.suspended_at IS NOT NULL
+				FROM sessions s
+				JOIN users u ON s.user_id = u.id
+				LEFT JOIN role_permissions rp ON rp.role = u.role
+				WHERE s.family_id = $1 AND s.user_id = $2 AND s.revoked_at IS NULL
+				GROUP BY u.role, u.totp_enabled_at, u.suspended_at
+			`
+			err = db.QueryRow(r.Context(), sessionQuery, claims.SessionID, claims.UserID).Scan(&role, &permissions, &twoFactorVerified, &suspended)
+			if err != nil {
+				if errors.Is(err, pgx.ErrNoRows) {
+					http.Error(w, "Session has been revoked", http.StatusUnauthorized)
+					return
+				}
+				http.Error(w, "Could not verify session", http.StatusInternalServerError)
+				return
+			}
+
+			if suspended {
+				http.Error(w, "Account suspended", http.StatusForbidden)
+				return
+			}
+
 			userCtxPayload := UserClaims{
-				UserID: claims.UserID.String(),
-				Role:   claims.Role,
+				UserID:            claims.UserID.String(),
+				Role:              role,
+				SessionID:         claims.SessionID.String(),
+				Permissions:       permissions,
+				TwoFactorVerified: twoFactorVerified,
 			}
 
 			ctx := context.WithValue(r.Context(), UserContextKey, userCtxPayload)
@@ -62,6 +141,213 @@ func AuthMiddleware(jwtSecret []byte) func(http.Handler) http.Handler {
 	}
 }
 
+// authenticateAPIKey looks up an API key and builds the claims it acts with.
+// The key acts as the admin who issued it, limited to the key's scopes that
+// the admin's role still grants. On failure it writes the error response.
+func authenticateAPIKey(w http.ResponseWriter, r *http.Request, db *pgxpool.Pool, apiKey string) (UserClaims, bool) {
+	var keyID, createdBy uuid.UUID
+	var role string
+	var permissions, allowedIPs []string
+	var expiresAt, revokedAt *time.Time
+	var suspended bool
+
+	query := `
+		SELECT k.id, k.created_by, u.role,
+			ARRAY(SELECT unnest(k.scopes) INTERSECT SELECT permission FROM role_permissions WHERE role = u.role),
+			k.allowed_ips, k.expires_at, k.revoked_at, u.suspended_at IS NOT NULL OR u.deleted_at IS NOT NULL
+		FROM api_keys k
+		JOIN users u ON u.id = k.created_by
+		WHERE k.key_hash = $1
+	`
+	err := db.QueryRow(r.Context(), query, auth.HashAPIKey(apiKey)).Scan(
+		&keyID, &createdBy, &role, &permissions, &allowedIPs, &expiresAt, &revokedAt, &suspended,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+			return UserClaims{}, false
+		}
+		http.Error(w, "Could not verify API key", http.StatusInternalServerError)
+		return UserClaims{}, false
+	}
+
+	if revokedAt != nil || (expiresAt != nil && time.Now().After(*expiresAt)) {
+		http.Error(w, "API key has expired or been revoked", http.StatusUnauthorized)
+		return UserClaims{}, false
+	}
+
+	ip := remoteIP(r)
+	if !auth.IPAllowed(allowedIPs, ip) {
+		http.Error(w, "API key is not allowed from this address", http.StatusForbidden)
+		return UserClaims{}, false
+	}
+
+	if suspended {
+		http.Error(w, "Account suspended", http.StatusForbidden)
+		return UserClaims{}, false
+	}
+
+	usageQuery := `UPDATE api_keys SET last_used_at = NOW(), last_used_ip = $2 WHERE id = $1`
+	if _, err := db.Exec(r.Context(), usageQuery, keyID, ip); err != nil {
+		http.Error(w, "Could not verify API key", http.StatusInternalServerError)
+		return UserClaims{}, false
+	}
+
+	return UserClaims{
+		UserID:      createdBy.String(),
+		Role:        role,
+		Permissions: permissions,
+		APIKeyID:    keyID.String(),
+	}, true
+}
+
+// authenticateImpersonation checks that the staff member behind an
+// impersonation token is still signed in and still allowed to impersonate,
+// then records the request in the audit log before letting it through. On
+// failure it writes the error response.
+func authenticateImpersonation(w http.ResponseWriter, r *http.Request, db *pgxpool.Pool, claims *models.Claims) (UserClaims, bool) {
+	var role string
+	var twoFactorVerified, suspended bool
+
+	// The request is made by the staff member's session, so it counts as
+	// verified when that session was.
+	query := `
+		SELECT t.role, s.two_factor_verified AND a.totp_enabled_at IS NOT NULL, t.suspended_at IS NOT NULL OR t.deleted_at IS NOT NULL
+		FROM sessions s
+		JOIN users a ON a.id = s.user_id
+		JOIN users t ON t.id = $3
+		WHERE s.family_id = $1 AND s.user_id = $2 AND s.revoked_at IS NULL
+			AND a.suspended_at IS NULL AND a.deleted_at IS NULL
+			AND EXISTS (SELECT 1 FROM role_permissions rp WHERE rp.role = a.role AND rp.permission = 'users:impersonate')
+		LIMIT 1
+	`
+	err := db.QueryRow(r.Context(), query, claims.SessionID, *claims.ImpersonatorID, claims.UserID).Scan(&role, &twoFactorVerified, &suspended)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			http.Error(w, "Impersonation session has ended", http.StatusUnauthorized)
+			return UserClaims{}, false
+		}
+		http.Error(w, "Could not verify session", http.StatusInternalServerError)
+		return UserClaims{}, false
+	}
+
+	if suspended {
+		http.Error(w, "Account suspended", http.StatusForbidden)
+		return UserClaims{}, false
+	}
+
+	auditQuery := `
+		INSERT INTO audit_logs (actor_id, action, target_user_id, details, ip_address)
+		VALUES ($1, 'impersonated_request', $2, $3, $4)
+	`
+	details := map[string]any{"method": r.Method, "path": r.URL.Path}
+	if _, err := db.Exec(r.Context(), auditQuery, *claims.ImpersonatorID, claims.UserID, details, remoteIP(r)); err != nil {
+		http.Error(w, "Could not verify session", http.StatusInternalServerError)
+		return UserClaims{}, false
+	}
+
+	return UserClaims{
+		UserID:            claims.UserID.String(),
+		Role:              role,
+		SessionID:         claims.SessionID.String(),
+		TwoFactorVerified: twoFactorVerified,
+		ImpersonatorID:    claims.ImpersonatorID.String(),
+	}, true
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// RequireSession blocks API keys from routes that only make sense for a
+// signed-in person, such as their own profile, cart and orders.
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(UserContextKey).(UserClaims)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if claims.APIKeyID != "" {
+			http.Error(w, "Forbidden: not available to API keys", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// DenyImpersonation blocks impersonated requests from routes that spend
+// the customer's money or change their account or credentials.
+func DenyImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(UserContextKey).(UserClaims)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if claims.ImpersonatorID != "" {
+			http.Error(w, "Forbidden: not available while impersonating", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctxValue := r.Context().Value(UserContextKey)
+			if ctxValue == nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			claims, ok := ctxValue.(UserClaims)
+			if !ok {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			if !claims.HasPermission(permission) {
+				http.Error(w, "Forbidden: missing permission "+permission, http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireTwoFactor blocks sessions that weren't opened with a second factor.
+// It is applied to staff routes when the policy requires 2FA for every
+// admin. API keys aren't interactive logins and are let through.
+func RequireTwoFactor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(UserContextKey).(UserClaims)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if !claims.TwoFactorVerified && claims.APIKeyID == "" {
+			http.Error(w, "Forbidden: sign in with two-factor authentication to continue", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Deprecated: AdminOnlyMiddleware checks the role name only. Use
+// RequirePermission instead.
 func AdminOnlyMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctxValue := r.Context().Value(UserContextKey)
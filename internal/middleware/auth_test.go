@@ -2,9 +2,15 @@ package middleware
 
 import (
 	"context"
+	"ecommerce-api-v2/internal/auth"
+	"ecommerce-api-v2/internal/models"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 func TestAdminOnlyMiddleware(t *testing.T) {
@@ -50,3 +56,179 @@ func TestAdminOnlyMiddleware(t *testing.T) {
 		}
 	})
 }
+
+func TestAuthMiddleware_RejectsTokenWithoutSession(t *testing.T) {
+	keys, err := auth.LoadKeySet(t.TempDir(), "EdDSA")
+	if err != nil {
+		t.Fatalf("Failed to create signing keys: %v", err)
+	}
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	handlerToTest := AuthMiddleware(keys, nil)(nextHandler)
+
+	claims := models.Claims{
+		UserID: uuid.New(),
+		Role:   "customer",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+	tokenString, err := keys.Sign(&claims)
+	if err != nil {
+		t.Fatalf("Failed to sign test token: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/cart", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+	w := httptest.NewRecorder()
+
+	handlerToTest.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 Unauthorized for token without a session, got %d", w.Code)
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	handlerToTest := RequirePermission("products:write")(nextHandler)
+
+	t.Run("Missing Permission is Blocked", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/products", nil)
+		w := httptest.NewRecorder()
+
+		claims := UserClaims{
+			UserID:      "some-uuid-1234",
+			Role:        "fulfillment",
+			Permissions: []string{"orders:status"},
+		}
+		req = req.WithContext(context.WithValue(req.Context(), UserContextKey, claims))
+
+		handlerToTest.ServeHTTP(w, req)
+
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected 403 Forbidden without products:write, got %d", w.Code)
+		}
+	})
+
+	t.Run("Granted Permission is Allowed", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/products", nil)
+		w := httptest.NewRecorder()
+
+		claims := UserClaims{
+			UserID:      "some-uuid-5678",
+			Role:        "catalog_manager",
+			Permissions: []string{"products:write"},
+		}
+		req = req.WithContext(context.WithValue(req.Context(), UserContextKey, claims))
+
+		handlerToTest.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected 200 OK with products:write, got %d", w.Code)
+		}
+	})
+}
+
+func TestRequireTwoFactor(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	handlerToTest := RequireTwoFactor(nextHandler)
+
+	for _, enabled := range []bool{false, true} {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/orders/123/status", nil)
+		w := httptest.NewRecorder()
+
+		claims := UserClaims{UserID: "some-uuid-1234", Role: "admin", TwoFactorVerified: enabled}
+		req = req.WithContext(context.WithValue(req.Context(), UserContextKey, claims))
+
+		handlerToTest.ServeHTTP(w, req)
+
+		want := http.StatusForbidden
+		if enabled {
+			want = http.StatusOK
+		}
+		if w.Code != want {
+			t.Errorf("TwoFactorVerified=%v: expected %d, got %d", enabled, want, w.Code)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/orders/123/status", nil)
+	claims := UserClaims{UserID: "some-uuid-1234", Role: "admin", APIKeyID: "some-key"}
+	req = req.WithContext(context.WithValue(req.Context(), UserContextKey, claims))
+	w := httptest.NewRecorder()
+
+	handlerToTest.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected API keys to pass the two-factor requirement, got %d", w.Code)
+	}
+}
+
+func TestRequireSession(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	handlerToTest := RequireSession(nextHandler)
+
+	tests := map[string]struct {
+		claims UserClaims
+		want   int
+	}{
+		"Session is Allowed": {UserClaims{UserID: "some-uuid-1234", SessionID: "some-session"}, http.StatusOK},
+		"API Key is Blocked": {UserClaims{UserID: "some-uuid-1234", APIKeyID: "some-key"}, http.StatusForbidden},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/cart", nil)
+			req = req.WithContext(context.WithValue(req.Context(), UserContextKey, tt.claims))
+			w := httptest.NewRecorder()
+
+			handlerToTest.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
+
+func TestDenyImpersonation(t *testing.T) {
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	handlerToTest := DenyImpersonation(nextHandler)
+
+	tests := map[string]struct {
+		claims UserClaims
+		want   int
+	}{
+		"Customer is Allowed":      {UserClaims{UserID: "some-uuid-1234", SessionID: "some-session"}, http.StatusOK},
+		"Impersonation is Blocked": {UserClaims{UserID: "some-uuid-1234", SessionID: "some-session", ImpersonatorID: "some-uuid-5678"}, http.StatusForbidden},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/checkout", nil)
+			req = req.WithContext(context.WithValue(req.Context(), UserContextKey, tt.claims))
+			w := httptest.NewRecorder()
+
+			handlerToTest.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
@@ -8,12 +8,16 @@ import (
 )
 
 type User struct {
-	ID           uuid.UUID `json:"id" db:"id"`
-	Email        string    `json:"email" db:"email"`
-	PasswordHash string    `json:"-" db:"password_hash"`
-	Role         string    `json:"role" db:"role"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+	ID              uuid.UUID  `json:"id" db:"id"`
+	Email           string     `json:"email" db:"email"`
+	PasswordHash    string     `json:"-" db:"password_hash"`
+	Role            string     `json:"role" db:"role"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at" db:"email_verified_at"`
+	FullName        string     `json:"full_name" db:"full_name"`
+	Phone           string     `json:"phone" db:"phone"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
 }
 
 type Product struct {
@@ -26,6 +30,17 @@ type Product struct {
 	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
 }
 
+type ProductVariant struct {
+	ID            uuid.UUID         `json:"id" db:"id"`
+	ProductID     uuid.UUID         `json:"product_id" db:"product_id"`
+	SKU           string            `json:"sku" db:"sku"`
+	Options       map[string]string `json:"options" db:"options"`
+	Price         int               `json:"price" db:"price"`
+	StockQuantity int               `json:"stock_quantity" db:"stock_quantity"`
+	CreatedAt     time.Time         `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at" db:"updated_at"`
+}
+
 type Order struct {
 	ID         uuid.UUID   `json:"id" db:"id"`
 	UserID     uuid.UUID   `json:"user_id" db:"user_id"`
@@ -37,21 +52,24 @@ type Order struct {
 }
 
 type OrderItem struct {
-	ID              uuid.UUID `json:"id" db:"id"`
-	OrderID         uuid.UUID `json:"order_id" db:"order_id"`
-	ProductID       uuid.UUID `json:"product_id" db:"product_id"`
-	Quantity        int       `json:"quantity" db:"quantity"`
-	PriceAtPurchase int       `json:"price_at_purchase" db:"price_at_purchase"`
-	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+	ID              uuid.UUID  `json:"id" db:"id"`
+	OrderID         uuid.UUID  `json:"order_id" db:"order_id"`
+	ProductID       uuid.UUID  `json:"product_id" db:"product_id"`
+	VariantID       *uuid.UUID `json:"variant_id,omitempty" db:"variant_id"`
+	SKU             *string    `json:"sku,omitempty" db:"sku"`
+	Quantity        int        `json:"quantity" db:"quantity"`
+	PriceAtPurchase int        `json:"price_at_purchase" db:"price_at_purchase"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
 }
 
 type CartItem struct {
-	ID        uuid.UUID `json:"id" db:"id"`
-	UserID    uuid.UUID `json:"user_id" db:"user_id"`
-	ProductID uuid.UUID `json:"product_id" db:"product_id"`
-	Quantity  int       `json:"quantity" db:"quantity"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	ID        uuid.UUID  `json:"id" db:"id"`
+	UserID    uuid.UUID  `json:"user_id" db:"user_id"`
+	ProductID uuid.UUID  `json:"product_id" db:"product_id"`
+	VariantID *uuid.UUID `json:"variant_id,omitempty" db:"variant_id"`
+	Quantity  int        `json:"quantity" db:"quantity"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
 }
 
 type RegisterUserRequest struct {
@@ -64,18 +82,178 @@ type LoginUserRequest struct {
 	Password string `json:"password"`
 }
 
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type ConfirmPasswordResetRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type MagicLinkRequest struct {
+	Email string `json:"email"`
+}
+
+type MagicLinkLoginRequest struct {
+	Token string `json:"token"`
+}
+
+type UserProfileResponse struct {
+	ID               string     `json:"id"`
+	Email            string     `json:"email"`
+	FullName         string     `json:"full_name"`
+	Phone            string     `json:"phone"`
+	Role             string     `json:"role"`
+	EmailVerifiedAt  *time.Time `json:"email_verified_at"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+type UpdateProfileRequest struct {
+	FullName *string `json:"full_name"`
+	Phone    *string `json:"phone"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type ChangeEmailRequest struct {
+	NewEmail string `json:"new_email"`
+	Password string `json:"password"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 type Claims struct {
-	UserID uuid.UUID `json:"user_id"`
-	Role   string    `json:"role"`
+	UserID    uuid.UUID `json:"user_id"`
+	Role      string    `json:"role"`
+	SessionID uuid.UUID `json:"sid"`
+	// ImpersonatorID marks an impersonation token. It names the staff
+	// member acting as UserID, and SessionID is then their session.
+	ImpersonatorID *uuid.UUID `json:"impersonator_id,omitempty"`
 	jwt.RegisteredClaims
 }
 
+type ChallengeClaims struct {
+	UserID  uuid.UUID `json:"user_id"`
+	Purpose string    `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+}
+
+type TwoFactorEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
 type GetProductResponse struct {
-	ID            string `json:"id"`
-	Name          string `json:"name"`
-	Description   string `json:"description"`
-	Price         int    `json:"price"`
-	StockQuantity int    `josn:"stock_quantity"`
+	ID            string    `json:"id"`
+	SKU           *string   `json:"sku,omitempty"`
+	Name          string    `json:"name"`
+	Description   string    `json:"description"`
+	Price         int       `json:"price"`
+	StockQuantity int       `josn:"stock_quantity"`
+	CategoryIDs   []string  `json:"category_ids"`
+	CreatedAt     time.Time `json:"created_at"`
+	Status        string    `json:"status"`
+	// DeletedAt is when the product was archived.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Variants and Options are only filled in for a single product.
+	// Options lists the values each option takes across the variants,
+	// e.g. {"size": ["S", "M", "L"]}.
+	Variants []ProductVariantResponse `json:"variants,omitempty"`
+	Options  map[string][]string      `json:"options,omitempty"`
+	// Highlight is only filled in for search results: an excerpt of the
+	// name and description, HTML-escaped, with the matched terms wrapped in
+	// <mark> tags.
+	Highlight *string                `json:"highlight,omitempty"`
+	Images    []ProductImageResponse `json:"images"`
+}
+
+// ProductImageResponse describes an uploaded image. Thumbnails maps size
+// names such as "small" to the URLs of resized copies.
+type ProductImageResponse struct {
+	ID         string            `json:"id"`
+	VariantID  *string           `json:"variant_id,omitempty"`
+	URL        string            `json:"url"`
+	Thumbnails map[string]string `json:"thumbnails"`
+	Width      int               `json:"width"`
+	Height     int               `json:"height"`
+	AltText    string            `json:"alt_text"`
+}
+
+type ReorderProductImagesRequest struct {
+	ImageIDs []string `json:"image_ids"`
+}
+
+// ProductFilters echoes the filters a product listing was narrowed by.
+type ProductFilters struct {
+	Query      *string           `json:"q,omitempty"`
+	Category   *string           `json:"category,omitempty"`
+	MinPrice   *int              `json:"min_price,omitempty"`
+	MaxPrice   *int              `json:"max_price,omitempty"`
+	InStock    bool              `json:"in_stock,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// Status is only set on the admin listing, which can see every status.
+	Status *string `json:"status,omitempty"`
+}
+
+// ProductListResponse is a page of products. Page is set for page-numbered
+// requests; cursor requests get NextCursor and PrevCursor instead.
+type ProductListResponse struct {
+	Products   []GetProductResponse `json:"products"`
+	Page       int                  `json:"page,omitempty"`
+	Limit      int                  `json:"limit"`
+	Total      int                  `json:"total"`
+	Sort       string               `json:"sort"`
+	Filters    ProductFilters       `json:"filters"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+	PrevCursor string               `json:"prev_cursor,omitempty"`
+}
+
+type ProductSuggestion struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type ProductVariantResponse struct {
+	ID            string            `json:"id"`
+	ProductID     string            `json:"product_id"`
+	SKU           string            `json:"sku"`
+	Options       map[string]string `json:"options"`
+	Price         int               `json:"price"`
+	StockQuantity int               `json:"stock_quantity"`
+	CreatedAt     time.Time         `json:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+}
+
+type CreateProductVariantRequest struct {
+	SKU           string            `json:"sku"`
+	Options       map[string]string `json:"options"`
+	Price         int               `json:"price"`
+	StockQuantity int               `json:"stock_quantity"`
 }
 
 type CreateProductRequest struct {
@@ -83,20 +261,141 @@ type CreateProductRequest struct {
 	Description   string `json:"description"`
 	Price         int    `json:"price"`
 	StockQuantity int    `json:"stock_quantity"`
+	// CategoryIDs replaces the product's categories when present; on update
+	// leaving it out keeps the current ones.
+	CategoryIDs []string `json:"category_ids"`
+	// Status is "draft" or "active". It defaults to "active" on create and
+	// is left unchanged on update when empty.
+	Status string `json:"status,omitempty"`
+	// SKU identifies the product in bulk imports. It is optional, and left
+	// unchanged on update when empty.
+	SKU string `json:"sku,omitempty"`
+}
+
+// ProductImportJobResponse reports the progress of a bulk import. Errors
+// lists the rows that were skipped, by their line in the uploaded file.
+type ProductImportJobResponse struct {
+	ID            string               `json:"id"`
+	Format        string               `json:"format"`
+	Status        string               `json:"status"`
+	TotalRows     int                  `json:"total_rows"`
+	ProcessedRows int                  `json:"processed_rows"`
+	CreatedRows   int                  `json:"created_rows"`
+	UpdatedRows   int                  `json:"updated_rows"`
+	FailedRows    int                  `json:"failed_rows"`
+	Errors        []ProductImportError `json:"errors"`
+	LastError     *string              `json:"last_error"`
+	CreatedBy     *string              `json:"created_by"`
+	CreatedAt     time.Time            `json:"created_at"`
+	StartedAt     *time.Time           `json:"started_at"`
+	FinishedAt    *time.Time           `json:"finished_at"`
+}
+
+type ProductImportError struct {
+	Row     int    `json:"row"`
+	SKU     string `json:"sku,omitempty"`
+	Message string `json:"message"`
+}
+
+// InventoryMovementResponse is a change to the stock of a product, or of
+// one of its variants when VariantID is set. Balance is the stock the
+// change left.
+type InventoryMovementResponse struct {
+	ID          string    `json:"id"`
+	ProductID   string    `json:"product_id"`
+	VariantID   *string   `json:"variant_id,omitempty"`
+	SKU         *string   `json:"sku,omitempty"`
+	Type        string    `json:"type"`
+	Delta       int       `json:"delta"`
+	Balance     int       `json:"balance"`
+	Reason      string    `json:"reason"`
+	ActorID     *string   `json:"actor_id"`
+	OrderID     *string   `json:"order_id,omitempty"`
+	ImportJobID *string   `json:"import_job_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type InventoryMovementListResponse struct {
+	Movements  []InventoryMovementResponse `json:"movements"`
+	Limit      int                         `json:"limit"`
+	NextCursor string                      `json:"next_cursor,omitempty"`
+	PrevCursor string                      `json:"prev_cursor,omitempty"`
+}
+
+// StockAdjustmentRequest changes stock by Delta rather than setting it.
+// Type is "adjustment" (the default) or "return"; a return may name the
+// order it came back from.
+type StockAdjustmentRequest struct {
+	VariantID string `json:"variant_id"`
+	Delta     int    `json:"delta"`
+	Type      string `json:"type"`
+	Reason    string `json:"reason"`
+	OrderID   string `json:"order_id"`
+}
+
+// ProductExportRow is a product as written by the export. It reads back
+// as a CreateProductRequest, so an export can be edited and imported.
+type ProductExportRow struct {
+	ID            string    `json:"id"`
+	SKU           *string   `json:"sku"`
+	Name          string    `json:"name"`
+	Description   string    `json:"description"`
+	Price         int       `json:"price"`
+	StockQuantity int       `json:"stock_quantity"`
+	Status        string    `json:"status"`
+	CategoryIDs   []string  `json:"category_ids"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type CategoryResponse struct {
+	ID          string    `json:"id"`
+	ParentID    *string   `json:"parent_id"`
+	Name        string    `json:"name"`
+	Slug        string    `json:"slug"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type CategoryTreeNode struct {
+	CategoryResponse
+	Children []*CategoryTreeNode `json:"children"`
+}
+
+type CategoryDetailResponse struct {
+	CategoryResponse
+	// Ancestors runs from the root down to the category's parent.
+	Ancestors []CategoryResponse `json:"ancestors"`
+	Children  []CategoryResponse `json:"children"`
+}
+
+type CreateCategoryRequest struct {
+	ParentID    *string `json:"parent_id"`
+	Name        string  `json:"name"`
+	Slug        string  `json:"slug"`
+	Description string  `json:"description"`
 }
 
 type AddToCartRequest struct {
 	ProductID string `json:"product_id"`
+	// VariantID is required for products that have variants.
+	VariantID string `json:"variant_id"`
 	Quantity  int    `json:"quantity"`
 }
 
 type CartItemResponse struct {
-	CartItemID string `json:"cart_item_id"`
-	ProductID  string `json:"product_id"`
-	Name       string `json:"name"`
-	Price      int    `json:"price"`
-	Quantity   int    `json:"quantity"`
-	Subtotal   int    `json:"subtotal"`
+	CartItemID string            `json:"cart_item_id"`
+	ProductID  string            `json:"product_id"`
+	VariantID  *string           `json:"variant_id,omitempty"`
+	SKU        *string           `json:"sku,omitempty"`
+	Options    map[string]string `json:"options,omitempty"`
+	Name       string            `json:"name"`
+	Price      int               `json:"price"`
+	Quantity   int               `json:"quantity"`
+	Subtotal   int               `json:"subtotal"`
+	// Available is false once the product has been archived or taken back
+	// to draft. Such lines are left out of the total and block checkout.
+	Available bool `json:"available"`
 }
 
 type CartResponse struct {
@@ -112,10 +411,12 @@ type CheckoutResponse struct {
 }
 
 type OrderHistoryItemResponse struct {
-	ProductID       string `json:"product_id"`
-	ProductName     string `json:"product_name"`
-	Quantity        int    `json:"quantity"`
-	PriceAtPurchase int    `json:"price_at_purchase"`
+	ProductID       string  `json:"product_id"`
+	ProductName     string  `json:"product_name"`
+	VariantID       *string `json:"variant_id,omitempty"`
+	SKU             *string `json:"sku,omitempty"`
+	Quantity        int     `json:"quantity"`
+	PriceAtPurchase int     `json:"price_at_purchase"`
 }
 
 type OrderHistoryResponse struct {
@@ -126,6 +427,118 @@ type OrderHistoryResponse struct {
 	Items       []OrderHistoryItemResponse `json:"items"`
 }
 
+type OrderHistoryListResponse struct {
+	Orders     []OrderHistoryResponse `json:"orders"`
+	Page       int                    `json:"page,omitempty"`
+	Limit      int                    `json:"limit"`
+	NextCursor string                 `json:"next_cursor,omitempty"`
+	PrevCursor string                 `json:"prev_cursor,omitempty"`
+}
+
 type UpdateOrderStatusRequest struct {
 	Status string `json:"status"`
 }
+
+type RoleResponse struct {
+	Name             string   `json:"name"`
+	Description      string   `json:"description"`
+	Permissions      []string `json:"permissions"`
+	MagicLinkEnabled bool     `json:"magic_link_enabled"`
+}
+
+type AssignRoleRequest struct {
+	Role string `json:"role"`
+}
+
+type AdminUserResponse struct {
+	ID               string     `json:"id"`
+	Email            string     `json:"email"`
+	FullName         string     `json:"full_name"`
+	Phone            string     `json:"phone"`
+	Role             string     `json:"role"`
+	EmailVerifiedAt  *time.Time `json:"email_verified_at"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	LockedUntil      *time.Time `json:"locked_until"`
+	SuspendedAt      *time.Time `json:"suspended_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+type AdminUserListResponse struct {
+	Users      []AdminUserResponse `json:"users"`
+	Page       int                 `json:"page,omitempty"`
+	Limit      int                 `json:"limit"`
+	Total      int                 `json:"total"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+	PrevCursor string              `json:"prev_cursor,omitempty"`
+}
+
+type AdminUserDetailResponse struct {
+	AdminUserResponse
+	OrderCount    int `json:"order_count"`
+	LifetimeSpend int `json:"lifetime_spend"`
+}
+
+type ImpersonateUserRequest struct {
+	Reason string `json:"reason"`
+}
+
+type ImpersonationResponse struct {
+	Token          string    `json:"token"`
+	UserID         string    `json:"user_id"`
+	ImpersonatorID string    `json:"impersonator_id"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+type LinkedIdentityExport struct {
+	Provider string    `json:"provider"`
+	Email    *string   `json:"email"`
+	LinkedAt time.Time `json:"linked_at"`
+}
+
+type UserDataExport struct {
+	ExportedAt       time.Time              `json:"exported_at"`
+	Profile          UserProfileResponse    `json:"profile"`
+	LinkedIdentities []LinkedIdentityExport `json:"linked_identities"`
+	Cart             []CartItemResponse     `json:"cart"`
+	Orders           []OrderHistoryResponse `json:"orders"`
+}
+
+type ErasureRequest struct {
+	Reason string `json:"reason"`
+}
+
+type ErasureRequestResponse struct {
+	ID          string     `json:"id"`
+	UserID      *string    `json:"user_id"`
+	RequestedBy *string    `json:"requested_by"`
+	Reason      string     `json:"reason"`
+	RequestedAt time.Time  `json:"requested_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	LastError   *string    `json:"last_error"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	AllowedIPs []string   `json:"allowed_ips"`
+}
+
+type APIKeyResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	AllowedIPs []string   `json:"allowed_ips"`
+	CreatedBy  string     `json:"created_by"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP *string    `json:"last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type CreateAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
@@ -0,0 +1,74 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// LogNotifier writes messages to a logger instead of delivering them. It is
+// meant for local development and tests. Bodies carry secrets such as reset
+// tokens, so they are left out unless ShowBody is set.
+type LogNotifier struct {
+	Logger   *log.Logger
+	ShowBody bool
+}
+
+func (n *LogNotifier) Notify(ctx context.Context, msg Message) error {
+	logger := n.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	if n.ShowBody {
+		logger.Printf("notification to=%s subject=%q body=%q", msg.To, msg.Subject, msg.Body)
+	} else {
+		logger.Printf("notification to=%s subject=%q body=[redacted, %d bytes]", msg.To, msg.Subject, len(msg.Body))
+	}
+	return nil
+}
+
+type SMTPNotifier struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func (n *SMTPNotifier) Notify(ctx context.Context, msg Message) error {
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return fmt.Errorf("invalid characters in message headers")
+	}
+
+	var auth smtp.Auth
+	if n.Username != "" {
+		host, _, err := net.SplitHostPort(n.Addr)
+		if err != nil {
+			return fmt.Errorf("invalid SMTP address: %w", err)
+		}
+		auth = smtp.PlainAuth("", n.Username, n.Password, host)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", n.From)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(msg.Body)
+
+	return smtp.SendMail(n.Addr, auth, n.From, []string{msg.To}, []byte(b.String()))
+}
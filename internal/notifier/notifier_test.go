@@ -0,0 +1,107 @@
+package notifier
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeSMTPServer accepts a single SMTP session and sends the received DATA
+// section on the returned channel.
+func fakeSMTPServer(t *testing.T) (string, <-chan string) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start fake SMTP server: %v", err)
+	}
+
+	received := make(chan string, 1)
+
+	go func() {
+		defer ln.Close()
+
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		write := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		write("220 localhost ESMTP")
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				write("250 localhost")
+			case strings.HasPrefix(cmd, "DATA"):
+				write("354 End data with <CR><LF>.<CR><LF>")
+				var data strings.Builder
+				for {
+					dataLine, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if dataLine == ".\r\n" {
+						break
+					}
+					data.WriteString(dataLine)
+				}
+				received <- data.String()
+				write("250 OK")
+			case strings.HasPrefix(cmd, "QUIT"):
+				write("221 Bye")
+				return
+			default:
+				write("250 OK")
+			}
+		}
+	}()
+
+	return ln.Addr().String(), received
+}
+
+func TestSMTPNotifier_Delivers(t *testing.T) {
+	addr, received := fakeSMTPServer(t)
+
+	n := &SMTPNotifier{Addr: addr, From: "shop@example.com"}
+
+	err := n.Notify(context.Background(), Message{
+		To:      "customer@example.com",
+		Subject: "Hello",
+		Body:    "Your token is abc123",
+	})
+	if err != nil {
+		t.Fatalf("Expected message to be delivered, got error: %v", err)
+	}
+
+	data := <-received
+	if !strings.Contains(data, "Subject: Hello") {
+		t.Errorf("Expected subject header in delivered message, got %q", data)
+	}
+	if !strings.Contains(data, "Your token is abc123") {
+		t.Errorf("Expected body in delivered message, got %q", data)
+	}
+}
+
+func TestSMTPNotifier_RejectsHeaderInjection(t *testing.T) {
+	n := &SMTPNotifier{Addr: "127.0.0.1:1", From: "shop@example.com"}
+
+	err := n.Notify(context.Background(), Message{
+		To:      "customer@example.com\r\nBcc: victim@example.com",
+		Subject: "Hello",
+		Body:    "body",
+	})
+	if err == nil {
+		t.Errorf("Expected header injection attempt to be rejected")
+	}
+}
@@ -0,0 +1,60 @@
+package oidc_test
+
+import (
+	"context"
+	"ecommerce-api-v2/internal/oidc"
+	"ecommerce-api-v2/internal/oidc/oidctest"
+	"testing"
+)
+
+func TestProvider_CodeFlowWithPKCE(t *testing.T) {
+	fake := oidctest.NewProvider(t)
+	fake.SetUser(oidctest.User{Subject: "user-123", Email: "jane@example.com", EmailVerified: true})
+
+	provider, err := oidc.Discover(context.Background(), "fake", fake.Config("http://localhost/callback"), nil)
+	if err != nil {
+		t.Fatalf("Discovery failed: %v", err)
+	}
+
+	verifier, _ := oidc.GenerateCodeVerifier()
+	code, state, err := fake.Authorize(provider.AuthCodeURL("some-state", "some-nonce", verifier))
+	if err != nil {
+		t.Fatalf("Authorization failed: %v", err)
+	}
+	if state != "some-state" {
+		t.Errorf("Expected state to round-trip, got %q", state)
+	}
+
+	claims, err := provider.Exchange(context.Background(), code, verifier)
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+
+	if claims.Subject != "user-123" || claims.Email != "jane@example.com" || !claims.EmailVerified {
+		t.Errorf("Unexpected claims: %+v", claims)
+	}
+	if claims.Nonce != "some-nonce" {
+		t.Errorf("Expected nonce to round-trip, got %q", claims.Nonce)
+	}
+}
+
+func TestProvider_RejectsWrongCodeVerifier(t *testing.T) {
+	fake := oidctest.NewProvider(t)
+	fake.SetUser(oidctest.User{Subject: "user-123", Email: "jane@example.com", EmailVerified: true})
+
+	provider, err := oidc.Discover(context.Background(), "fake", fake.Config("http://localhost/callback"), nil)
+	if err != nil {
+		t.Fatalf("Discovery failed: %v", err)
+	}
+
+	verifier, _ := oidc.GenerateCodeVerifier()
+	code, _, err := fake.Authorize(provider.AuthCodeURL("some-state", "some-nonce", verifier))
+	if err != nil {
+		t.Fatalf("Authorization failed: %v", err)
+	}
+
+	other, _ := oidc.GenerateCodeVerifier()
+	if _, err := provider.Exchange(context.Background(), code, other); err == nil {
+		t.Errorf("Expected exchange with the wrong code verifier to fail")
+	}
+}
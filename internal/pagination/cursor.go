@@ -0,0 +1,179 @@
+// Package pagination implements keyset pagination over lists ordered
+// newest first by (created_at, id).
+//
+// A page is requested with an opaque cursor naming the row the page
+// starts after (or, going backwards, ends before). Unlike LIMIT/OFFSET,
+// rows inserted between requests don't shift later pages, and deep pages
+// cost no more than the first. Cursors are signed so clients can't forge
+// positions, and carry a scope so a cursor for one list is refused by
+// another.
+package pagination
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidCursor = errors.New("pagination: invalid cursor")
+
+// Cursor is a position in a list ordered by created_at DESC, id DESC.
+type Cursor struct {
+	Scope     string
+	CreatedAt time.Time
+	ID        uuid.UUID
+	// Before is set for a cursor that pages backwards, towards newer rows.
+	Before bool
+}
+
+type cursorPayload struct {
+	Scope     string    `json:"s"`
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"i"`
+	Before    bool      `json:"b,omitempty"`
+}
+
+// Where returns the condition selecting the rows on the cursor's side of
+// it, comparing createdAtCol and idCol against placeholders $n and $n+1.
+func (c Cursor) Where(createdAtCol, idCol string, n int) string {
+	op := "<"
+	if c.Before {
+		op = ">"
+	}
+	return fmt.Sprintf("(%s, %s) %s ($%d, $%d)", createdAtCol, idCol, op, n, n+1)
+}
+
+// Args returns the arguments for the placeholders in Where.
+func (c Cursor) Args() []any {
+	return []any{c.CreatedAt, c.ID}
+}
+
+// OrderBy returns the ORDER BY clause to fetch a page in. Pages before a
+// cursor are read in reverse, nearest rows first; Paginate puts them back.
+func OrderBy(c *Cursor, createdAtCol, idCol string) string {
+	if c != nil && c.Before {
+		return createdAtCol + " ASC, " + idCol + " ASC"
+	}
+	return createdAtCol + " DESC, " + idCol + " DESC"
+}
+
+// Signer encodes and verifies cursors with an HMAC key.
+type Signer struct {
+	key []byte
+}
+
+func NewSigner(key []byte) *Signer {
+	return &Signer{key: key}
+}
+
+var (
+	defaultSigner     *Signer
+	defaultSignerOnce sync.Once
+)
+
+// DefaultSigner returns a signer with a random key generated on first use.
+// Its cursors stop working when the process restarts.
+func DefaultSigner() *Signer {
+	defaultSignerOnce.Do(func() {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic("pagination: could not generate cursor key: " + err.Error())
+		}
+		defaultSigner = NewSigner(key)
+	})
+	return defaultSigner
+}
+
+func (s *Signer) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// Encode returns the opaque token for c.
+func (s *Signer) Encode(c Cursor) string {
+	payload, _ := json.Marshal(cursorPayload{
+		Scope:     c.Scope,
+		CreatedAt: c.CreatedAt,
+		ID:        c.ID,
+		Before:    c.Before,
+	})
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(s.sign(payload))
+}
+
+// Decode verifies token and returns its cursor. It returns
+// ErrInvalidCursor if the token is malformed, was not signed by s or
+// belongs to a list other than scope.
+func (s *Signer) Decode(scope, token string) (Cursor, error) {
+	enc := base64.RawURLEncoding
+
+	encodedPayload, encodedSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return Cursor{}, ErrInvalidCursor
+	}
+	payload, err := enc.DecodeString(encodedPayload)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	sig, err := enc.DecodeString(encodedSig)
+	if err != nil || !hmac.Equal(sig, s.sign(payload)) {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	var p cursorPayload
+	if err := json.Unmarshal(payload, &p); err != nil || p.Scope != scope {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	return Cursor{Scope: p.Scope, CreatedAt: p.CreatedAt, ID: p.ID, Before: p.Before}, nil
+}
+
+// Paginate turns rows fetched with LIMIT limit+1 in OrderBy's order into
+// a page of at most limit rows, newest first, along with tokens for the
+// next and previous pages. A token is empty when there is no such page.
+// key returns a row's created_at and id.
+func Paginate[T any](s *Signer, scope string, c *Cursor, rows []T, limit int, key func(T) (time.Time, uuid.UUID)) (page []T, next, prev string) {
+	hasMore := len(rows) > limit
+	if hasMore {
+		rows = rows[:limit]
+	}
+
+	backwards := c != nil && c.Before
+	if backwards {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	if len(rows) == 0 {
+		return rows, "", ""
+	}
+
+	// Going forwards, hasMore means older rows remain and any cursor means
+	// newer ones were passed. Going backwards it's the other way round.
+	hasOlder, hasNewer := hasMore, c != nil
+	if backwards {
+		hasOlder, hasNewer = true, hasMore
+	}
+
+	if hasOlder {
+		createdAt, id := key(rows[len(rows)-1])
+		next = s.Encode(Cursor{Scope: scope, CreatedAt: createdAt, ID: id})
+	}
+	if hasNewer {
+		createdAt, id := key(rows[0])
+		prev = s.Encode(Cursor{Scope: scope, CreatedAt: createdAt, ID: id, Before: true})
+	}
+
+	return rows, next, prev
+}
@@ -0,0 +1,90 @@
+package pagination
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type row struct {
+	createdAt time.Time
+	id        uuid.UUID
+}
+
+func rowKey(r row) (time.Time, uuid.UUID) {
+	return r.createdAt, r.id
+}
+
+func TestSigner_RoundTrip(t *testing.T) {
+	s := NewSigner([]byte("test-key"))
+	c := Cursor{Scope: "products", CreatedAt: time.Date(2026, 1, 2, 3, 4, 5, 123456000, time.UTC), ID: uuid.New(), Before: true}
+
+	got, err := s.Decode("products", s.Encode(c))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !got.CreatedAt.Equal(c.CreatedAt) || got.ID != c.ID || !got.Before {
+		t.Errorf("Expected %+v, got %+v", c, got)
+	}
+}
+
+func TestSigner_RejectsInvalidCursors(t *testing.T) {
+	s := NewSigner([]byte("test-key"))
+	token := s.Encode(Cursor{Scope: "products", CreatedAt: time.Now(), ID: uuid.New()})
+
+	tests := map[string]struct {
+		signer *Signer
+		scope  string
+		token  string
+	}{
+		"other scope":  {s, "orders", token},
+		"other key":    {NewSigner([]byte("other-key")), "products", token},
+		"tampered":     {s, "products", "x" + token},
+		"no signature": {s, "products", "e30"},
+		"not base64":   {s, "products", "!!!.!!!"},
+		"empty":        {s, "products", ""},
+	}
+
+	for name, tt := range tests {
+		if _, err := tt.signer.Decode(tt.scope, tt.token); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: expected ErrInvalidCursor, got %v", name, err)
+		}
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	s := NewSigner([]byte("test-key"))
+	now := time.Now()
+	rows := make([]row, 5)
+	for i := range rows {
+		rows[i] = row{createdAt: now.Add(-time.Duration(i) * time.Minute), id: uuid.New()}
+	}
+
+	page, next, prev := Paginate(s, "products", nil, rows[:3], 2, rowKey)
+	if len(page) != 2 || next == "" || prev != "" {
+		t.Fatalf("Expected a first page with only a next cursor, got %d rows, next %q, prev %q", len(page), next, prev)
+	}
+
+	c, _ := s.Decode("products", next)
+	if c.ID != rows[1].id || c.Before {
+		t.Errorf("Expected next cursor after the second row, got %+v", c)
+	}
+
+	// The last page, reached going forwards.
+	page, next, prev = Paginate(s, "products", &c, rows[2:5], 3, rowKey)
+	if len(page) != 3 || next != "" || prev == "" {
+		t.Fatalf("Expected a last page with only a prev cursor, got %d rows, next %q, prev %q", len(page), next, prev)
+	}
+
+	// Going backwards from the third row, rows arrive nearest first.
+	before := Cursor{Scope: "products", CreatedAt: rows[2].createdAt, ID: rows[2].id, Before: true}
+	page, next, prev = Paginate(s, "products", &before, []row{rows[1], rows[0]}, 2, rowKey)
+	if page[0].id != rows[0].id || page[1].id != rows[1].id {
+		t.Errorf("Expected the backwards page newest first, got %+v", page)
+	}
+	if next == "" || prev != "" {
+		t.Errorf("Expected the first page reached backwards to have only a next cursor, got next %q, prev %q", next, prev)
+	}
+}
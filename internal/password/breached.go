@@ -0,0 +1,100 @@
+package password
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const hashPrefixLength = 5
+
+// BreachChecker looks up breached password hashes by range, in the style of
+// the Pwned Passwords API: given the first five hex characters of a SHA-1
+// hash it returns the remaining characters of every breached hash with that
+// prefix. The full hash of the password is never handed over, so a remote
+// implementation can be swapped in without leaking passwords.
+type BreachChecker interface {
+	Range(ctx context.Context, prefix string) ([]string, error)
+}
+
+// IsBreached reports whether password appears in the checker's list.
+func IsBreached(ctx context.Context, checker BreachChecker, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, err := checker.Range(ctx, hash[:hashPrefixLength])
+	if err != nil {
+		return false, err
+	}
+
+	for _, suffix := range suffixes {
+		if suffix == hash[hashPrefixLength:] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// BreachedList is an in-memory BreachChecker loaded from a hash list file.
+type BreachedList struct {
+	ranges map[string][]string
+	size   int
+}
+
+// LoadBreachedList reads a file of SHA-1 password hashes, one per line in
+// hex. Anything after a colon on a line, such as the occurrence counts in
+// the Pwned Passwords downloads, is ignored, as are blank lines and lines
+// starting with #.
+func LoadBreachedList(path string) (*BreachedList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadBreachedList(f)
+}
+
+func ReadBreachedList(r io.Reader) (*BreachedList, error) {
+	list := &BreachedList{ranges: make(map[string][]string)}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		hash, _, _ := strings.Cut(entry, ":")
+		hash = strings.ToUpper(strings.TrimSpace(hash))
+		if len(hash) != sha1.Size*2 {
+			return nil, fmt.Errorf("line %d: not a SHA-1 hash", line)
+		}
+		if _, err := hex.DecodeString(hash); err != nil {
+			return nil, fmt.Errorf("line %d: not a SHA-1 hash", line)
+		}
+
+		prefix := hash[:hashPrefixLength]
+		list.ranges[prefix] = append(list.ranges[prefix], hash[hashPrefixLength:])
+		list.size++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (l *BreachedList) Range(ctx context.Context, prefix string) ([]string, error) {
+	return l.ranges[strings.ToUpper(prefix)], nil
+}
+
+// Len returns the number of hashes in the list.
+func (l *BreachedList) Len() int {
+	return l.size
+}
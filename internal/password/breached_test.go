@@ -0,0 +1,40 @@
+package password
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestReadBreachedList(t *testing.T) {
+	input := `# comment line
+
+5baa61e4c9b93f3f0682250b6cf8331b7ee68fd8
+CBFDAC6008F9CAB4083784CBD1874F76618D2A97:251682
+`
+	list, err := ReadBreachedList(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Failed to read list: %v", err)
+	}
+
+	if list.Len() != 2 {
+		t.Errorf("Expected 2 hashes, got %d", list.Len())
+	}
+
+	for _, pw := range []string{"password", "password123"} {
+		breached, err := IsBreached(context.Background(), list, pw)
+		if err != nil || !breached {
+			t.Errorf("Expected %q to be found in the list", pw)
+		}
+	}
+
+	if breached, _ := IsBreached(context.Background(), list, "not in the list"); breached {
+		t.Errorf("Expected an unlisted password not to be found")
+	}
+}
+
+func TestReadBreachedList_RejectsMalformedLines(t *testing.T) {
+	if _, err := ReadBreachedList(strings.NewReader("not-a-hash\n")); err == nil {
+		t.Errorf("Expected an error for a malformed line")
+	}
+}
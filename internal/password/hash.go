@@ -0,0 +1,177 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algorithm names a password hashing scheme.
+type Algorithm string
+
+const (
+	Bcrypt   Algorithm = "bcrypt"
+	Argon2id Algorithm = "argon2id"
+)
+
+// Argon2Params are the argon2id cost parameters. They are encoded in every
+// hash, so changing them never breaks existing hashes.
+type Argon2Params struct {
+	// Memory is in KiB.
+	Memory     uint32
+	Time       uint32
+	Threads    uint8
+	SaltLength uint32
+	KeyLength  uint32
+}
+
+// Hasher produces password hashes with the target algorithm and cost, and
+// verifies hashes made by any supported algorithm. Hashes are stored in
+// their self-describing encodings: the usual $2a$ form for bcrypt and the
+// PHC string format for argon2id.
+type Hasher struct {
+	Algorithm  Algorithm
+	BcryptCost int
+	Argon2     Argon2Params
+}
+
+func DefaultHasher() Hasher {
+	return Hasher{
+		Algorithm:  Bcrypt,
+		BcryptCost: 12,
+		Argon2: Argon2Params{
+			Memory:     64 * 1024,
+			Time:       3,
+			Threads:    2,
+			SaltLength: 16,
+			KeyLength:  32,
+		},
+	}
+}
+
+// ErrUnknownHash is returned for hashes in no format the Hasher knows, such
+// as the '!' placeholder of accounts without a usable password.
+var ErrUnknownHash = errors.New("unrecognised password hash format")
+
+// Hash returns the encoded hash of password under the target algorithm.
+func (h Hasher) Hash(password string) (string, error) {
+	switch h.Algorithm {
+	case Bcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	case Argon2id:
+		salt := make([]byte, h.Argon2.SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, h.Argon2.Time, h.Argon2.Memory, h.Argon2.Threads, h.Argon2.KeyLength)
+		return encodeArgon2(h.Argon2, salt, key), nil
+	default:
+		return "", fmt.Errorf("unsupported password hash algorithm %q", h.Algorithm)
+	}
+}
+
+// Verify reports whether password matches encoded, whichever supported
+// algorithm produced it. Malformed and unrecognised hashes never match.
+func (h Hasher) Verify(password, encoded string) bool {
+	switch {
+	case isBcrypt(encoded):
+		return bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)) == nil
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		params, salt, key, err := decodeArgon2(encoded)
+		if err != nil {
+			return false
+		}
+		other := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, params.KeyLength)
+		return subtle.ConstantTimeCompare(key, other) == 1
+	default:
+		return false
+	}
+}
+
+// NeedsRehash reports whether encoded was made with a different algorithm
+// or weaker parameters than the target, so it should be replaced the next
+// time the plaintext password is available.
+func (h Hasher) NeedsRehash(encoded string) (bool, error) {
+	switch {
+	case isBcrypt(encoded):
+		cost, err := bcrypt.Cost([]byte(encoded))
+		if err != nil {
+			return false, err
+		}
+		return h.Algorithm != Bcrypt || cost < h.BcryptCost, nil
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		params, _, _, err := decodeArgon2(encoded)
+		if err != nil {
+			return false, err
+		}
+		return h.Algorithm != Argon2id ||
+			params.Memory < h.Argon2.Memory ||
+			params.Time < h.Argon2.Time ||
+			params.Threads < h.Argon2.Threads ||
+			params.SaltLength < h.Argon2.SaltLength ||
+			params.KeyLength < h.Argon2.KeyLength, nil
+	default:
+		return false, ErrUnknownHash
+	}
+}
+
+func isBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func encodeArgon2(p Argon2Params, salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Time, p.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+// decodeArgon2 parses a hash of the form
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>.
+func decodeArgon2(encoded string) (Argon2Params, []byte, []byte, error) {
+	var p Argon2Params
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != string(Argon2id) {
+		return p, nil, nil, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return p, nil, nil, ErrUnknownHash
+	}
+	if version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil {
+		return p, nil, nil, ErrUnknownHash
+	}
+	if p.Memory == 0 || p.Time == 0 || p.Threads == 0 {
+		return p, nil, nil, ErrUnknownHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, ErrUnknownHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, ErrUnknownHash
+	}
+
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+	return p, salt, key, nil
+}
@@ -0,0 +1,138 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func testArgon2Hasher() Hasher {
+	h := DefaultHasher()
+	h.Algorithm = Argon2id
+	h.Argon2.Memory = 8 * 1024
+	h.Argon2.Time = 1
+	h.Argon2.Threads = 1
+	return h
+}
+
+func TestHasher_HashAndVerify(t *testing.T) {
+	bcryptHasher := DefaultHasher()
+	bcryptHasher.BcryptCost = bcrypt.MinCost
+
+	hashers := map[string]Hasher{
+		"bcrypt":   bcryptHasher,
+		"argon2id": testArgon2Hasher(),
+	}
+
+	for name, h := range hashers {
+		t.Run(name, func(t *testing.T) {
+			hash, err := h.Hash("correct horse battery staple")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !h.Verify("correct horse battery staple", hash) {
+				t.Errorf("Expected password to match its hash")
+			}
+			if h.Verify("wrong password", hash) {
+				t.Errorf("Expected wrong password not to match")
+			}
+
+			needsRehash, err := h.NeedsRehash(hash)
+			if err != nil || needsRehash {
+				t.Errorf("Expected fresh hash not to need rehashing, got %v, %v", needsRehash, err)
+			}
+		})
+	}
+}
+
+func TestHasher_VerifyAcrossAlgorithms(t *testing.T) {
+	argon := testArgon2Hasher()
+
+	hash, err := argon.Hash("s3cret-password")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=8192,t=1,p=1$") {
+		t.Errorf("Unexpected argon2id encoding %q", hash)
+	}
+
+	// A bcrypt-configured hasher still verifies argon2id hashes and the
+	// other way round, so switching algorithms doesn't lock anyone out.
+	bcryptHasher := DefaultHasher()
+	bcryptHasher.BcryptCost = bcrypt.MinCost
+	if !bcryptHasher.Verify("s3cret-password", hash) {
+		t.Errorf("Expected bcrypt hasher to verify an argon2id hash")
+	}
+
+	legacy, _ := bcryptHasher.Hash("s3cret-password")
+	if !argon.Verify("s3cret-password", legacy) {
+		t.Errorf("Expected argon2id hasher to verify a bcrypt hash")
+	}
+}
+
+func TestHasher_NeedsRehash(t *testing.T) {
+	weakBcrypt := DefaultHasher()
+	weakBcrypt.BcryptCost = bcrypt.MinCost
+	weakBcryptHash, _ := weakBcrypt.Hash("password123")
+
+	weakArgon := testArgon2Hasher()
+	weakArgonHash, _ := weakArgon.Hash("password123")
+
+	strongArgon := testArgon2Hasher()
+	strongArgon.Argon2.Time = 2
+
+	strongBcrypt := DefaultHasher()
+	strongBcrypt.BcryptCost = bcrypt.MinCost + 1
+
+	tests := []struct {
+		name   string
+		hasher Hasher
+		hash   string
+		want   bool
+	}{
+		{"Same bcrypt cost", weakBcrypt, weakBcryptHash, false},
+		{"Higher bcrypt cost", strongBcrypt, weakBcryptHash, true},
+		{"Bcrypt to argon2id", weakArgon, weakBcryptHash, true},
+		{"Argon2id to bcrypt", weakBcrypt, weakArgonHash, true},
+		{"Same argon2id params", weakArgon, weakArgonHash, false},
+		{"Stronger argon2id params", strongArgon, weakArgonHash, true},
+		{"Lower target never downgrades", weakBcrypt, mustHash(t, strongBcrypt), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.hasher.NeedsRehash(tt.hash)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected NeedsRehash %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestHasher_UnknownHash(t *testing.T) {
+	h := DefaultHasher()
+
+	for _, hash := range []string{"!", "", "$argon2id$v=19$m=0,t=1,p=1$AAAA$AAAA", "$argon2id$garbage"} {
+		if h.Verify("!", hash) {
+			t.Errorf("Expected %q never to match", hash)
+		}
+		if _, err := h.NeedsRehash(hash); err == nil {
+			t.Errorf("Expected an error for %q", hash)
+		}
+	}
+}
+
+func mustHash(t *testing.T, h Hasher) string {
+	t.Helper()
+
+	hash, err := h.Hash("password123")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return hash
+}
@@ -0,0 +1,112 @@
+// Package password holds the rules new passwords must satisfy and the
+// hashing used to store them.
+package password
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Violation describes one policy rule a password failed.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+type Policy struct {
+	MinLength int
+	// MaxLength is counted in bytes because bcrypt ignores anything past
+	// 72 bytes.
+	MaxLength int
+
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+
+	// DisallowEmail rejects passwords equal to the account's email address
+	// or its local part.
+	DisallowEmail bool
+
+	// Breached is consulted when set; passwords found in it are rejected.
+	Breached BreachChecker
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		MinLength:     8,
+		MaxLength:     72,
+		DisallowEmail: true,
+	}
+}
+
+// Validate returns every rule the password breaks, or nil if it satisfies
+// the policy. An error is only returned when the breach check itself fails.
+func (p Policy) Validate(ctx context.Context, password, email string) ([]Violation, error) {
+	var violations []Violation
+
+	if n := utf8.RuneCountInString(password); n < p.MinLength {
+		violations = append(violations, Violation{
+			Rule:    "min_length",
+			Message: fmt.Sprintf("Password must be at least %d characters long", p.MinLength),
+		})
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		violations = append(violations, Violation{
+			Rule:    "max_length",
+			Message: fmt.Sprintf("Password must be at most %d bytes long", p.MaxLength),
+		})
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+
+	if p.RequireUpper && !hasUpper {
+		violations = append(violations, Violation{Rule: "require_upper", Message: "Password must contain an uppercase letter"})
+	}
+	if p.RequireLower && !hasLower {
+		violations = append(violations, Violation{Rule: "require_lower", Message: "Password must contain a lowercase letter"})
+	}
+	if p.RequireDigit && !hasDigit {
+		violations = append(violations, Violation{Rule: "require_digit", Message: "Password must contain a digit"})
+	}
+	if p.RequireSymbol && !hasSymbol {
+		violations = append(violations, Violation{Rule: "require_symbol", Message: "Password must contain a symbol"})
+	}
+
+	if p.DisallowEmail && email != "" {
+		local, _, _ := strings.Cut(email, "@")
+		if strings.EqualFold(password, email) || strings.EqualFold(password, local) {
+			violations = append(violations, Violation{Rule: "not_email", Message: "Password must not be your email address"})
+		}
+	}
+
+	if p.Breached != nil && password != "" {
+		breached, err := IsBreached(ctx, p.Breached, password)
+		if err != nil {
+			return nil, err
+		}
+		if breached {
+			violations = append(violations, Violation{
+				Rule:    "breached",
+				Message: "Password has appeared in a data breach and can't be used",
+			})
+		}
+	}
+
+	return violations, nil
+}
@@ -0,0 +1,84 @@
+package password
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func rules(violations []Violation) []string {
+	names := make([]string, len(violations))
+	for i, v := range violations {
+		names[i] = v.Rule
+	}
+	return names
+}
+
+func TestPolicy_Validate(t *testing.T) {
+	policy := Policy{
+		MinLength:     10,
+		MaxLength:     72,
+		RequireUpper:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+		DisallowEmail: true,
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		email    string
+		want     []string
+	}{
+		{"Strong password passes", "Tr0ub4dor&3-horse", "jane@example.com", nil},
+		{"Short password", "Ab1!", "jane@example.com", []string{"min_length"}},
+		{"Too long", "A1!" + strings.Repeat("a", 80), "jane@example.com", []string{"max_length"}},
+		{"Missing classes", "alllowercaseletters", "jane@example.com", []string{"require_upper", "require_digit", "require_symbol"}},
+		{"Email as password", "Jane@Example.com1", "jane@example.com1", []string{"not_email"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations, err := policy.Validate(context.Background(), tt.password, tt.email)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			got := rules(violations)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Expected violations %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPolicy_ValidateRejectsLocalPartOfEmail(t *testing.T) {
+	violations, _ := DefaultPolicy().Validate(context.Background(), "JaneDoe1984", "janedoe1984@example.com")
+	if got := rules(violations); len(got) != 1 || got[0] != "not_email" {
+		t.Errorf("Expected only not_email, got %v", got)
+	}
+}
+
+func TestPolicy_ValidateChecksBreachedList(t *testing.T) {
+	// SHA-1 of "password123".
+	list, err := ReadBreachedList(strings.NewReader("CBFDAC6008F9CAB4083784CBD1874F76618D2A97:251682\n"))
+	if err != nil {
+		t.Fatalf("Failed to read list: %v", err)
+	}
+
+	policy := DefaultPolicy()
+	policy.Breached = list
+
+	violations, err := policy.Validate(context.Background(), "password123", "jane@example.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := rules(violations); len(got) != 1 || got[0] != "breached" {
+		t.Errorf("Expected only breached, got %v", got)
+	}
+
+	violations, _ = policy.Validate(context.Background(), "correct horse battery staple", "jane@example.com")
+	if len(violations) != 0 {
+		t.Errorf("Expected an unlisted password to pass, got %v", rules(violations))
+	}
+}
@@ -0,0 +1,111 @@
+// Package s3test provides a minimal in-process S3-compatible object store
+// for tests of storage.S3Storage.
+package s3test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type object struct {
+	data        []byte
+	contentType string
+}
+
+// Server stores objects in memory for a single bucket. It checks that
+// requests carry a Signature Version 4 Authorization header for its access
+// key and that the signed payload hash matches the body, but doesn't
+// verify the signature itself.
+type Server struct {
+	Server      *httptest.Server
+	Bucket      string
+	Region      string
+	AccessKeyID string
+	SecretKey   string
+
+	mu      sync.Mutex
+	objects map[string]object
+}
+
+// NewServer starts a fake store that is shut down when the test ends.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	s := &Server{
+		Bucket:      "test-bucket",
+		Region:      "us-east-1",
+		AccessKeyID: "test-access-key",
+		SecretKey:   "test-secret-key",
+		objects:     make(map[string]object),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Server.Close)
+	return s
+}
+
+// Object returns the object stored at key.
+func (s *Server) Object(key string) (data []byte, contentType string, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.objects[key]
+	return o.data, o.contentType, ok
+}
+
+// Len returns the number of objects stored.
+func (s *Server) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.objects)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential="+s.AccessKeyID+"/") {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+		return
+	}
+
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+s.Bucket+"/")
+	if !ok || key == "" {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "IncompleteBody", http.StatusBadRequest)
+		return
+	}
+	hash := sha256.Sum256(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(hash[:]) {
+		http.Error(w, "XAmzContentSHA256Mismatch", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		s.objects[key] = object{data: body, contentType: r.Header.Get("Content-Type")}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		o, ok := s.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", o.contentType)
+		w.Write(o.data)
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+	}
+}
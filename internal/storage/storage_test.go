@@ -0,0 +1,76 @@
+package storage_test
+
+import (
+	"context"
+	"ecommerce-api-v2/internal/storage"
+	"ecommerce-api-v2/internal/storage/s3test"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalStorage(t *testing.T) {
+	s := &storage.LocalStorage{Dir: t.TempDir(), BaseURL: "/media/"}
+	ctx := context.Background()
+
+	if err := s.Put(ctx, "products/abc/original.png", []byte("data"), "image/png"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(s.Dir, "products", "abc", "original.png"))
+	if err != nil || string(got) != "data" {
+		t.Fatalf("Expected the file to be written, got %q, %v", got, err)
+	}
+	if url := s.URL("products/abc/original.png"); url != "/media/products/abc/original.png" {
+		t.Errorf("Unexpected URL %q", url)
+	}
+
+	if err := s.Delete(ctx, "products/abc/original.png"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := s.Delete(ctx, "products/abc/original.png"); err != nil {
+		t.Errorf("Expected deleting a missing object to succeed, got %v", err)
+	}
+
+	for _, key := range []string{"../escape", "/abs", "a//b", "a/./b", ""} {
+		if err := s.Put(ctx, key, nil, ""); !errors.Is(err, storage.ErrInvalidKey) {
+			t.Errorf("Put(%q): expected ErrInvalidKey, got %v", key, err)
+		}
+	}
+}
+
+func TestS3Storage(t *testing.T) {
+	fake := s3test.NewServer(t)
+	s := &storage.S3Storage{
+		Endpoint:        fake.Server.URL,
+		Region:          fake.Region,
+		Bucket:          fake.Bucket,
+		AccessKeyID:     fake.AccessKeyID,
+		SecretAccessKey: fake.SecretKey,
+		PublicURL:       "https://cdn.example.com",
+	}
+	ctx := context.Background()
+
+	if err := s.Put(ctx, "products/abc/thumb.jpg", []byte("jpeg"), "image/jpeg"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	data, contentType, ok := fake.Object("products/abc/thumb.jpg")
+	if !ok || string(data) != "jpeg" || contentType != "image/jpeg" {
+		t.Errorf("Expected the object to be stored, got %q %q %v", data, contentType, ok)
+	}
+	if url := s.URL("products/abc/thumb.jpg"); url != "https://cdn.example.com/products/abc/thumb.jpg" {
+		t.Errorf("Unexpected URL %q", url)
+	}
+
+	if err := s.Delete(ctx, "products/abc/thumb.jpg"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if fake.Len() != 0 {
+		t.Error("Expected the object to be deleted")
+	}
+
+	s.AccessKeyID = "wrong"
+	if err := s.Put(ctx, "products/abc/thumb.jpg", []byte("jpeg"), "image/jpeg"); err == nil {
+		t.Error("Expected a rejected request to return an error")
+	}
+}